@@ -11,6 +11,8 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
@@ -18,6 +20,7 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/jroimartin/gocui"
 	"github.com/midgarco/movie_downloader/config"
+	"github.com/midgarco/movie_downloader/download"
 	"github.com/midgarco/movie_downloader/log/gui"
 	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
 	"github.com/spf13/viper"
@@ -31,6 +34,11 @@ var (
 	configFile = flag.String("config", os.Getenv("HOME")+"/.pmd/agent.yaml", "The path to the config.yaml file")
 
 	client moviedownloader.MovieDownloaderServiceClient
+
+	// progressMu guards cancelProgress, which ends the progress stream so it
+	// is opened again with a new snapshot
+	progressMu     sync.Mutex
+	cancelProgress context.CancelFunc
 )
 
 func init() {
@@ -133,6 +141,8 @@ func layout(g *gocui.Gui) error {
 
 		log.SetHandler(gui.New(g, cli.New(v)))
 		log.Info("hello world")
+
+		go watchEvents()
 	}
 	if v, err := g.SetView("downloads", 0, 0, maxX-1, 5); err != nil {
 		if err != gocui.ErrUnknownView {
@@ -142,53 +152,150 @@ func layout(g *gocui.Gui) error {
 		v.Title = "Downloads"
 
 		// display download content
-		go func() {
-			stream, err := client.Progress(context.Background(), &moviedownloader.ProgressRequest{})
-			if err != nil {
-				log.WithError(err).Fatal("error connecting to pmd service")
-				return
-			}
-			log.Infof("connected to progress stream %s", viper.GetString("GRPC_ENDPOINT"))
+		go watchProgress(g, v)
+	}
+	return nil
+}
+
+// watchProgress lists the downloads in the view. The stream starts with a
+// snapshot of the downloads, and is opened again when resnapshot asks for a
+// new one.
+func watchProgress(g *gocui.Gui, v *gocui.View) {
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		progressMu.Lock()
+		cancelProgress = cancel
+		progressMu.Unlock()
+
+		streamProgress(ctx, g, v)
+		cancel()
+		if ctx.Err() == nil {
+			// the server connection was lost
+			return
+		}
+		log.Info("taking a new snapshot of the downloads")
+	}
+}
+
+// resnapshot replaces the downloads with a new snapshot from the server
+func resnapshot() {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if cancelProgress != nil {
+		cancelProgress()
+	}
+}
+
+func streamProgress(ctx context.Context, g *gocui.Gui, v *gocui.View) {
+	stream, err := client.Progress(ctx, &moviedownloader.ProgressRequest{})
+	if err != nil {
+		log.WithError(err).Fatal("error connecting to pmd service")
+		return
+	}
+	log.Infof("connected to progress stream %s", viper.GetString("GRPC_ENDPOINT"))
+
+	var downloads map[string]*moviedownloader.Progress
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			log.Warn("server connection lost")
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("failure receiving progress updates")
+			continue
+		}
+		v.Clear()
+
+		if res == nil {
+			log.WithField("result", fmt.Sprintf("%#v", res)).Warn("nil")
+			continue
+		}
+
+		downloads = download.MergeProgress(downloads, res)
+
+		// list the downloads in a stable order by filename
+		keys := make([]string, 0, len(downloads))
+		for k := range downloads {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return downloads[keys[i]].Filename < downloads[keys[j]].Filename
+		})
+
+		for _, id := range keys {
+			movie := downloads[id]
+			_, _ = v.Write([]byte(fmt.Sprintf("%.8s: %s (%d%%) %s/s %s/%s : %s\n",
+				id,
+				download.StateName(movie.State),
+				movie.Progress,
+				humanize.Bytes(uint64(movie.BytesPerSecond)),
+				humanize.Bytes(uint64(movie.BytesCompleted)),
+				humanize.Bytes(uint64(movie.Size)),
+				movie.Filename,
+			)))
+		}
+		g.Update(func(g *gocui.Gui) error { return nil })
+	}
+}
+
+// watchEvents logs the server lifecycle events, resuming after the last
+// received event whenever the stream has to be reconnected
+func watchEvents() {
+	req := &moviedownloader.WatchEventsRequest{}
+	for {
+		stream, err := client.WatchEvents(context.Background(), req)
+		if err != nil {
+			log.WithError(err).Error("error connecting to event stream")
+		} else {
 			for {
-				res, err := stream.Recv()
-				if err == io.EOF {
-					log.Warn("server connection lost")
-					break
-				}
+				ev, err := stream.Recv()
 				if err != nil {
-					log.WithError(err).Error("failure receiving progress updates")
-					continue
+					if err != io.EOF {
+						log.WithError(err).Error("failure receiving events")
+					}
+					break
 				}
-				v.Clear()
-
-				if res == nil {
-					log.WithField("result", fmt.Sprintf("%#v", res)).Warn("nil")
-					continue
+				req.StreamId = ev.StreamId
+				req.AfterSequence = ev.Sequence
+				if ev.Type == moviedownloader.EventType_EVENT_TYPE_RESET {
+					// events were missed, the downloads may be out of date
+					resnapshot()
 				}
 
-				keys := make([]int, 0, len(res.ActiveDownloads))
-				for k := range res.ActiveDownloads {
-					keys = append(keys, int(k))
-				}
-				sort.Ints(keys)
-
-				// for idx, movie := range res.ActiveDownloads {
-				for _, idx := range keys {
-					movie := res.ActiveDownloads[int32(idx)]
-					_, _ = v.Write([]byte(fmt.Sprintf("%d: (%d%%) %s/s %s/%s : %s\n",
-						idx,
-						movie.Progress,
-						humanize.Bytes(uint64(movie.BytesPerSecond)),
-						humanize.Bytes(uint64(movie.BytesCompleted)),
-						humanize.Bytes(uint64(movie.Size)),
-						movie.Filename,
-					)))
-				}
-				g.Update(func(g *gocui.Gui) error { return nil })
+				logEvent(ev)
 			}
-		}()
+		}
+
+		log.Warn("event stream lost, reconnecting")
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func logEvent(ev *moviedownloader.Event) {
+	ctx := log.WithFields(log.Fields{
+		"seq":  ev.Sequence,
+		"type": strings.TrimPrefix(ev.Type.String(), "EVENT_TYPE_"),
+	})
+	if ev.Filename != "" {
+		ctx = ctx.WithField("filename", ev.Filename)
+	}
+
+	switch ev.Type {
+	case moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_FAILED:
+		ctx.Errorf("download failed: %s", ev.Message)
+	case moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_MOVED:
+		ctx.Infof("moved to %s", ev.Message)
+	case moviedownloader.EventType_EVENT_TYPE_SEARCH_PERFORMED:
+		ctx.Infof("searched \"%s\" (%d results)", ev.Message, ev.Results)
+	case moviedownloader.EventType_EVENT_TYPE_RESET:
+		ctx.Warnf("missed events: %s", ev.Message)
+	default:
+		ctx.Info(ev.Message)
 	}
-	return nil
 }
 
 func quit(g *gocui.Gui, v *gocui.View) error {
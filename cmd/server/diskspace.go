@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/cavaliergopher/grab/v3"
+	"github.com/dustin/go-humanize"
+	"github.com/midgarco/movie_downloader/disk"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultDiskReserve is the free space that is always left on the
+	// download volume when DISK_RESERVE is not configured
+	defaultDiskReserve = 1 << 30
+
+	// diskSpaceInterval is how often the free space is checked to pause or
+	// resume the queued downloads
+	diskSpaceInterval = 30 * time.Second
+
+	// pauseLowDiskSpace is the pause reason of downloads paused by the
+	// server when the download volume is running out of space
+	pauseLowDiskSpace = "low disk space"
+)
+
+// preflight checks that the download volume has room for the movies on top
+// of the downloads that are still pending and the configured reserve
+func (s *server) preflight(mvs ...*movie.Movie) error {
+	free, err := disk.Free(s.downloadPath)
+	if err != nil {
+		log.WithError(err).Warn("could not determine free disk space")
+		return nil
+	}
+
+	var size int64
+	for _, mv := range mvs {
+		size += s.expectedSize(mv)
+	}
+	needed := uint64(size) + s.pendingBytes() + s.diskReserve()
+	if free < needed {
+		log.WithFields(log.Fields{
+			"id":     mvs[0].ID,
+			"free":   free,
+			"needed": needed,
+		}).Warn("not enough disk space")
+		st := status.New(codes.ResourceExhausted, fmt.Sprintf("not enough disk space: %s free, %s needed", humanize.Bytes(free), humanize.Bytes(needed)))
+		return st.Err()
+	}
+	return nil
+}
+
+// expectedSize returns the size of the movie as reported by the search
+// results, falling back to the Content-Length of a HEAD request
+func (s *server) expectedSize(mv *movie.Movie) int64 {
+	if mv.RawSize > 0 {
+		return int64(mv.RawSize)
+	}
+
+	req, err := http.NewRequest(http.MethodHead, s.downloadURL(mv), nil)
+	if err != nil {
+		return 0
+	}
+	req.SetBasicAuth(viper.GetString("USERNAME"), viper.GetString("PASSWORD"))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.WithError(err).WithField("id", mv.ID).Warn("failed to determine the download size")
+		return 0
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return 0
+	}
+	return resp.ContentLength
+}
+
+// pendingBytes returns the number of bytes the unfinished downloads still
+// need to write. Running downloads whose file was preallocated are left
+// out, the free space already accounts for them.
+func (s *server) pendingBytes() uint64 {
+	var pending uint64
+	for _, dl := range s.downloads.Active() {
+		if dl.State == download.Failed || (dl.Preallocated && download.IsRunning(dl.State)) {
+			continue
+		}
+		switch {
+		case dl.Size > 0 && dl.Size > dl.BytesCompleted:
+			pending += uint64(dl.Size - dl.BytesCompleted)
+		case dl.Size <= 0 && dl.Details.RawSize > 0:
+			pending += uint64(dl.Details.RawSize)
+		}
+	}
+	return pending
+}
+
+func (s *server) diskReserve() uint64 {
+	reserve := viper.GetSizeInBytes("DISK_RESERVE")
+	if reserve == 0 {
+		reserve = defaultDiskReserve
+	}
+	return uint64(reserve)
+}
+
+// reserveSpace runs right before grab starts writing
+func (s *server) reserveSpace(id string) func(resp *grab.Response) error {
+	return func(resp *grab.Response) error {
+		return s.reserveSpaceFor(id, resp.Filename, resp.Size(), resp.BytesComplete())
+	}
+}
+
+// reserveSpaceFor runs right before a transfer starts writing. It stops the
+// download when the rest of the file does not fit and preallocates the file
+// where the filesystem supports it, which marks the download as
+// preallocated.
+func (s *server) reserveSpaceFor(id, filename string, size, completed int64) error {
+	preallocated := false
+	defer func() {
+		s.downloads.Update(id, func(d *download.Download) {
+			d.Preallocated = preallocated
+		})
+	}()
+
+	remaining := size - completed
+	if remaining <= 0 {
+		// the whole file is on disk already
+		preallocated = true
+		return nil
+	}
+
+	if free, err := disk.Free(s.downloadPath); err == nil && free < uint64(remaining)+s.diskReserve() {
+		return fmt.Errorf("not enough disk space: %s free, %s needed", humanize.Bytes(free), humanize.Bytes(uint64(remaining)+s.diskReserve()))
+	}
+
+	ok, err := disk.Preallocate(filename, size)
+	if err != nil {
+		log.WithError(err).WithField("filename", filename).Warn("failed to preallocate file")
+	}
+	preallocated = ok
+	return nil
+}
+
+// checkDiskSpace pauses the queued downloads while the free space is below
+// the reserve and queues them again once space frees up. It returns whether
+// queued downloads may be started. The caller must hold s.scheduleMu.
+func (s *server) checkDiskSpace() bool {
+	free, err := disk.Free(s.downloadPath)
+	if err != nil {
+		return true
+	}
+
+	if free < s.diskReserve() {
+		for _, dl := range s.downloads.Queued() {
+			if _, err := s.downloads.Transition(dl.ID, download.Paused); err != nil {
+				continue
+			}
+			s.downloads.Update(dl.ID, func(d *download.Download) {
+				d.PauseReason = pauseLowDiskSpace
+			})
+			log.WithFields(log.Fields{
+				"id":   dl.ID,
+				"free": free,
+			}).Warn("paused download, low disk space")
+			s.publishDownload(events.DownloadPaused, dl.ID, pauseLowDiskSpace)
+		}
+		return false
+	}
+
+	for _, dl := range s.downloads.Paused() {
+		if dl.PauseReason != pauseLowDiskSpace {
+			continue
+		}
+		if _, err := s.downloads.Transition(dl.ID, download.Queued); err != nil {
+			continue
+		}
+		log.WithField("id", dl.ID).Info("resumed download, disk space available")
+		s.publishDownload(events.DownloadResumed, dl.ID, "")
+	}
+	return true
+}
+
+// watchDiskSpace re-runs the scheduler periodically so downloads paused for
+// lack of space resume once space frees up, until the context is cancelled
+func (s *server) watchDiskSpace(ctx context.Context) {
+	t := time.NewTicker(diskSpaceInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.schedule()
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/movie"
+)
+
+// addDownload queues a download of the given size and walks it to the
+// state
+func addDownload(t *testing.T, s *server, id string, size int, states ...download.State) download.Download {
+	t.Helper()
+	dl, _, err := s.downloads.Add(download.Request{Movie: &movie.Movie{ID: id, Filename: "Film." + id + ".2020", Extension: ".mkv", RawSize: size}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if dl, err = s.downloads.Transition(dl.ID, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dl
+}
+
+func TestPendingBytesSkipsPreallocated(t *testing.T) {
+	s := newTestServer(t)
+
+	addDownload(t, s, "queued", 500)
+	running := addDownload(t, s, "running", 1000, download.Starting, download.Downloading)
+	unallocated := addDownload(t, s, "unallocated", 300, download.Starting, download.Downloading)
+	paused := addDownload(t, s, "paused", 200, download.Starting, download.Downloading, download.Paused)
+	for _, dl := range []download.Download{running, unallocated, paused} {
+		s.downloads.Update(dl.ID, func(d *download.Download) {
+			d.Size = d.Details.Bytes()
+			d.BytesCompleted = 100
+			d.Preallocated = d.ID != unallocated.ID
+		})
+	}
+
+	// the running preallocated download is already taken from the free
+	// space, a paused one may lose its slot and is still counted
+	if got, want := s.pendingBytes(), uint64(500+200+100); got != want {
+		t.Fatalf("pendingBytes = %d, want %d", got, want)
+	}
+}
+
+func TestReserveSpaceMarksPreallocated(t *testing.T) {
+	s := newTestServer(t)
+	if err := os.MkdirAll(s.downloadPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dl := addDownload(t, s, "running", 1<<20, download.Starting, download.Downloading)
+	partial := filepath.Join(s.downloadPath, "running.partial")
+
+	if err := s.reserveSpaceFor(dl.ID, partial, 1<<20, 0); err != nil {
+		t.Fatal(err)
+	}
+	dl, _ = s.downloads.Get(dl.ID)
+	if !dl.Preallocated {
+		t.Skip("the filesystem does not support preallocation")
+	}
+	if got := s.pendingBytes(); got != 0 {
+		t.Fatalf("pendingBytes = %d after preallocating, want 0", got)
+	}
+
+	// the file is preallocated again when the transfer starts over, a
+	// failed preallocation must not leave the mark behind
+	if err := s.reserveSpaceFor(dl.ID, filepath.Join(s.downloadPath, "missing", "running.partial"), 1<<20, 0); err != nil {
+		t.Fatal(err)
+	}
+	if dl, _ = s.downloads.Get(dl.ID); dl.Preallocated {
+		t.Fatal("a download whose preallocation failed is marked as preallocated")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/events"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WatchEvents streams the lifecycle events, starting after the sequence
+// number the client last received. A client that missed events, because
+// the server restarted or dropped them from its history, gets a reset
+// event so it takes a new snapshot.
+func (s *server) WatchEvents(req *moviedownloader.WatchEventsRequest, stream moviedownloader.MovieDownloaderService_WatchEventsServer) error {
+	log.WithFields(log.Fields{
+		"stream_id":      req.StreamId,
+		"after_sequence": req.AfterSequence,
+	}).Info("starting event stream")
+
+	streamID := s.events.StreamID()
+
+	// subscribe before reading the history so no event can fall in between
+	signal, release := s.events.Subscribe()
+	defer release()
+
+	after := req.AfterSequence
+	// a new client has nothing to miss until it received the first events
+	resuming := req.StreamId != ""
+	reason := ""
+	if resuming && req.StreamId != streamID {
+		reason = "server restarted"
+	}
+
+	for {
+		if reason == "" && resuming && s.events.Missed(after) {
+			reason = "events were dropped from the history"
+		}
+		if reason != "" {
+			after = s.events.Sequence()
+			reset := events.Event{
+				Sequence:  after,
+				Timestamp: time.Now(),
+				Type:      events.Reset,
+				Message:   reason,
+			}
+			if err := stream.Send(reset.MapToProto(streamID)); err != nil {
+				return streamError(err)
+			}
+			log.WithField("reason", reason).Info("reset event stream")
+			reason = ""
+		}
+
+		for _, e := range s.events.Since(after) {
+			if err := stream.Send(e.MapToProto(streamID)); err != nil {
+				return streamError(err)
+			}
+			after = e.Sequence
+		}
+		resuming = true
+
+		select {
+		case <-stream.Context().Done():
+			log.Info("event stream closed")
+			return nil
+		case <-signal:
+		}
+	}
+}
+
+// streamError logs the error that ended the event stream. A client that
+// went away is not an error.
+func streamError(err error) error {
+	if status.Code(err) == codes.Unavailable || status.Code(err) == codes.Canceled {
+		log.Info("event stream closed")
+		return nil
+	}
+
+	log.WithError(err).Error("failed to stream events")
+	return err
+}
+
+// publishDownload publishes a download lifecycle event
+func (s *server) publishDownload(t events.Type, id string, message string) {
+	e := events.Event{
+		Type:       t,
+		DownloadID: id,
+		Message:    message,
+	}
+	if dl, ok := s.downloads.Get(id); ok {
+		e.Filename = dl.Filename
+		e.Details = dl.Details
+	}
+	s.events.Publish(e)
+}
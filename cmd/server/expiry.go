@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultExpiryWindow is how long before their expiry posts are downloaded
+// first, when EXPIRY_WINDOW is not configured
+const defaultExpiryWindow = 72 * time.Hour
+
+// ExpiredError is returned for a post the provider already dropped
+type ExpiredError struct {
+	Filename  string
+	ExpiredAt time.Time
+}
+
+func (e *ExpiredError) Error() string {
+	return fmt.Sprintf("%s expired on %s", e.Filename, e.ExpiredAt.Format(time.DateTime))
+}
+
+// retention returns the RETENTION_DAYS setting, the days the provider keeps
+// posts, which estimates the expiry of posts the provider gives no expiry
+// date for. Zero means it is not known.
+func retention() time.Duration {
+	return time.Duration(viper.GetInt("RETENTION_DAYS")) * 24 * time.Hour
+}
+
+func expiryWindow() time.Duration {
+	window := viper.GetDuration("EXPIRY_WINDOW")
+	if window <= 0 {
+		window = defaultExpiryWindow
+	}
+	return window
+}
+
+// expiresAt returns when the provider drops the post
+func expiresAt(mv *movie.Movie) (time.Time, bool) {
+	if mv == nil {
+		return time.Time{}, false
+	}
+	return mv.ExpiresAt(retention())
+}
+
+// expiringSoon returns whether the post expires within the expiry window
+func expiringSoon(mv *movie.Movie, now time.Time) bool {
+	t, ok := expiresAt(mv)
+	return ok && t.Sub(now) < expiryWindow()
+}
+
+// checkExpiry fails with FailedPrecondition when one of the posts expired,
+// downloading it would fail partway through
+func checkExpiry(mvs ...*movie.Movie) error {
+	now := time.Now()
+	for _, mv := range mvs {
+		if t, ok := expiresAt(mv); ok && !t.After(now) {
+			err := &ExpiredError{Filename: mv.Filename + mv.Extension, ExpiredAt: t}
+			log.WithField("id", mv.ID).Warn(err.Error())
+			st := status.New(codes.FailedPrecondition, err.Error())
+			return st.Err()
+		}
+	}
+	return nil
+}
+
+// describeRetention fills in the age and the time to expiry of the post
+func describeRetention(p *moviedownloader.Movie, mv *movie.Movie, now time.Time) {
+	if t, ok := mv.PostTime(); ok {
+		p.AgeSeconds = int64(now.Sub(t).Seconds())
+	}
+	if t, ok := expiresAt(mv); ok {
+		p.ExpireTime = t.Unix()
+		p.ExpiresInSeconds = int64(t.Sub(now).Seconds())
+		p.ExpiringSoon = t.Sub(now) < expiryWindow()
+	}
+}
+
+// prioritize orders the queued downloads so posts about to expire start
+// first, soonest expiry first, and the others keep their order
+func prioritize(queued []download.Download) []download.Download {
+	now := time.Now()
+	type urgency struct {
+		soon    bool
+		expires time.Time
+	}
+	urgencies := make(map[string]urgency, len(queued))
+	for _, dl := range queued {
+		t, _ := expiresAt(dl.Details)
+		urgencies[dl.ID] = urgency{soon: expiringSoon(dl.Details, now), expires: t}
+	}
+
+	sort.SliceStable(queued, func(i, j int) bool {
+		a, b := urgencies[queued[i].ID], urgencies[queued[j].ID]
+		if a.soon != b.soon {
+			return a.soon
+		}
+		return a.soon && a.expires.Before(b.expires)
+	})
+	return queued
+}
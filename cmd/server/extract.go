@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/extract"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/safepath"
+	"github.com/midgarco/movie_downloader/sidecar"
+	"github.com/midgarco/movie_downloader/verify"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// stepExtracting is the post-processing step of downloads whose
+	// archives are being extracted
+	stepExtracting = "extracting"
+
+	// extractDirPrefix is the prefix of the folder archives are extracted
+	// into before the videos are moved next to the other downloads
+	extractDirPrefix = ".extract-"
+)
+
+// recoveryExts are the extensions of the files that only serve to check and
+// repair the archives, they are deleted along with them
+var recoveryExts = map[string]bool{
+	".par2": true,
+	".sfv":  true,
+}
+
+// complete post-processes the downloaded files, repairing them with the
+// PAR2 files among them and extracting the archives, and moves the
+// downloads to the completed state. A download that fails post-processing
+// keeps its files so it can be extracted again.
+func (s *server) complete(members []download.Download) {
+	err := s.repair(members)
+	if err == nil {
+		err = s.unpack(members)
+	}
+	if err != nil {
+		for _, dl := range members {
+			s.downloads.Update(dl.ID, func(stats *download.Download) {
+				stats.Step = ""
+				stats.StepProgress = 0
+			})
+			s.fail(dl.ID, err)
+		}
+		return
+	}
+
+	for _, dl := range members {
+		if _, err := s.downloads.Transition(dl.ID, download.Completed); err != nil {
+			// extracting may have consumed the record
+			if !errors.Is(err, download.ErrNotFound) {
+				log.WithError(err).WithField("id", dl.ID).Error("failed to finish download")
+			}
+			continue
+		}
+		s.publishDownload(events.DownloadCompleted, dl.ID, "")
+	}
+}
+
+// unpack extracts the archives among the downloaded files, verifies the
+// extracted videos and deletes the archive volumes and the recovery files.
+// The videos take the place of the archive downloads, in order; the archive
+// and recovery downloads left without a file are recorded in the history
+// and removed. Other files, like a video posted along with the archives,
+// stay downloads of their own.
+func (s *server) unpack(members []download.Download) error {
+	archives := []string{}
+	volumes, consumed := []download.Download{}, []download.Download{}
+	for _, dl := range members {
+		switch {
+		case extract.Detect(dl.Filename) != extract.None:
+			archives = append(archives, s.downloadFile(dl))
+			volumes = append(volumes, dl)
+		case extract.IsVolume(dl.Filename):
+			consumed = append(consumed, dl)
+		case recoveryExts[strings.ToLower(filepath.Ext(dl.Filename))]:
+			consumed = append(consumed, dl)
+		}
+	}
+	if len(archives) == 0 {
+		return nil
+	}
+	// the first volumes take the videos, the other volumes follow
+	volumes = append(volumes, consumed...)
+
+	logger := log.WithFields(log.Fields{
+		"id":       members[0].ID,
+		"archives": len(archives),
+	})
+
+	workdir := filepath.Join(s.downloadPath, extractDirPrefix+members[0].ID)
+	defer os.RemoveAll(workdir)
+
+	setStep := func(progress int64) {
+		for _, dl := range members {
+			s.downloads.Update(dl.ID, func(stats *download.Download) {
+				stats.Step = stepExtracting
+				stats.StepProgress = progress
+			})
+		}
+	}
+	setStep(0)
+
+	passwords := s.archivePasswords(members)
+	extracted := []string{}
+	for i, archive := range archives {
+		files, err := s.extractArchive(archive, workdir, passwords, func(written, total int64) {
+			if total > 0 {
+				setStep((int64(i)*100 + 100*written/total) / int64(len(archives)))
+			}
+		})
+		if err != nil {
+			logger.WithError(err).WithField("archive", archive).Error("failed to extract archive")
+			return fmt.Errorf("extracting %s: %w", filepath.Base(archive), err)
+		}
+		extracted = append(extracted, files...)
+	}
+
+	videos, err := extractedVideos(workdir, extracted)
+	if err != nil {
+		logger.WithError(err).Error("extracted file failed verification")
+		return err
+	}
+	if len(videos) == 0 {
+		return errors.New("the archives do not contain a video")
+	}
+
+	// the archives are no longer needed, neither are the recovery files
+	for _, dl := range volumes {
+		filename := s.downloadFile(dl)
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			logger.WithError(err).WithField("filename", filename).Warn("failed to delete archive")
+		}
+	}
+
+	targets := []string{}
+	for i, video := range videos {
+		target := safepath.Unique(download.Dir(s.downloadPath, members[0]), filepath.Base(video.path))
+		if err := os.Rename(video.path, target); err != nil {
+			return err
+		}
+		targets = append(targets, target)
+		if i >= len(volumes) {
+			logger.WithField("filename", target).Warn("more videos than archive downloads, the video is not tracked")
+			continue
+		}
+
+		s.downloads.Update(volumes[i].ID, func(stats *download.Download) {
+			stats.Filename = filepath.Base(target)
+			stats.SHA256 = video.result.SHA256
+			stats.Size = video.result.Size
+			stats.Step = ""
+			stats.StepProgress = 0
+		})
+		s.probe(volumes[i].ID, target)
+	}
+	for _, dl := range volumes[min(len(videos), len(volumes)):] {
+		s.consume(dl, targets[0])
+	}
+
+	logger.WithField("videos", len(videos)).Info("archives extracted")
+	return nil
+}
+
+// consume records the archive or recovery download whose file was deleted
+// after extracting it into the video and removes it from the downloads
+func (s *server) consume(dl download.Download, video string) {
+	dl.State = download.Done
+	dl.Step, dl.StepProgress = "", 0
+	dl.FinishedAt = time.Now()
+	s.recordHistory(dl, "")
+	s.downloads.Remove(dl.ID)
+	s.events.Publish(events.Event{
+		Type:       events.DownloadRemoved,
+		DownloadID: dl.ID,
+		Filename:   dl.Filename,
+		Message:    "extracted into " + filepath.Base(video),
+		Details:    dl.Details,
+	})
+}
+
+// extractArchive tries the password candidates in order until the archive
+// can be decrypted
+func (s *server) extractArchive(archive, dir string, passwords []string, progress func(written, total int64)) ([]string, error) {
+	var err error
+	for _, password := range passwords {
+		var files []string
+		files, err = extract.Extract(context.Background(), archive, dir, extract.Options{
+			Password: password,
+			Progress: progress,
+		})
+		if !errors.Is(err, extract.ErrPassword) {
+			return files, err
+		}
+	}
+	return nil, err
+}
+
+// archivePasswords returns the passwords to try: the password of the
+// download, the passwords announced in the subject and the NFO of the
+// release, and finally no password at all
+func (s *server) archivePasswords(members []download.Download) []string {
+	candidates := []string{}
+	for _, dl := range members {
+		if dl.Password != "" {
+			candidates = append(candidates, dl.Password)
+		}
+		if dl.Details == nil {
+			continue
+		}
+		if pw, ok := extract.FindPassword(dl.Details.Subject); ok {
+			candidates = append(candidates, pw)
+		}
+		if pw, ok := extract.FindPassword(dl.Details.Nfo); ok {
+			candidates = append(candidates, pw)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(s.downloadPath, sidecarName(members[0])+sidecar.NFOExt)); err == nil {
+		if pw, ok := extract.FindPassword(string(b)); ok {
+			candidates = append(candidates, pw)
+		}
+	}
+
+	seen := map[string]bool{}
+	passwords := []string{}
+	for _, pw := range append(candidates, "") {
+		if seen[pw] {
+			continue
+		}
+		seen[pw] = true
+		passwords = append(passwords, pw)
+	}
+	return passwords
+}
+
+type extractedVideo struct {
+	path   string
+	result verify.Result
+}
+
+// extractedVideos verifies the files extracted into the folder and returns
+// the videos in name order. Files that are not videos, like NFO and subtitle
+// files, are skipped, and so are samples unless the archive holds nothing
+// else.
+func extractedVideos(dir string, files []string) ([]extractedVideo, error) {
+	videos, samples := []extractedVideo{}, []extractedVideo{}
+	for _, f := range files {
+		result, err := verify.File(f, 0)
+		if errors.Is(err, verify.ErrNotVideo) || errors.Is(err, verify.ErrEmpty) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(f), err)
+		}
+
+		v := extractedVideo{path: f, result: result}
+		if rel, _ := filepath.Rel(dir, f); strings.Contains(strings.ToLower(rel), "sample") {
+			samples = append(samples, v)
+		} else {
+			videos = append(videos, v)
+		}
+	}
+	if len(videos) == 0 {
+		videos = samples
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].path < videos[j].path
+	})
+	return videos, nil
+}
+
+// Extract runs the extraction of a download that failed post-processing
+// again, optionally with a new password. Every failed member of its set is
+// extracted along with it.
+func (s *server) Extract(ctx context.Context, req *moviedownloader.ExtractRequest) (*moviedownloader.ExtractResponse, error) {
+	logger := log.WithField("id", req.Id)
+	logger.Info("extract request")
+
+	dl, ok := s.downloads.Get(req.Id)
+	if !ok {
+		st := status.New(codes.NotFound, "download not found")
+		return nil, st.Err()
+	}
+
+	members := []download.Download{dl}
+	if dl.Set != "" {
+		members = s.downloads.Set(dl.Set)
+	}
+	for _, m := range members {
+		// the members of a set that wait for the others are post-processing,
+		// finishSet post-processes the set once. A single download that is
+		// post-processing is already being extracted.
+		waiting := dl.Set != "" && m.State == download.PostProcessing
+		if m.State != download.Failed && !waiting {
+			st := status.New(codes.FailedPrecondition, "only downloads that failed post-processing can be extracted")
+			return nil, st.Err()
+		}
+		if _, err := os.Stat(s.downloadFile(m)); err != nil {
+			st := status.New(codes.FailedPrecondition, "the downloaded file is missing, retry the download instead: "+m.Filename)
+			return nil, st.Err()
+		}
+	}
+
+	for _, m := range members {
+		s.downloads.Update(m.ID, func(stats *download.Download) {
+			if req.Password != "" {
+				stats.Password = req.Password
+			}
+			stats.Error = ""
+		})
+		if m.State == download.Failed {
+			if _, err := s.downloads.Transition(m.ID, download.PostProcessing); err != nil {
+				logger.WithError(err).Error("failed to restart post-processing")
+				st := status.New(codes.FailedPrecondition, err.Error())
+				return nil, st.Err()
+			}
+		}
+	}
+
+	if dl.Set != "" {
+		go s.finishSet(dl.Set)
+	} else if fresh, ok := s.downloads.Get(dl.ID); ok {
+		go s.complete([]download.Download{fresh})
+	}
+
+	dl, _ = s.downloads.Get(dl.ID)
+	return &moviedownloader.ExtractResponse{Download: dl.MapToProto()}, nil
+}
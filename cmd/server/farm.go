@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/search"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// speedTestBytes is the number of bytes downloaded from every farm when
+	// the speed test request does not say otherwise
+	speedTestBytes = 16 << 20
+
+	// speedTestTimeout limits the time spent measuring a single farm
+	speedTestTimeout = 20 * time.Second
+)
+
+// mirror is the download server files are fetched from. The provider
+// advertises one with every search and the DOWNLOAD_FARM and DOWNLOAD_PORT
+// settings override it.
+type mirror struct {
+	BaseURL string
+	Farm    string
+	Port    string
+}
+
+// defaultMirror is used until the provider advertised a mirror
+var defaultMirror = mirror{
+	BaseURL: "https://members.easynews.com/dl",
+	Farm:    "auto",
+	Port:    "80",
+}
+
+// URL returns the download URL of the movie on the mirror
+func (m mirror) URL(mv *movie.Movie) string {
+	return fmt.Sprintf("%s/%s/%s/%s%s/%s%[5]s", strings.TrimRight(m.BaseURL, "/"), m.Farm, m.Port, mv.ID, mv.Extension, mv.Filename)
+}
+
+// validPort reports whether the port is one the provider serves downloads
+// on, plain HTTP on 80 or SSL on 443
+func validPort(port string) bool {
+	return port == "80" || port == "443"
+}
+
+// advertise remembers the mirror and the thumbnail servers the provider
+// advertised in the search results
+func (s *server) advertise(results *search.Results) {
+	s.mirrorMu.Lock()
+	defer s.mirrorMu.Unlock()
+
+	if results.ThumbURL != "" {
+		s.thumbs.BaseURL = results.ThumbURL
+	}
+	if results.LargeThumb != "" {
+		s.thumbs.LargeBaseURL = results.LargeThumb
+	}
+
+	if results.DownURL != "" {
+		s.advertised.BaseURL = results.DownURL
+	}
+	if results.DlFarm != "" {
+		s.advertised.Farm = results.DlFarm
+	}
+	if validPort(results.DlPort) {
+		s.advertised.Port = results.DlPort
+	}
+}
+
+// mirror returns the advertised mirror with the configured farm and port
+func (s *server) mirror() mirror {
+	s.mirrorMu.RLock()
+	m := s.advertised
+	s.mirrorMu.RUnlock()
+
+	if farm := viper.GetString("DOWNLOAD_FARM"); farm != "" {
+		m.Farm = farm
+	}
+	if port := viper.GetString("DOWNLOAD_PORT"); port != "" {
+		if validPort(port) {
+			m.Port = port
+		} else {
+			log.WithField("port", port).Warn("ignoring DOWNLOAD_PORT, use 80 or 443")
+		}
+	}
+	return m
+}
+
+// SpeedTest downloads the start of the movie from every farm, reports the
+// throughput of each and, unless it is a dry run, switches the downloads to
+// the fastest farm
+func (s *server) SpeedTest(ctx context.Context, req *moviedownloader.SpeedTestRequest) (*moviedownloader.SpeedTestResponse, error) {
+	if req.Movie == nil || req.Movie.Id == "" || req.Movie.Extension == "" || req.Movie.Filename == "" {
+		st := status.New(codes.InvalidArgument, "a movie is required to measure the download speed")
+		return nil, st.Err()
+	}
+	mv, err := movie.MapFromProtoObject(req.Movie)
+	if err != nil {
+		log.WithError(err).Error("failed to map proto object")
+		st := status.New(codes.Internal, "failed to map proto object")
+		return nil, st.Err()
+	}
+
+	m := s.mirror()
+	if req.Port != "" {
+		if !validPort(req.Port) {
+			st := status.New(codes.InvalidArgument, "port must be 80 or 443")
+			return nil, st.Err()
+		}
+		m.Port = req.Port
+	}
+
+	maxBytes := req.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = speedTestBytes
+	}
+
+	resp := &moviedownloader.SpeedTestResponse{}
+	var fastest float64
+	for _, farm := range s.speedTestFarms(req.Farms) {
+		m.Farm = farm
+		result := &moviedownloader.FarmSpeed{
+			Farm: farm,
+			Port: m.Port,
+		}
+
+		n, elapsed, err := measure(ctx, m.URL(mv), maxBytes)
+		result.Bytes = n
+		if elapsed > 0 {
+			result.BytesPerSecond = float64(n) / elapsed.Seconds()
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else if result.BytesPerSecond > fastest {
+			fastest = result.BytesPerSecond
+			resp.Fastest = farm
+		}
+
+		log.WithFields(log.Fields{
+			"farm":  farm,
+			"port":  m.Port,
+			"bytes": n,
+			"speed": result.BytesPerSecond,
+			"error": result.Error,
+		}).Info("speed test")
+		resp.Results = append(resp.Results, result)
+
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	if resp.Fastest == "" {
+		st := status.New(codes.Unavailable, "no farm could be reached")
+		return nil, st.Err()
+	}
+
+	if !req.DryRun {
+		viper.Set("DOWNLOAD_FARM", resp.Fastest)
+		if req.Port != "" {
+			viper.Set("DOWNLOAD_PORT", req.Port)
+		}
+		if err := viper.WriteConfig(); err != nil {
+			log.WithError(err).Error("failed to write config file")
+		}
+		log.WithField("farm", resp.Fastest).Info("switched to the fastest farm")
+	}
+
+	return resp, nil
+}
+
+// speedTestFarms returns the farms to measure, defaulting to the configured
+// farms and the farm the provider advertised
+func (s *server) speedTestFarms(requested []string) []string {
+	candidates := requested
+	if len(candidates) == 0 {
+		s.mirrorMu.RLock()
+		advertised := s.advertised.Farm
+		s.mirrorMu.RUnlock()
+
+		candidates = append(viper.GetStringSlice("DOWNLOAD_FARMS"), defaultMirror.Farm, advertised, viper.GetString("DOWNLOAD_FARM"))
+	}
+
+	seen := map[string]bool{}
+	farms := []string{}
+	for _, farm := range candidates {
+		farm = strings.TrimSpace(farm)
+		if farm == "" || seen[farm] {
+			continue
+		}
+		seen[farm] = true
+		farms = append(farms, farm)
+	}
+	return farms
+}
+
+// measure downloads up to maxBytes from the URL and returns the number of
+// bytes read and the time it took
+func measure(ctx context.Context, uri string, maxBytes int64) (int64, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, speedTestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.SetBasicAuth(viper.GetString("USERNAME"), viper.GetString("PASSWORD"))
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", maxBytes-1))
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, time.Since(start), fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxBytes))
+	elapsed := time.Since(start)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && n > 0 {
+		// a slow farm is measured over the time it was given
+		err = nil
+	}
+	return n, elapsed, err
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/history"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultHistoryRetention is how long history records are kept when
+	// HISTORY_RETENTION is not configured
+	defaultHistoryRetention = 90 * 24 * time.Hour
+
+	// defaultHistoryPageSize is the page size of ListHistory when the
+	// client does not ask for one
+	defaultHistoryPageSize = 50
+)
+
+// ListHistory ...
+func (s *server) ListHistory(ctx context.Context, req *moviedownloader.ListHistoryRequest) (*moviedownloader.ListHistoryResponse, error) {
+	filter, err := historyFilter(req.Filter)
+	if err != nil {
+		st := status.New(codes.InvalidArgument, err.Error())
+		return nil, st.Err()
+	}
+
+	offset := 0
+	if req.PageToken != "" {
+		offset, err = strconv.Atoi(req.PageToken)
+		if err != nil || offset < 0 {
+			st := status.New(codes.InvalidArgument, "invalid page token")
+			return nil, st.Err()
+		}
+	}
+
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 {
+		pageSize = defaultHistoryPageSize
+	}
+
+	records, total := s.history.List(filter, offset, pageSize)
+
+	resp := &moviedownloader.ListHistoryResponse{
+		Total: int32(total),
+	}
+	for _, r := range records {
+		resp.Records = append(resp.Records, r.MapToProto())
+	}
+	if next := offset + len(records); next < total {
+		resp.NextPageToken = strconv.Itoa(next)
+	}
+
+	return resp, nil
+}
+
+// ExportHistory ...
+func (s *server) ExportHistory(ctx context.Context, req *moviedownloader.ExportHistoryRequest) (*moviedownloader.ExportHistoryResponse, error) {
+	filter, err := historyFilter(req.Filter)
+	if err != nil {
+		st := status.New(codes.InvalidArgument, err.Error())
+		return nil, st.Err()
+	}
+
+	resp, err := s.exportHistory(filter, req.Format)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *server) exportHistory(filter history.Filter, format string) (*moviedownloader.ExportHistoryResponse, error) {
+	records, _ := s.history.List(filter, 0, 0)
+	stamp := time.Now().Format("20060102-150405")
+
+	switch strings.ToLower(format) {
+	case "", "json":
+		data, err := history.ExportJSON(records)
+		if err != nil {
+			log.WithError(err).Error("failed to export history")
+			st := status.New(codes.Internal, "failed to export history")
+			return nil, st.Err()
+		}
+		return &moviedownloader.ExportHistoryResponse{
+			Data:        data,
+			ContentType: "application/json",
+			Filename:    "pmd-history-" + stamp + ".json",
+		}, nil
+	case "csv":
+		data, err := history.ExportCSV(records)
+		if err != nil {
+			log.WithError(err).Error("failed to export history")
+			st := status.New(codes.Internal, "failed to export history")
+			return nil, st.Err()
+		}
+		return &moviedownloader.ExportHistoryResponse{
+			Data:        data,
+			ContentType: "text/csv",
+			Filename:    "pmd-history-" + stamp + ".csv",
+		}, nil
+	default:
+		st := status.New(codes.InvalidArgument, fmt.Sprintf("unsupported export format %q", format))
+		return nil, st.Err()
+	}
+}
+
+// recordHistory stores the outcome of the download in the history
+func (s *server) recordHistory(dl download.Download, path string) {
+	if err := s.history.Record(history.FromDownload(dl, path)); err != nil {
+		log.WithError(err).WithField("id", dl.ID).Error("failed to record history")
+	}
+}
+
+// purgeHistory removes the history records older than the retention period
+// once a day until the context is cancelled
+func (s *server) purgeHistory(ctx context.Context) {
+	t := time.NewTicker(24 * time.Hour)
+	defer t.Stop()
+
+	for {
+		retention := viper.GetDuration("HISTORY_RETENTION")
+		if retention <= 0 {
+			retention = defaultHistoryRetention
+		}
+
+		removed, err := s.history.Purge(time.Now().Add(-retention))
+		if err != nil {
+			log.WithError(err).Error("failed to purge history")
+		} else if removed > 0 {
+			log.WithField("removed", removed).Info("purged history")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func historyFilter(f *moviedownloader.HistoryFilter) (history.Filter, error) {
+	filter := history.Filter{}
+	if f == nil {
+		return filter, nil
+	}
+
+	var err error
+	if f.From != "" {
+		if filter.From, err = time.Parse(time.RFC3339, f.From); err != nil {
+			return filter, fmt.Errorf("invalid from time: %w", err)
+		}
+	}
+	if f.To != "" {
+		if filter.To, err = time.Parse(time.RFC3339, f.To); err != nil {
+			return filter, fmt.Errorf("invalid to time: %w", err)
+		}
+	}
+	filter.States = f.States
+	filter.Query = f.Query
+
+	return filter, nil
+}
+
+// historyExportHandler serves the history export as a file download. The
+// filter is read from the from, to, state and q query parameters.
+func (s *server) historyExportHandler(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		f := &moviedownloader.HistoryFilter{
+			From:  q.Get("from"),
+			To:    q.Get("to"),
+			Query: q.Get("q"),
+		}
+		for _, name := range q["state"] {
+			state, ok := moviedownloader.DownloadState_value["DOWNLOAD_STATE_"+strings.ToUpper(name)]
+			if !ok {
+				http.Error(w, "unknown state "+name, http.StatusBadRequest)
+				return
+			}
+			f.States = append(f.States, moviedownloader.DownloadState(state))
+		}
+
+		filter, err := historyFilter(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp, err := s.exportHistory(filter, format)
+		if err != nil {
+			http.Error(w, status.Convert(err).Message(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", resp.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+resp.Filename+`"`)
+		_, _ = w.Write(resp.Data)
+	}
+}
@@ -27,13 +27,11 @@ var (
 	grpcPort     = flag.String("grpc", "4051", "The server GRPC port")
 	downloadPath = flag.String("d", "", "The directory to save downloads")
 	mediaPath    = flag.String("media", "", "Path to where the media will be moved once completed")
+	tvPath       = flag.String("tv", "", "Path to where TV episodes will be moved once completed (defaults to the media path)")
 )
 
-func init() {
-	flag.Parse()
-}
-
 func main() {
+	flag.Parse()
 	log.SetLevel(log.DebugLevel)
 	// log.SetHandler(cli.New(os.Stdout))
 
@@ -51,8 +49,24 @@ func main() {
 		"grpc_port":     *grpcPort,
 		"download_path": viper.GetString("DOWNLOAD_PATH"),
 		"media_path":    viper.GetString("MEDIA_PATH"),
+		"tv_path":       viper.GetString("TV_PATH"),
 	}).Info("successfully loaded configuration")
 
+	// pick up the downloads that were interrupted by a restart
+	srv.recoverPartials()
+
+	// follow the series wanted list
+	go srv.watchSeries(context.Background())
+
+	// apply the history retention policy
+	go srv.purgeHistory(context.Background())
+
+	// empty the recycle bin of expired items
+	go srv.purgeRecycleBin(context.Background())
+
+	// pause and resume the queued downloads as the free disk space changes
+	go srv.watchDiskSpace(context.Background())
+
 	// start the REST proxy endpoints
 	go func() {
 		ctx := context.Background()
@@ -97,6 +111,13 @@ func main() {
 			p = path.Join("rpc", p)
 			http.ServeFile(w, r, p)
 		})
+		// add support for downloading the history export as a file
+		httpmux.HandleFunc("/history/export.csv", srv.historyExportHandler("csv"))
+		httpmux.HandleFunc("/history/export.json", srv.historyExportHandler("json"))
+		// add support for loading the search result thumbnails without the
+		// provider credentials
+		httpmux.HandleFunc("/thumbs/", srv.thumbnailHandler)
+
 		httpmux.Handle("/", mux)
 
 		log.Info("REST server listening on port :" + *port)
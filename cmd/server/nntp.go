@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/dustin/go-humanize"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/library"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/nntp"
+	"github.com/midgarco/movie_downloader/nzb"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultNNTPHost is the news server of the provider, used when
+	// NNTP_HOST is not configured
+	defaultNNTPHost = "news.easynews.com"
+
+	// defaultNNTPPort is the NNTP over TLS port, used when NNTP_PORT is not
+	// configured
+	defaultNNTPPort = 563
+)
+
+// nntpConfig returns the news server settings. The account of the HTTP
+// gateway is used unless NNTP_USERNAME is configured, and TLS is used on
+// every port but 119 unless NNTP_TLS says otherwise.
+func nntpConfig() nntp.Config {
+	host := viper.GetString("NNTP_HOST")
+	if host == "" {
+		host = defaultNNTPHost
+	}
+	port := viper.GetInt("NNTP_PORT")
+	if port <= 0 {
+		port = defaultNNTPPort
+	}
+	useTLS := port != 119
+	if viper.IsSet("NNTP_TLS") {
+		useTLS = viper.GetBool("NNTP_TLS")
+	}
+
+	cfg := nntp.Config{
+		Addr:        net.JoinHostPort(host, strconv.Itoa(port)),
+		TLS:         useTLS,
+		Username:    viper.GetString("USERNAME"),
+		Password:    viper.GetString("PASSWORD"),
+		Connections: viper.GetInt("NNTP_CONNECTIONS"),
+	}
+	if viper.GetString("NNTP_USERNAME") != "" {
+		cfg.Username = viper.GetString("NNTP_USERNAME")
+		cfg.Password = viper.GetString("NNTP_PASSWORD")
+	}
+	return cfg
+}
+
+// nntpPool returns the connection pool shared by the NNTP downloads. The
+// pool is replaced when the configuration changed; the old pool is closed
+// once the downloads still using it finished.
+func (s *server) nntpPool() *nntp.Pool {
+	s.nntpMu.Lock()
+	defer s.nntpMu.Unlock()
+
+	cfg := nntpConfig()
+	if s.nntp != nil {
+		if cfg == s.nntpConfig {
+			return s.nntp
+		}
+		s.nntp.Drain()
+	}
+	s.nntp, s.nntpConfig = nntp.NewPool(cfg), cfg
+	return s.nntp
+}
+
+// startArticles starts downloading the articles of a file imported from
+// an NZB file into the partial file. Articles the server no longer has are
+// left as holes when the set holds PAR2 files to repair them.
+func (s *server) startArticles(dl download.Download, partial string) (transfer, error) {
+	allowMissing := false
+	for _, member := range s.downloads.Set(dl.Set) {
+		if strings.EqualFold(filepath.Ext(member.Filename), ".par2") {
+			allowMissing = true
+			break
+		}
+	}
+
+	return s.nntpPool().Do(&nntp.Request{
+		Filename:     partial,
+		File:         dl.NZB,
+		AllowMissing: allowMissing,
+		BeforeCopy: func(size, completed int64) error {
+			return s.reserveSpaceFor(dl.ID, partial, size, completed)
+		},
+	})
+}
+
+// ImportNZB queues the files of the uploaded NZB file. They are downloaded
+// from the news server instead of the HTTP gateway; the files of a
+// multi-file NZB are grouped into one set.
+func (s *server) ImportNZB(ctx context.Context, req *moviedownloader.ImportNZBRequest) (*moviedownloader.DownloadResponse, error) {
+	n, err := nzb.Parse(bytes.NewReader(req.Nzb))
+	if err != nil {
+		log.WithError(err).Error("failed to parse nzb")
+		st := status.New(codes.InvalidArgument, "invalid nzb: "+err.Error())
+		return nil, st.Err()
+	}
+
+	if id, ok := s.downloads.IdempotencyKey(req.IdempotencyKey); ok {
+		log.WithFields(log.Fields{
+			"id":              id,
+			"idempotency_key": req.IdempotencyKey,
+		}).Info("download already requested")
+		return s.setResponse(id), nil
+	}
+
+	articles := map[string]*nzb.File{}
+	found := make([]movie.Movie, 0, len(n.Files))
+	for _, f := range n.Files {
+		mv := nzbMovie(f)
+		if _, ok := articles[mv.ID]; ok {
+			continue
+		}
+		articles[mv.ID] = f
+		found = append(found, *mv)
+	}
+	movie.SortVolumes(found)
+	members := make([]*movie.Movie, 0, len(found))
+	for i := range found {
+		members = append(members, &found[i])
+	}
+
+	name := req.Name
+	if name == "" {
+		name = n.Name()
+	}
+	password := req.Password
+	if password == "" {
+		password = n.Password()
+	}
+	log.WithFields(log.Fields{
+		"name":  name,
+		"files": len(members),
+	}).Info("import nzb request")
+
+	requestedBy := req.RequestedBy
+	if p, ok := peer.FromContext(ctx); ok && requestedBy == "" {
+		requestedBy = p.Addr.String()
+	}
+
+	if len(members) == 1 {
+		if reason, ok := s.inLibrary(members[0]); ok {
+			log.WithFields(log.Fields{
+				"id":     members[0].ID,
+				"reason": reason,
+			}).Warn("rejected duplicate download")
+			st := status.New(codes.AlreadyExists, reason)
+			return nil, st.Err()
+		}
+	}
+
+	if err := checkExpiry(members...); err != nil {
+		return nil, err
+	}
+	if err := s.preflight(members...); err != nil {
+		return nil, err
+	}
+
+	request := download.Request{
+		Movie:          members[0],
+		IdempotencyKey: req.IdempotencyKey,
+		RequestedBy:    requestedBy,
+		Password:       password,
+		SetName:        name,
+		NZB:            articles,
+	}
+	var (
+		queued   []download.Download
+		existing bool
+	)
+	if len(members) == 1 {
+		var dl download.Download
+		dl, existing, err = s.downloads.Add(request)
+		queued = []download.Download{dl}
+	} else {
+		queued, existing, err = s.downloads.AddSet(request, members)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"name":   name,
+			"reason": err.Error(),
+		}).Warn("rejected duplicate download")
+		st := status.New(codes.AlreadyExists, err.Error())
+		return nil, st.Err()
+	}
+	if existing {
+		log.WithFields(log.Fields{
+			"id":              queued[0].ID,
+			"idempotency_key": req.IdempotencyKey,
+		}).Info("download already requested")
+		return s.setResponse(queued[0].ID), nil
+	}
+
+	for _, dl := range queued {
+		s.publishDownload(events.DownloadQueued, dl.ID, "")
+	}
+	s.schedule()
+
+	return s.setResponse(queued[0].ID), nil
+}
+
+// nzbMovie describes a file of an NZB file the way the search results
+// describe movies. The ID is derived from the first article so importing
+// the same NZB file twice is recognised as a duplicate. Files that are not
+// videos, like the NFO, SFV and SRR files of a release, are marked as
+// volumes so they are verified by their checksum instead of as videos.
+func nzbMovie(f *nzb.File) *movie.Movie {
+	name := f.Filename()
+	ext := filepath.Ext(name)
+
+	sum := sha1.Sum([]byte(f.Segments[0].MessageID))
+	mv := &movie.Movie{
+		ID:        "nzb-" + hex.EncodeToString(sum[:8]),
+		Filename:  strings.TrimSuffix(name, ext),
+		Extension: ext,
+		Subject:   f.Subject,
+		Poster:    f.Poster,
+		RawSize:   int(f.Size()),
+		Size:      humanize.Bytes(uint64(f.Size())),
+		Volume:    !library.VideoExtensions[strings.ToLower(ext)],
+	}
+	if len(f.Groups) > 0 {
+		mv.Group = f.Groups[0]
+	}
+	if f.Date > 0 {
+		mv.PostDate = time.Unix(f.Date, 0).UTC().Format(time.DateTime)
+	}
+	detectEpisode(mv)
+	return mv
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/probe"
+	"github.com/midgarco/movie_downloader/safepath"
+	"github.com/midgarco/movie_downloader/verify"
+	"github.com/spf13/viper"
+)
+
+// defaultMaxActiveDownloads is the number of downloads that run at the same
+// time when MAX_ACTIVE_DOWNLOADS is not configured
+const defaultMaxActiveDownloads = 3
+
+// defaultMaxAttempts is the number of times a download that fails
+// verification is started before it is marked as failed, when MAX_ATTEMPTS
+// is not configured
+const defaultMaxAttempts = 3
+
+// schedule starts queued downloads while there are free download slots,
+// posts about to expire first and the others oldest first
+func (s *server) schedule() {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	max := viper.GetInt("MAX_ACTIVE_DOWNLOADS")
+	if max <= 0 {
+		max = defaultMaxActiveDownloads
+	}
+
+	if !s.checkDiskSpace() {
+		return
+	}
+
+	running := s.downloads.Running()
+	for _, dl := range prioritize(s.downloads.Queued()) {
+		if running >= max {
+			return
+		}
+
+		dl, err := s.downloads.Transition(dl.ID, download.Starting)
+		if err != nil {
+			// the download was paused or removed in the meantime
+			continue
+		}
+		running++
+
+		go s.run(dl)
+	}
+}
+
+// run downloads the file and walks the download through the state machine,
+// freeing the download slot for the next queued download when it is done
+func (s *server) run(dl download.Download) {
+	defer s.schedule()
+
+	mv := dl.Details
+	logger := log.WithFields(log.Fields{
+		"id":       dl.ID,
+		"filename": dl.Filename,
+	})
+
+	// the provider dropped the post while it was queued
+	if t, ok := expiresAt(mv); ok && !t.After(time.Now()) {
+		err := &ExpiredError{Filename: mv.Filename + mv.Extension, ExpiredAt: t}
+		logger.WithError(err).Error("post expired")
+		s.fail(dl.ID, err)
+		return
+	}
+
+	uri := dl.URL
+	if uri == "" {
+		uri = s.downloadURL(mv)
+	}
+	log.Debug(uri)
+
+	partial := s.partialFile(dl)
+
+	// setup the net transport for tls
+	var tran = &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: 5 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 5 * time.Second,
+	}
+
+	// establish the client for connection
+	var httpClient = &http.Client{
+		Transport: tran,
+	}
+
+	// remember the download next to the partial file so it can be resumed
+	// after a restart
+	if err := download.SavePartial(partial, dl); err != nil {
+		logger.WithError(err).Warn("failed to save partial download metadata")
+	}
+
+	resp, err := s.startTransfer(dl, uri, partial, httpClient)
+	if err != nil {
+		logger.WithError(err).Error("failed to start transfer")
+		s.fail(dl.ID, err)
+		return
+	}
+	s.downloads.Update(dl.ID, func(stats *download.Download) {
+		stats.Segments = resp.Segments()
+	})
+
+	logger.Info("downloading: " + mv.Filename + mv.Extension)
+	if _, err := s.downloads.Transition(dl.ID, download.Downloading); err != nil {
+		logger.WithError(err).Error("failed to start download")
+		resp.Cancel()
+		return
+	}
+	s.publishDownload(events.DownloadStarted, dl.ID, "")
+
+	// start UI loop
+	t := time.NewTicker(500 * time.Millisecond)
+	defer t.Stop()
+
+Loop:
+	for {
+		select {
+		case <-t.C:
+			s.downloads.Update(dl.ID, func(stats *download.Download) {
+				stats.BytesCompleted = resp.BytesComplete()
+				stats.BytesPerSecond = int64(resp.BytesPerSecond())
+				stats.Size = resp.Size()
+				stats.Progress = int64(100 * resp.Progress())
+			})
+
+		case <-resp.Done():
+			// download is complete
+			break Loop
+		}
+	}
+
+	// check for errors
+	if resp.Err() != nil {
+		logger.WithError(resp.Err()).Error("download failed")
+		s.fail(dl.ID, resp.Err())
+		return
+	}
+
+	s.downloads.Update(dl.ID, func(stats *download.Download) {
+		stats.Size = resp.Size()
+		if resp.IsComplete() {
+			stats.Progress = 100
+			stats.BytesCompleted = stats.Size
+		}
+	})
+
+	logger.Info("successfully downloaded: " + partial)
+
+	if _, err := s.downloads.Transition(dl.ID, download.Verifying); err != nil {
+		logger.WithError(err).Error("failed to finish download")
+		return
+	}
+
+	// make sure we did not save an error page or a truncated file
+	expected := resp.Size()
+	if expected <= 0 {
+		expected = int64(mv.RawSize)
+	}
+	verifyFile := verify.File
+	if mv.IsVolume() {
+		// archive volumes, recovery files and the NFO files of a set are
+		// not videos
+		verifyFile = verify.Checksum
+	}
+	result, err := verifyFile(partial, expected)
+	if err != nil {
+		logger.WithError(err).Error("download failed verification")
+		s.requeue(dl.ID, partial, err)
+		return
+	}
+	logger.WithFields(log.Fields{
+		"container": result.Container,
+		"sha256":    result.SHA256,
+	}).Info("download verified")
+	s.downloads.Update(dl.ID, func(stats *download.Download) {
+		stats.SHA256 = result.SHA256
+	})
+
+	// only now give the file its final name, without replacing an earlier
+	// download of the same name. The files of a set are in a folder of
+	// their own and keep their names, the archive volumes and PAR2 files
+	// are found by them.
+	target := s.downloadFile(dl)
+	if dl.Set == "" {
+		target = safepath.Unique(s.downloadPath, dl.Filename)
+	}
+	if err := download.Finalize(partial, target); err != nil {
+		logger.WithError(err).Error("failed to rename partial file")
+		s.fail(dl.ID, err)
+		return
+	}
+	s.downloads.Update(dl.ID, func(stats *download.Download) {
+		stats.Filename = filepath.Base(target)
+	})
+
+	if _, err := s.downloads.Transition(dl.ID, download.PostProcessing); err != nil {
+		logger.WithError(err).Error("failed to finish download")
+		return
+	}
+
+	// read the real stream information, the provider metadata is not
+	// always right
+	if !mv.IsVolume() {
+		s.probe(dl.ID, target)
+	}
+
+	if dl.Set != "" {
+		// the set is post-processed once every member has finished
+		s.finishSet(dl.Set)
+		return
+	}
+
+	if dl, ok := s.downloads.Get(dl.ID); ok {
+		s.complete([]download.Download{dl})
+	}
+}
+
+// probe reads the stream information of the file and compares it with
+// the metadata advertised by the provider
+func (s *server) probe(id, filename string) {
+	dl, ok := s.downloads.Get(id)
+	if !ok {
+		return
+	}
+	logger := log.WithFields(log.Fields{
+		"id":       id,
+		"filename": filename,
+	})
+
+	info, err := probe.File(filename)
+	if err != nil {
+		logger.WithError(err).Warn("failed to probe download")
+		return
+	}
+	info.Mismatches = probe.Compare(info, *dl.Details)
+	if len(info.Mismatches) > 0 {
+		logger.WithField("mismatches", info.Mismatches).Warn("download does not match the advertised metadata")
+	}
+	s.downloads.Update(id, func(stats *download.Download) {
+		stats.Media = &info
+	})
+}
+
+// requeue discards the partial file of a download that failed verification
+// and queues the download again, until MAX_ATTEMPTS is reached
+func (s *server) requeue(id, partial string, cause error) {
+	if _, err := s.downloads.Transition(id, download.Retrying); err != nil {
+		log.WithError(err).WithField("id", id).Error("failed to retry download")
+		return
+	}
+
+	// the data is corrupt, resuming from it would not help
+	if err := download.RemovePartial(partial); err != nil {
+		log.WithError(err).WithField("id", id).Warn("failed to delete partial file")
+	}
+	s.downloads.Update(id, func(stats *download.Download) {
+		stats.Error = cause.Error()
+		stats.BytesCompleted = 0
+		stats.Progress = 0
+	})
+
+	max := viper.GetInt("MAX_ATTEMPTS")
+	if max <= 0 {
+		max = defaultMaxAttempts
+	}
+	if dl, ok := s.downloads.Get(id); ok && dl.Attempts >= max {
+		s.fail(id, fmt.Errorf("giving up after %d attempts: %w", dl.Attempts, cause))
+		return
+	}
+
+	if _, err := s.downloads.Transition(id, download.Queued); err != nil {
+		log.WithError(err).WithField("id", id).Error("failed to re-queue download")
+		return
+	}
+	s.publishDownload(events.DownloadRetrying, id, cause.Error())
+}
+
+// downloadURL returns the provider URL of the movie on the selected mirror
+func (s *server) downloadURL(mv *movie.Movie) string {
+	return s.mirror().URL(mv)
+}
+
+// downloadFile returns the final path of the finished download
+func (s *server) downloadFile(dl download.Download) string {
+	return filepath.Join(download.Dir(s.downloadPath, dl), safepath.Sanitize(dl.Filename))
+}
+
+// removeSetDir deletes the folder of the set the download belongs to once
+// it is empty
+func (s *server) removeSetDir(dl download.Download) {
+	if dl.Set == "" {
+		return
+	}
+	// fails while other files of the set are still in it
+	_ = os.Remove(download.Dir(s.downloadPath, dl))
+}
+
+// partialFile returns the path the download is written to while it is in
+// progress
+func (s *server) partialFile(dl download.Download) string {
+	return download.PartialFile(s.downloadPath, dl)
+}
+
+// recoverPartials queues the partial downloads left behind by an earlier
+// run again, so they resume where they stopped, and deletes the partial
+// files that cannot be resumed
+func (s *server) recoverPartials() {
+	resume, orphans, err := download.ScanPartials(s.downloadPath)
+	if err != nil {
+		log.WithError(err).Error("failed to scan for partial downloads")
+		return
+	}
+
+	for _, filename := range orphans {
+		log.WithField("filename", filename).Warn("deleting orphaned partial file")
+		if err := download.RemovePartial(filename); err != nil {
+			log.WithError(err).WithField("filename", filename).Error("failed to delete orphaned partial file")
+		}
+	}
+
+	for _, dl := range resume {
+		if !s.downloads.Restore(dl) {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"id":       dl.ID,
+			"filename": dl.Filename,
+		}).Info("resuming partial download")
+		s.publishDownload(events.DownloadQueued, dl.ID, "")
+	}
+
+	s.schedule()
+}
+
+// fail moves the download to the failed state and records the error
+func (s *server) fail(id string, cause error) {
+	if _, err := s.downloads.Transition(id, download.Failed); err != nil {
+		log.WithError(err).WithField("id", id).Error("failed to mark download as failed")
+	}
+	s.downloads.Update(id, func(stats *download.Download) {
+		stats.Error = cause.Error()
+	})
+	s.publishDownload(events.DownloadFailed, id, cause.Error())
+
+	if dl, ok := s.downloads.Get(id); ok {
+		s.recordHistory(dl, "")
+		s.forgetEpisode(dl)
+	}
+}
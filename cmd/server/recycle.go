@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/recycle"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultRecycleRetention is how long deleted files are kept in the recycle
+// bin when RECYCLE_RETENTION is not configured
+const defaultRecycleRetention = 30 * 24 * time.Hour
+
+// Delete moves a completed download or a library file into the recycle bin
+func (s *server) Delete(ctx context.Context, req *moviedownloader.DeleteRequest) (*moviedownloader.DeleteResponse, error) {
+	log.WithFields(log.Fields{
+		"completed_id": req.CompletedId,
+		"path":         req.Path,
+	}).Info("delete request")
+
+	var (
+		item recycle.Item
+		err  error
+	)
+	switch {
+	case req.CompletedId != "" && req.Path != "":
+		st := status.New(codes.InvalidArgument, "either completed_id or path must be set, not both")
+		return nil, st.Err()
+
+	case req.CompletedId != "":
+		dl, derr := s.downloads.Discard(req.CompletedId, download.Completed)
+		if derr != nil {
+			if errors.Is(derr, download.ErrNotFound) {
+				st := status.New(codes.NotFound, "download not found")
+				return nil, st.Err()
+			}
+			st := status.New(codes.FailedPrecondition, "only completed downloads can be deleted")
+			return nil, st.Err()
+		}
+
+		item, err = s.recycle.Add(s.downloadFile(dl), recycle.Item{
+			DownloadID: dl.ID,
+			Details:    dl.Details,
+			Set:        dl.Set,
+			SetName:    dl.SetName,
+			SHA256:     dl.SHA256,
+			Media:      dl.Media,
+		})
+		if err != nil {
+			// keep the download so the client can try again
+			s.downloads.Restore(dl)
+			break
+		}
+		dl.State = download.Done
+		s.recordHistory(dl, "")
+
+	case req.Path != "":
+		if !s.library.Contains(req.Path) {
+			st := status.New(codes.PermissionDenied, "path is not inside the library")
+			return nil, st.Err()
+		}
+
+		item, err = s.recycle.Add(req.Path, recycle.Item{})
+		if err == nil {
+			s.library.Remove(req.Path)
+		}
+
+	default:
+		st := status.New(codes.InvalidArgument, "completed_id or path is required")
+		return nil, st.Err()
+	}
+
+	switch {
+	case errors.Is(err, recycle.ErrNotRegular):
+		st := status.New(codes.InvalidArgument, err.Error())
+		return nil, st.Err()
+	case errors.Is(err, fs.ErrNotExist):
+		st := status.New(codes.NotFound, "file not found")
+		return nil, st.Err()
+	case err != nil:
+		log.WithError(err).Error("failed to move file to the recycle bin")
+		st := status.New(codes.Internal, "failed to move file to the recycle bin")
+		return nil, st.Err()
+	}
+
+	s.events.Publish(events.Event{
+		Type:       events.FileDeleted,
+		DownloadID: item.DownloadID,
+		Filename:   item.OriginalPath,
+		Message:    item.ID,
+		Details:    item.Details,
+	})
+
+	return &moviedownloader.DeleteResponse{Item: item.MapToProto(s.recycleRetention())}, nil
+}
+
+// Restore moves an item out of the recycle bin to its original location. A
+// deleted completed download shows up as completed again.
+func (s *server) Restore(ctx context.Context, req *moviedownloader.RestoreRequest) (*moviedownloader.RestoreResponse, error) {
+	log.WithField("id", req.Id).Info("restore request")
+
+	item, err := s.recycle.Restore(req.Id)
+	switch {
+	case errors.Is(err, recycle.ErrNotFound):
+		st := status.New(codes.NotFound, err.Error())
+		return nil, st.Err()
+	case errors.Is(err, recycle.ErrExists):
+		st := status.New(codes.AlreadyExists, err.Error())
+		return nil, st.Err()
+	case err != nil:
+		log.WithError(err).Error("failed to restore file")
+		st := status.New(codes.Internal, "failed to restore file")
+		return nil, st.Err()
+	}
+
+	if item.DownloadID != "" {
+		now := time.Now()
+		s.downloads.Restore(download.Download{
+			ID:             item.DownloadID,
+			State:          download.Completed,
+			BytesCompleted: item.Size,
+			Size:           item.Size,
+			Progress:       100,
+			Filename:       filepath.Base(item.OriginalPath),
+			Details:        item.Details,
+			Set:            item.Set,
+			SetName:        item.SetName,
+			SHA256:         item.SHA256,
+			Media:          item.Media,
+			CreatedAt:      now,
+			FinishedAt:     now,
+		})
+	} else {
+		s.library.Add(item.OriginalPath)
+	}
+
+	s.events.Publish(events.Event{
+		Type:       events.FileRestored,
+		DownloadID: item.DownloadID,
+		Filename:   item.OriginalPath,
+		Message:    item.ID,
+		Details:    item.Details,
+	})
+
+	return &moviedownloader.RestoreResponse{Item: item.MapToProto(0)}, nil
+}
+
+// ListRecycleBin lists the items in the recycle bin, most recently deleted
+// first
+func (s *server) ListRecycleBin(ctx context.Context, req *moviedownloader.ListRecycleBinRequest) (*moviedownloader.ListRecycleBinResponse, error) {
+	retention := s.recycleRetention()
+
+	resp := &moviedownloader.ListRecycleBinResponse{}
+	for _, item := range s.recycle.List() {
+		resp.Items = append(resp.Items, item.MapToProto(retention))
+	}
+	return resp, nil
+}
+
+// purgeRecycleBin permanently deletes the recycle bin items older than the
+// retention period once an hour until the context is cancelled
+func (s *server) purgeRecycleBin(ctx context.Context) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+
+	for {
+		purged, err := s.recycle.Purge(time.Now().Add(-s.recycleRetention()))
+		if err != nil {
+			log.WithError(err).Error("failed to purge recycle bin")
+		}
+		if purged > 0 {
+			log.WithField("purged", purged).Info("purged recycle bin")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *server) recycleRetention() time.Duration {
+	retention := viper.GetDuration("RECYCLE_RETENTION")
+	if retention <= 0 {
+		retention = defaultRecycleRetention
+	}
+	return retention
+}
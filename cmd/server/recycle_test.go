@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/history"
+	"github.com/midgarco/movie_downloader/probe"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+func TestDeleteRestoreSetMember(t *testing.T) {
+	s := newTestServer(t)
+
+	dl := addDownload(t, s, "member", 100)
+	s.downloads.Update(dl.ID, func(d *download.Download) {
+		d.Set = "set1"
+		d.SetName = "Film"
+		d.SHA256 = "abc123"
+		d.Media = &probe.Info{Container: "matroska"}
+	})
+	dl = complete(t, s, dl.ID)
+
+	resp, err := s.Delete(context.Background(), &moviedownloader.DeleteRequest{CompletedId: dl.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.downloads.Get(dl.ID); ok {
+		t.Fatal("the deleted download is still known")
+	}
+	records, _ := s.history.List(history.Filter{}, 0, 10)
+	if len(records) != 1 || records[0].ID != dl.ID || records[0].State != download.Done {
+		t.Fatalf("history = %+v, want the deleted download", records)
+	}
+
+	if _, err := s.Restore(context.Background(), &moviedownloader.RestoreRequest{Id: resp.Item.Id}); err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := s.downloads.Get(dl.ID)
+	if !ok {
+		t.Fatal("the download was not restored")
+	}
+	if restored.Set != dl.Set || restored.SetName != dl.SetName || restored.SHA256 != dl.SHA256 || restored.Media == nil || restored.Media.Container != "matroska" {
+		t.Fatalf("restored %+v, want the fields of %+v", restored, dl)
+	}
+	if _, err := os.Stat(s.downloadFile(restored)); err != nil {
+		t.Fatalf("the restored file is not where the download expects it: %v", err)
+	}
+}
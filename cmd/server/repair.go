@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/par2"
+	"github.com/midgarco/movie_downloader/verify"
+)
+
+const (
+	// stepVerifying is the post-processing step of downloads whose files are
+	// checked against the PAR2 hashes of their set
+	stepVerifying = "verifying"
+
+	// stepRepairing is the post-processing step of downloads whose damaged
+	// files are rebuilt from the PAR2 recovery slices
+	stepRepairing = "repairing"
+)
+
+// repair verifies the downloaded files against the PAR2 files among them
+// and repairs damaged files when there are enough recovery slices. The
+// result is recorded on every download. Unreadable PAR2 files are skipped
+// so extraction can still be attempted.
+func (s *server) repair(members []download.Download) error {
+	pars, files := []string{}, []string{}
+	for _, dl := range members {
+		if strings.EqualFold(filepath.Ext(dl.Filename), ".par2") {
+			pars = append(pars, s.downloadFile(dl))
+		} else {
+			files = append(files, s.downloadFile(dl))
+		}
+	}
+	if len(pars) == 0 {
+		return nil
+	}
+
+	logger := log.WithFields(log.Fields{
+		"id":   members[0].ID,
+		"par2": len(pars),
+	})
+
+	set, err := par2.Open(pars...)
+	if err != nil {
+		logger.WithError(err).Warn("failed to read par2 files, skipping verification")
+		return nil
+	}
+
+	setStep := func(step string) func(done, total int64) {
+		return func(done, total int64) {
+			if total <= 0 {
+				return
+			}
+			for _, dl := range members {
+				s.downloads.Update(dl.ID, func(stats *download.Download) {
+					stats.Step = step
+					stats.StepProgress = 100 * done / total
+				})
+			}
+		}
+	}
+	setStep(stepVerifying)(0, 1)
+
+	v, err := set.Verify(context.Background(), download.Dir(s.downloadPath, members[0]), files, setStep(stepVerifying))
+	if err != nil {
+		logger.WithError(err).Warn("failed to verify the files against the par2 files")
+		return nil
+	}
+
+	if v.Damaged() && v.Repairable() {
+		logger.WithFields(log.Fields{
+			"damaged_files":   v.Result().DamagedFiles,
+			"damaged_slices":  v.Result().DamagedSlices,
+			"recovery_slices": v.Result().RecoverySlices,
+		}).Warn("damaged files, repairing")
+
+		setStep(stepRepairing)(0, 1)
+		err = v.Repair(context.Background(), setStep(stepRepairing))
+	} else if v.Damaged() {
+		err = par2.ErrNotEnoughRecovery
+	}
+
+	result := v.Result()
+	for _, dl := range members {
+		s.downloads.Update(dl.ID, func(stats *download.Download) {
+			stats.Repair = &result
+			stats.Step = ""
+			stats.StepProgress = 0
+		})
+	}
+	if err != nil {
+		logger.WithError(err).WithField("damaged_files", result.DamagedFiles).Error("failed to repair damaged files")
+		if errors.Is(err, par2.ErrNotEnoughRecovery) {
+			return fmt.Errorf("%d damaged slices in %s, only %d recovery slices available", result.DamagedSlices, strings.Join(result.DamagedFiles, ", "), result.RecoverySlices)
+		}
+		return err
+	}
+
+	if result.Status == par2.Repaired {
+		// the repaired files no longer match the recorded checksums
+		repaired := map[string]bool{}
+		for _, path := range v.DamagedPaths() {
+			repaired[path] = true
+		}
+		for _, dl := range members {
+			if !repaired[s.downloadFile(dl)] {
+				continue
+			}
+			checked, err := verify.Checksum(s.downloadFile(dl), 0)
+			if err != nil {
+				continue
+			}
+			s.downloads.Update(dl.ID, func(stats *download.Download) {
+				stats.SHA256 = checked.SHA256
+			})
+		}
+	}
+	logger.WithField("status", result.Status).Info("par2 verification finished")
+	return nil
+}
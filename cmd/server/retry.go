@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retry re-queues a failed download. The partial file is kept so the
+// download resumes where it stopped, unless a different release of the same
+// title is requested.
+func (s *server) Retry(ctx context.Context, req *moviedownloader.RetryRequest) (*moviedownloader.RetryResponse, error) {
+	logger := log.WithField("id", req.Id)
+	logger.Info("retry request")
+
+	dl, ok := s.downloads.Get(req.Id)
+	if !ok {
+		st := status.New(codes.NotFound, "download not found")
+		return nil, st.Err()
+	}
+	if dl.State != download.Failed {
+		st := status.New(codes.FailedPrecondition, "only failed downloads can be retried")
+		return nil, st.Err()
+	}
+
+	uri := req.Url
+	if req.UseFallback {
+		uri = dl.Details.FallbackURL
+		if uri == "" {
+			st := status.New(codes.FailedPrecondition, "movie has no fallback url")
+			return nil, st.Err()
+		}
+	}
+	if uri != "" && !s.allowedURL(dl, uri) {
+		logger.WithField("url", uri).Warn("rejected retry url")
+		st := status.New(codes.InvalidArgument, "url is not a download url of the movie or the provider mirror")
+		return nil, st.Err()
+	}
+
+	var release *movie.Movie
+	if req.Movie != nil {
+		mv, err := movie.MapFromProtoObject(req.Movie)
+		if err != nil {
+			logger.WithError(err).Error("failed to map proto object")
+			st := status.New(codes.Internal, "failed to map proto object")
+			return nil, st.Err()
+		}
+		if mv.ID == "" || mv.Extension == "" || mv.Filename == "" {
+			st := status.New(codes.FailedPrecondition, "malformed movie data")
+			return nil, st.Err()
+		}
+		if mv.Virus {
+			st := status.New(codes.FailedPrecondition, "movie contains virus")
+			return nil, st.Err()
+		}
+		if mv.Title() != dl.Details.Title() {
+			st := status.New(codes.InvalidArgument, "release is not the same title")
+			return nil, st.Err()
+		}
+		if mv.ID != dl.Details.ID {
+			release = mv
+		}
+	}
+
+	filename := dl.Filename
+	if release != nil {
+		filename = s.downloads.UniqueFilename(download.FilenameOf(release), dl.ID)
+
+		// the partial data belongs to the old release
+		if err := download.RemovePartial(s.partialFile(dl)); err != nil {
+			logger.WithError(err).Warn("failed to delete partial file")
+		}
+		s.removeSetDir(dl)
+	}
+
+	s.downloads.Update(dl.ID, func(d *download.Download) {
+		d.URL = uri
+		d.Error = ""
+		if release != nil {
+			d.Details = release
+			d.NZB = nil
+			d.Filename = filename
+			d.BytesCompleted = 0
+			d.Size = 0
+			d.Progress = 0
+		}
+	})
+
+	dl, err := s.downloads.Transition(dl.ID, download.Queued)
+	if err != nil {
+		logger.WithError(err).Error("failed to re-queue download")
+		st := status.New(codes.FailedPrecondition, err.Error())
+		return nil, st.Err()
+	}
+
+	s.publishDownload(events.DownloadRetrying, dl.ID, uri)
+	s.schedule()
+
+	return &moviedownloader.RetryResponse{Download: dl.MapToProto()}, nil
+}
+
+// allowedURL returns whether the download may be fetched from the URL. The
+// provider credentials are sent along, so only the URLs the provider gave
+// for the movie and URLs on the advertised mirror are accepted.
+func (s *server) allowedURL(dl download.Download, uri string) bool {
+	if dl.Details != nil && (uri == dl.Details.PrimaryURL || uri == dl.Details.FallbackURL) {
+		return true
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	mirror, err := url.Parse(s.mirror().BaseURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), mirror.Hostname())
+}
+
+// Remove dismisses a download that is not in progress and optionally
+// deletes its partial data
+func (s *server) Remove(ctx context.Context, req *moviedownloader.RemoveRequest) (*moviedownloader.Empty, error) {
+	logger := log.WithFields(log.Fields{
+		"id":          req.Id,
+		"delete_data": req.DeleteData,
+	})
+	logger.Info("remove request")
+
+	dl, err := s.downloads.Discard(req.Id, download.Queued, download.Paused, download.Failed)
+	if err != nil {
+		if errors.Is(err, download.ErrNotFound) {
+			st := status.New(codes.NotFound, "download not found")
+			return nil, st.Err()
+		}
+		st := status.New(codes.FailedPrecondition, "only queued, paused or failed downloads can be removed")
+		return nil, st.Err()
+	}
+
+	if req.DeleteData {
+		if err := download.RemovePartial(s.partialFile(dl)); err != nil {
+			logger.WithError(err).Warn("failed to delete partial file")
+		}
+		s.removeSetDir(dl)
+	} else if err := download.ForgetPartial(s.partialFile(dl)); err != nil {
+		logger.WithError(err).Warn("failed to delete partial download metadata")
+	}
+
+	s.forgetEpisode(dl)
+
+	s.events.Publish(events.Event{
+		Type:       events.DownloadRemoved,
+		DownloadID: dl.ID,
+		Filename:   dl.Filename,
+		Details:    dl.Details,
+	})
+
+	// the rest of the set may have been waiting for the removed member
+	if dl.Set != "" {
+		go s.finishSet(dl.Set)
+	}
+
+	return &moviedownloader.Empty{}, nil
+}
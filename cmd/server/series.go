@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/series"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultSeriesInterval is how often the followed shows are searched for new
+// episodes when SERIES_INTERVAL is not configured
+const defaultSeriesInterval = 30 * time.Minute
+
+// FollowSeries ...
+func (s *server) FollowSeries(ctx context.Context, req *moviedownloader.FollowSeriesRequest) (*moviedownloader.Series, error) {
+	log.WithField("show", req.Show).Info("follow series request")
+
+	if strings.TrimSpace(req.Show) == "" {
+		st := status.New(codes.InvalidArgument, "show is required")
+		return nil, st.Err()
+	}
+
+	followed, err := s.wanted.Follow(req.Show, req.Quality, int(req.FromSeason))
+	if err != nil {
+		log.WithError(err).Error("failed to save wanted list")
+		st := status.New(codes.Internal, "failed to save wanted list")
+		return nil, st.Err()
+	}
+
+	// look for episodes right away instead of waiting for the next check
+	go s.checkSeries(followed)
+
+	return followed.MapToProto(), nil
+}
+
+// UnfollowSeries ...
+func (s *server) UnfollowSeries(ctx context.Context, req *moviedownloader.UnfollowSeriesRequest) (*moviedownloader.Empty, error) {
+	log.WithField("show", req.Show).Info("unfollow series request")
+
+	if err := s.wanted.Unfollow(req.Show); err != nil {
+		if err == series.ErrNotFound {
+			st := status.New(codes.NotFound, "series is not followed")
+			return nil, st.Err()
+		}
+		log.WithError(err).Error("failed to save wanted list")
+		st := status.New(codes.Internal, "failed to save wanted list")
+		return nil, st.Err()
+	}
+
+	return &moviedownloader.Empty{}, nil
+}
+
+// ListSeries ...
+func (s *server) ListSeries(ctx context.Context, req *moviedownloader.ListSeriesRequest) (*moviedownloader.ListSeriesResponse, error) {
+	resp := &moviedownloader.ListSeriesResponse{}
+	for _, followed := range s.wanted.List() {
+		resp.Series = append(resp.Series, followed.MapToProto())
+	}
+	return resp, nil
+}
+
+// watchSeries periodically searches for new episodes of the followed shows
+// until the context is cancelled
+func (s *server) watchSeries(ctx context.Context) {
+	interval := viper.GetDuration("SERIES_INTERVAL")
+	if interval <= 0 {
+		interval = defaultSeriesInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		for _, followed := range s.wanted.List() {
+			s.checkSeries(followed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// checkSeries searches for the show and queues every wanted episode that
+// has not been grabbed yet
+func (s *server) checkSeries(followed series.Series) {
+	logger := log.WithField("show", followed.Show)
+
+	results, err := s.search(followed.Show)
+	if err != nil {
+		logger.WithError(err).Error("failed to search for series")
+		return
+	}
+
+	for _, mv := range results.Movies {
+		if mv.Virus {
+			continue
+		}
+		if t, ok := expiresAt(&mv); ok && !t.After(time.Now()) {
+			continue
+		}
+
+		ep, ok := movie.ParseEpisode(mv.Filename)
+		if !ok || !followed.Matches(mv, ep) {
+			continue
+		}
+		mv.EpisodeInfo = ep
+
+		logger.WithFields(log.Fields{
+			"episode":  ep.Key(),
+			"filename": mv.Filename,
+		}).Info("found wanted episode")
+
+		// an episode that is already downloading or downloaded was grabbed
+		_, err := s.Download(context.Background(), &moviedownloader.DownloadRequest{Movie: mv.MapToProto()})
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			logger.WithError(err).Error("failed to queue wanted episode")
+			continue
+		}
+
+		if err := s.wanted.MarkGrabbed(followed.Show, ep.Key()); err != nil {
+			logger.WithError(err).Error("failed to save wanted list")
+		}
+		followed.Grabbed = append(followed.Grabbed, ep.Key())
+	}
+
+	if err := s.wanted.MarkChecked(followed.Show, time.Now()); err != nil && err != series.ErrNotFound {
+		logger.WithError(err).Error("failed to save wanted list")
+	}
+}
+
+// forgetEpisode clears the grabbed mark of the episode when its download
+// failed or was removed, so the next check looks for another release
+func (s *server) forgetEpisode(dl download.Download) {
+	if dl.Details == nil {
+		return
+	}
+	ep, ok := dl.Details.Episode()
+	if !ok {
+		return
+	}
+
+	err := s.wanted.UnmarkGrabbed(ep.Show, ep.Key())
+	if err != nil && err != series.ErrNotFound {
+		log.WithError(err).WithField("show", ep.Show).Error("failed to save wanted list")
+	}
+}
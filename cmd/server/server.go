@@ -14,14 +14,24 @@ import (
 	"time"
 
 	"github.com/apex/log"
-	"github.com/cavaliergopher/grab/v3"
+	"github.com/fsnotify/fsnotify"
 	"github.com/midgarco/movie_downloader/config"
 	"github.com/midgarco/movie_downloader/cookiejar"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/history"
+	"github.com/midgarco/movie_downloader/library"
 	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/nntp"
+	"github.com/midgarco/movie_downloader/recycle"
 	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/safepath"
 	"github.com/midgarco/movie_downloader/search"
+	"github.com/midgarco/movie_downloader/series"
+	"github.com/midgarco/movie_downloader/thumbcache"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -30,37 +40,44 @@ type server struct {
 	Version string
 	Build   string
 
-	downloadPath        string
-	mediaPath           string
-	searchUrlTemplate   string
-	downloadUrlTemplate string
-
-	mu                 sync.Mutex
-	activeDownloads    map[int32]*Download
-	completedDownloads map[int32]*Download
-	downloadCount      int32
+	downloadPath      string
+	mediaPath         string
+	tvPath            string
+	searchUrlTemplate string
+
+	mirrorMu   sync.RWMutex
+	advertised mirror
+	thumbs     movie.Thumbnails
+
+	downloads  *download.Manager
+	scheduleMu sync.Mutex
+	events     *events.Bus
+	wanted     *series.WantedList
+	library    *library.Index
+	history    *history.Store
+	recycle    *recycle.Bin
+	thumbCache *thumbcache.Cache
+
+	setMu          sync.Mutex
+	processingSets map[string]bool
+
+	nntpMu     sync.Mutex
+	nntp       *nntp.Pool
+	nntpConfig nntp.Config
 }
 
 type Options struct{}
 
-type Download struct {
-	index int32
-
-	BytesPerSecond int64
-	BytesCompleted int64
-	Size           int64
-	Progress       int64
-	Filename       string
-	Details        *movie.Movie
-	Error          string
-}
+// defaultProgressInterval is the minimum time between two progress updates
+// when PROGRESS_INTERVAL is not configured
+const defaultProgressInterval = time.Second
 
 var srv *server = &server{
-	searchUrlTemplate:   "https://members.easynews.com/2.0/search/solr-search/?fly=2&gps=%s&pby=100&pno=1&s1=dtime&s1d=-&s2=nrfile&s2d=-&s3=dsize&s3d=-&sS=0&d1t=&d2t=&b1t=&b2t=&px1t=&px2t=&fps1t=&fps2t=&bps1t=&bps2t=&hz1t=&hz2t=&rn1t=&rn2t=&fty[]=VIDEO&u=1&sc=1&st=adv&safeO=0&sb=1",
-	downloadUrlTemplate: "https://members.easynews.com/dl/auto/80/%s%s/%s%[2]s",
-	activeDownloads:     map[int32]*Download{},
-	completedDownloads:  map[int32]*Download{},
-	downloadCount:       0,
+	searchUrlTemplate: "https://members.easynews.com/2.0/search/solr-search/?fly=2&gps=%s&pby=100&pno=1&s1=dtime&s1d=-&s2=nrfile&s2d=-&s3=dsize&s3d=-&sS=0&d1t=&d2t=&b1t=&b2t=&px1t=&px2t=&fps1t=&fps2t=&bps1t=&bps2t=&hz1t=&hz2t=&rn1t=&rn2t=&fty[]=VIDEO&u=1&sc=1&st=adv&safeO=0&sb=1",
+	advertised:        defaultMirror,
+	thumbs:            movie.DefaultThumbnails,
+	downloads:         download.NewManager(),
+	processingSets:    map[string]bool{},
 }
 
 // LoadConfig loads the configuration file into the server. If the files
@@ -115,8 +132,63 @@ func (s *server) LoadConfig(opts *Options) error {
 		log.WithError(err).Error("failed to write config file")
 	}
 
+	if *tvPath != "" {
+		viper.Set("TV_PATH", *tvPath)
+	}
+	if viper.GetString("TV_PATH") == "" {
+		viper.SetDefault("TV_PATH", viper.GetString("MEDIA_PATH"))
+	}
+
 	s.downloadPath = viper.GetString("DOWNLOAD_PATH")
 	s.mediaPath = viper.GetString("MEDIA_PATH")
+	s.tvPath = viper.GetString("TV_PATH")
+	s.library = library.New(time.Minute, s.mediaPath, s.tvPath)
+	s.events = events.NewBus(viper.GetInt("EVENT_HISTORY"))
+
+	// load the series wanted list
+	wanted, err := series.Load(filepath.Join(path.Dir(*configFile), "series.json"))
+	if err != nil {
+		return err
+	}
+	s.wanted = wanted
+
+	// load the download history
+	hist, err := history.Open(filepath.Join(path.Dir(*configFile), "history.jsonl"))
+	if err != nil {
+		return err
+	}
+	s.history = hist
+
+	// open the recycle bin for deleted downloads and library files
+	if viper.GetString("RECYCLE_PATH") == "" {
+		viper.SetDefault("RECYCLE_PATH", filepath.Join(s.downloadPath, ".recycle"))
+	}
+	bin, err := recycle.Open(viper.GetString("RECYCLE_PATH"), filepath.Join(path.Dir(*configFile), "recycle.json"))
+	if err != nil {
+		return err
+	}
+	s.recycle = bin
+
+	// cache the thumbnails of the search results for the clients
+	if viper.GetString("THUMBNAIL_CACHE_PATH") == "" {
+		viper.SetDefault("THUMBNAIL_CACHE_PATH", filepath.Join(path.Dir(*configFile), "thumbs"))
+	}
+	viper.SetDefault("THUMBNAIL_CACHE_SIZE", defaultThumbnailCacheSize)
+	thumbs, err := thumbcache.Open(viper.GetString("THUMBNAIL_CACHE_PATH"), int64(viper.GetSizeInBytes("THUMBNAIL_CACHE_SIZE")))
+	if err != nil {
+		return err
+	}
+	s.thumbCache = thumbs
+
+	// let the clients know when the configuration file is edited
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		log.WithField("file", e.Name).Info("configuration changed")
+		s.events.Publish(events.Event{
+			Type:    events.ConfigChanged,
+			Message: e.Name,
+		})
+	})
+	viper.WatchConfig()
 
 	return nil
 }
@@ -125,8 +197,6 @@ func (s *server) LoadConfig(opts *Options) error {
 func (s *server) Search(ctx context.Context, req *moviedownloader.SearchRequest) (*moviedownloader.SearchResponse, error) {
 	log.Info("search: " + req.Query)
 
-	uri := fmt.Sprintf(s.searchUrlTemplate, url.QueryEscape(req.Query))
-
 	resp := &moviedownloader.SearchResponse{}
 
 	defer func(resp *moviedownloader.SearchResponse) {
@@ -140,6 +210,37 @@ func (s *server) Search(ctx context.Context, req *moviedownloader.SearchRequest)
 		}).Info("search response")
 	}(resp)
 
+	results, err := s.search(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	// format results for the response
+	resp.Results = results.MapToProto()
+
+	s.events.Publish(events.Event{
+		Type:    events.SearchPerformed,
+		Message: req.Query,
+		Results: len(results.Movies),
+	})
+
+	// flag the results that are already downloading or in the library and
+	// tell how long the provider keeps them
+	now := time.Now()
+	for i, mv := range results.Movies {
+		if _, ok := s.duplicateOf(&mv); ok {
+			resp.Results.Movies[i].AlreadyHave = true
+		}
+		describeRetention(resp.Results.Movies[i], &mv, now)
+	}
+
+	return resp, nil
+}
+
+// search queries the provider and decodes the results
+func (s *server) search(query string) (*search.Results, error) {
+	uri := fmt.Sprintf(s.searchUrlTemplate, url.QueryEscape(query))
+
 	// setup the net transport for tls
 	var tran = &http.Transport{
 		Dial: (&net.Dialer{
@@ -191,15 +292,21 @@ func (s *server) Search(ctx context.Context, req *moviedownloader.SearchRequest)
 		st := status.New(codes.Internal, "decoding search response")
 		return nil, st.Err()
 	}
+	s.advertise(results)
 
-	// format results for the response
-	resp.Results = results.MapToProto()
+	thumbs := s.thumbnails()
+	for i := range results.Movies {
+		if thumbs.URL(results.Movies[i]) != "" {
+			results.Movies[i].ThumbnailURL = thumbnailPath(results.Movies[i])
+		}
+		detectEpisode(&results.Movies[i])
+	}
 
-	return resp, nil
+	return results, nil
 }
 
 // Download ...
-func (s *server) Download(ctx context.Context, req *moviedownloader.DownloadRequest) (*moviedownloader.Empty, error) {
+func (s *server) Download(ctx context.Context, req *moviedownloader.DownloadRequest) (*moviedownloader.DownloadResponse, error) {
 	mv, err := movie.MapFromProtoObject(req.Movie)
 	if err != nil {
 		log.WithError(err).Error("failed to map proto object")
@@ -207,6 +314,7 @@ func (s *server) Download(ctx context.Context, req *moviedownloader.DownloadRequ
 		return nil, st.Err()
 	}
 	log.WithField("id", mv.ID).Info("download request")
+	detectEpisode(mv)
 
 	if mv.Virus {
 		log.Error("attempted movie contains a virus")
@@ -220,143 +328,189 @@ func (s *server) Download(ctx context.Context, req *moviedownloader.DownloadRequ
 		return nil, st.Err()
 	}
 
-	uri := fmt.Sprintf(s.downloadUrlTemplate, mv.ID, mv.Extension, mv.Filename)
-	log.Debug(uri)
+	if id, ok := s.downloads.IdempotencyKey(req.IdempotencyKey); ok {
+		log.WithFields(log.Fields{
+			"id":              id,
+			"idempotency_key": req.IdempotencyKey,
+		}).Info("download already requested")
+		return &moviedownloader.DownloadResponse{Id: id}, nil
+	}
 
-	request, err := grab.NewRequest(".", uri)
-	if err != nil {
-		log.WithError(err).Error("creating grab request")
-		st := status.New(codes.Internal, "failed grab request")
+	if err := checkExpiry(mv); err != nil {
+		return nil, err
+	}
+
+	if reason, ok := s.inLibrary(mv); ok {
+		log.WithFields(log.Fields{
+			"id":     mv.ID,
+			"reason": reason,
+		}).Warn("rejected duplicate download")
+		st := status.New(codes.AlreadyExists, reason)
 		return nil, st.Err()
 	}
 
-	request.HTTPRequest.SetBasicAuth(viper.GetString("USERNAME"), viper.GetString("PASSWORD"))
-	request.Filename = filepath.Join(s.downloadPath, mv.Filename+mv.Extension)
+	requestedBy := req.RequestedBy
+	if p, ok := peer.FromContext(ctx); ok && requestedBy == "" {
+		requestedBy = p.Addr.String()
+	}
 
-	// setup the net transport for tls
-	var tran = &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: 5 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 5 * time.Second,
+	if req.Set {
+		return s.downloadSet(req, mv, requestedBy)
 	}
 
-	// establish the client for connection
-	var httpClient = &http.Client{
-		Transport: tran,
+	if err := s.preflight(mv); err != nil {
+		return nil, err
 	}
 
-	client := grab.Client{
-		HTTPClient: httpClient,
-		UserAgent:  "grab",
+	dl, existing, err := s.downloads.Add(download.Request{
+		Movie:          mv,
+		IdempotencyKey: req.IdempotencyKey,
+		RequestedBy:    requestedBy,
+		Segments:       int(req.Segments),
+		Password:       req.Password,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"id":     mv.ID,
+			"reason": err.Error(),
+		}).Warn("rejected duplicate download")
+		st := status.New(codes.AlreadyExists, err.Error())
+		return nil, st.Err()
+	}
+	if existing {
+		log.WithFields(log.Fields{
+			"id":              dl.ID,
+			"idempotency_key": req.IdempotencyKey,
+		}).Info("download already requested")
+		return &moviedownloader.DownloadResponse{Id: dl.ID}, nil
 	}
 
-	s.downloadCount++
-	dl := &Download{
-		Filename: mv.Filename + mv.Extension,
-		Details:  mv,
-		index:    s.downloadCount,
+	s.publishDownload(events.DownloadQueued, dl.ID, "")
+	s.schedule()
+
+	if wantSidecars(req.Sidecars) {
+		go s.saveSidecars(dl)
 	}
-	s.activeDownloads[s.downloadCount] = dl
 
-	go func(mv *movie.Movie, stats *Download) {
-		resp := client.Do(request)
+	return &moviedownloader.DownloadResponse{Id: dl.ID}, nil
+}
 
-		log.Info("downloading: " + mv.Filename + mv.Extension)
+// Progress streams one snapshot of every download followed by deltas of
+// the downloads that changed, no more often than the minimum interval
+func (s *server) Progress(req *moviedownloader.ProgressRequest, stream moviedownloader.MovieDownloaderService_ProgressServer) error {
+	log.Info("starting progress stream")
 
-		// start UI loop
-		t := time.NewTicker(500 * time.Millisecond)
-		defer t.Stop()
+	interval := viper.GetDuration("PROGRESS_INTERVAL")
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	if requested := time.Duration(req.MinIntervalMs) * time.Millisecond; requested > interval {
+		interval = requested
+	}
 
-	Loop:
-		for {
-			select {
-			case <-t.C:
-				stats.BytesCompleted = resp.BytesComplete()
-				stats.BytesPerSecond = int64(resp.BytesPerSecond())
-				stats.Size = resp.Size()
-				stats.Progress = int64(100 * resp.Progress())
-
-			case <-resp.Done:
-				// download is complete
-				break Loop
-			}
-		}
+	// subscribe before taking the snapshot so no change can fall in between
+	sub := s.downloads.Subscribe()
+	defer sub.Close()
+
+	// the details are only sent the first time a download is seen
+	sent := map[string]bool{}
+	// the set of every download that was sent, so the set progress is
+	// updated when a member is removed
+	setOf := map[string]string{}
+
+	active, completed := s.downloads.Snapshot()
+	downloads := map[string]*moviedownloader.Progress{}
+	sets := []string{}
+	// show the list of active downloads
+	for id, dl := range active {
+		downloads[id] = dl.MapToProto()
+		sent[id] = true
+		setOf[id] = dl.Set
+		sets = append(sets, dl.Set)
+	}
+	// show the list of completed downloads
+	for id, dl := range completed {
+		downloads[id] = dl.MapToProto()
+		sent[id] = true
+		setOf[id] = dl.Set
+		sets = append(sets, dl.Set)
+	}
+	if err := sendProgress(stream, &moviedownloader.ProgressResponse{
+		ActiveDownloads: downloads,
+		Snapshot:        true,
+		Sets:            s.setsOf(sets),
+	}); err != nil {
+		return err
+	}
 
-		// check for errors
-		if resp.Err() != nil {
-			log.WithError(resp.Err()).Error("download failed")
-			stats.Error = resp.Err().Error()
-			return
+	last := time.Now()
+	for {
+		select {
+		case <-stream.Context().Done():
+			log.Info("stream closed")
+			return nil
+		case <-sub.C():
 		}
 
-		if resp.IsComplete() {
-			stats.Progress = 100
-			stats.BytesCompleted = stats.Size
+		// rate limit the updates, letting changes accumulate meanwhile
+		if wait := interval - time.Since(last); wait > 0 {
+			select {
+			case <-stream.Context().Done():
+				log.Info("stream closed")
+				return nil
+			case <-time.After(wait):
+			}
 		}
 
-		log.Info("successfully downloaded: " + resp.Filename)
-
-		s.mu.Lock()
-		delete(s.activeDownloads, stats.index)
-		s.completedDownloads[stats.index] = stats
-		s.mu.Unlock()
-	}(mv, dl)
-
-	return &moviedownloader.Empty{}, nil
-}
-
-// Progress ...
-func (s *server) Progress(req *moviedownloader.ProgressRequest, stream moviedownloader.MovieDownloaderService_ProgressServer) error {
-	log.Info("starting progress stream")
-
-	go func() {
-		for {
-			downloads := map[int32]*moviedownloader.Progress{}
-			// show the list of active downloads
-			for id, dl := range s.activeDownloads {
-				downloads[id] = &moviedownloader.Progress{
-					BytesPerSecond: dl.BytesPerSecond,
-					BytesCompleted: dl.BytesCompleted,
-					Size:           dl.Size,
-					Progress:       dl.Progress,
-					Filename:       dl.Filename,
-					Error:          dl.Error,
-					Details:        dl.Details.MapToProto(),
-				}
-			}
-			// show the list of completed downloads
-			for id, dl := range s.completedDownloads {
-				downloads[id] = &moviedownloader.Progress{
-					BytesPerSecond: dl.BytesPerSecond,
-					BytesCompleted: dl.BytesCompleted,
-					Size:           dl.Size,
-					Progress:       dl.Progress,
-					Filename:       dl.Filename,
-					Error:          dl.Error,
-					Details:        dl.Details.MapToProto(),
+		resp := &moviedownloader.ProgressResponse{
+			ActiveDownloads: map[string]*moviedownloader.Progress{},
+		}
+		sets := []string{}
+		for _, id := range sub.Changed() {
+			dl, ok := s.downloads.Get(id)
+			if !ok {
+				if sent[id] {
+					resp.Removed = append(resp.Removed, id)
+					sets = append(sets, setOf[id])
+					delete(sent, id)
+					delete(setOf, id)
 				}
+				continue
 			}
-			resp := &moviedownloader.ProgressResponse{
-				ActiveDownloads: downloads,
-			}
-
-			if err := stream.Send(resp); err != nil {
-				if status.Code(err) == codes.Unavailable {
-					log.Info("stream closed")
-					return
-				}
+			setOf[id] = dl.Set
+			sets = append(sets, dl.Set)
 
-				log.WithError(err).Error("failed to stream progress")
-				return
+			p := dl.MapToProto()
+			if sent[id] {
+				p.Details = nil
 			}
+			resp.ActiveDownloads[id] = p
+			sent[id] = true
+		}
+		if len(resp.ActiveDownloads) == 0 && len(resp.Removed) == 0 {
+			continue
+		}
+		resp.Sets = s.setsOf(sets)
 
-			time.Sleep(time.Second * 1)
+		if err := sendProgress(stream, resp); err != nil {
+			return err
 		}
-	}()
+		last = time.Now()
+	}
+}
 
-	<-stream.Context().Done()
+// sendProgress sends the response, treating a closed stream as a normal end
+// of the subscription
+func sendProgress(stream moviedownloader.MovieDownloaderService_ProgressServer, resp *moviedownloader.ProgressResponse) error {
+	if err := stream.Send(resp); err != nil {
+		if status.Code(err) == codes.Unavailable || status.Code(err) == codes.Canceled {
+			log.Info("stream closed")
+			return nil
+		}
 
+		log.WithError(err).Error("failed to stream progress")
+		return err
+	}
 	return nil
 }
 
@@ -367,7 +521,7 @@ func (s *server) Completed(ctx context.Context, req *moviedownloader.CompletedRe
 	}).Info("completed request")
 
 	resp := &moviedownloader.CompletedResponse{
-		Completed: map[int32]*moviedownloader.Progress{},
+		Completed: map[string]*moviedownloader.Progress{},
 	}
 	defer func(resp *moviedownloader.CompletedResponse) {
 		log.WithFields(log.Fields{
@@ -376,41 +530,102 @@ func (s *server) Completed(ctx context.Context, req *moviedownloader.CompletedRe
 	}(resp)
 
 	// move the requested download to the media folder
-	if req != nil && req.CompletedId > 0 {
-		mv, ok := s.completedDownloads[req.CompletedId]
-		if ok {
-			filename := filepath.Join(s.downloadPath, mv.Filename)
-			destfile := filepath.Join(s.mediaPath, mv.Filename)
+	if req != nil && req.CompletedId != "" {
+		mv, err := s.downloads.Transition(req.CompletedId, download.Moving)
+		if err == nil {
+			filename := s.downloadFile(mv)
+			destdir, err := s.libraryPath(mv)
+			if err != nil {
+				log.WithError(err).Warn("invalid library folder, using the media path")
+				destdir = s.mediaPath
+			}
+			// never replace a file that is already in the library
+			destfile := safepath.Unique(destdir, mv.Filename)
 
 			log.WithFields(log.Fields{
 				"filename":    filename,
 				"destination": destfile,
 			}).Info("move the file")
 
+			if err := os.MkdirAll(destdir, 0755); err != nil {
+				log.WithError(err).Error("failed to create library folder")
+			}
 			if err := os.Rename(filename, destfile); err != nil {
 				log.WithError(err).Error("failed to move file")
+				if _, err := s.downloads.Transition(mv.ID, download.Completed); err != nil {
+					log.WithError(err).Error("failed to restore completed download")
+				}
+			} else {
+				s.library.Add(destfile)
+				s.moveSidecars(mv, destfile)
+				s.removeSetDir(mv)
+				done, err := s.downloads.Transition(mv.ID, download.Done)
+				if err != nil {
+					log.WithError(err).Error("failed to finish download")
+				}
+				s.recordHistory(done, destfile)
+				s.downloads.Remove(mv.ID)
+				s.events.Publish(events.Event{
+					Type:       events.DownloadMoved,
+					DownloadID: mv.ID,
+					Filename:   mv.Filename,
+					Message:    destfile,
+					Details:    mv.Details,
+				})
 			}
-
-			s.mu.Lock()
-			delete(s.completedDownloads, req.CompletedId)
-			s.mu.Unlock()
 		} else {
-			log.Warn("could not find completed download")
+			log.WithError(err).Warn("could not find completed download")
 		}
 	}
 
 	// list remaining completed items
-	for id, dl := range s.completedDownloads {
-		resp.Completed[id] = &moviedownloader.Progress{
-			BytesPerSecond: dl.BytesPerSecond,
-			BytesCompleted: dl.BytesCompleted,
-			Size:           dl.Size,
-			Progress:       dl.Progress,
-			Filename:       dl.Filename,
-			Error:          dl.Error,
-			Details:        dl.Details.MapToProto(),
-		}
+	for id, dl := range s.downloads.Completed() {
+		resp.Completed[id] = dl.MapToProto()
 	}
 
 	return resp, nil
 }
+
+// libraryPath returns the folder a completed download is moved into. TV
+// episodes and season packs are organised as Show/Season NN/ under the TV
+// path, everything else goes straight into the media path. The show name
+// comes from the provider and is sanitized so it cannot escape the TV path.
+func (s *server) libraryPath(dl download.Download) (string, error) {
+	if dl.Details != nil {
+		if ep, ok := dl.Details.Episode(); ok {
+			return safepath.Join(s.tvPath, ep.Show, ep.SeasonFolder())
+		}
+	}
+	return s.mediaPath, nil
+}
+
+// detectEpisode marks the movie as a TV episode when its name clearly is
+// one, so episodes downloaded by hand are organised like the ones the
+// series watcher queues
+func detectEpisode(mv *movie.Movie) {
+	if mv.EpisodeInfo != nil {
+		return
+	}
+	if ep, ok := movie.DetectEpisode(mv.Filename); ok {
+		mv.EpisodeInfo = ep
+	}
+}
+
+// duplicateOf checks the movie against the active and completed downloads
+// and the library, by provider ID and by normalized title and quality. It
+// returns the reason when the movie is a duplicate.
+func (s *server) duplicateOf(mv *movie.Movie) (string, bool) {
+	if reason, ok := s.downloads.Duplicate(mv); ok {
+		return reason, true
+	}
+
+	return s.inLibrary(mv)
+}
+
+// inLibrary checks for a library file with the same title and quality
+func (s *server) inLibrary(mv *movie.Movie) (string, bool) {
+	if p, ok := s.library.Lookup(*mv); ok {
+		return "same title and quality is already in the library: " + filepath.Base(p), true
+	}
+	return "", false
+}
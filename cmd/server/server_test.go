@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/history"
+	"github.com/midgarco/movie_downloader/library"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/recycle"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// newTestServer returns a server with its folders in a temporary folder
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	dir := t.TempDir()
+	hist, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{
+		downloadPath:   filepath.Join(dir, "downloads"),
+		mediaPath:      filepath.Join(dir, "movies"),
+		tvPath:         filepath.Join(dir, "tv"),
+		advertised:     defaultMirror,
+		thumbs:         movie.DefaultThumbnails,
+		downloads:      download.NewManager(),
+		events:         events.NewBus(0),
+		history:        hist,
+		processingSets: map[string]bool{},
+	}
+	s.library = library.New(time.Minute, s.mediaPath, s.tvPath)
+	if s.recycle, err = recycle.Open(filepath.Join(dir, "recycle"), filepath.Join(dir, "recycle.json")); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// complete walks the download to the completed state and writes its file
+func complete(t *testing.T, s *server, id string) download.Download {
+	t.Helper()
+	var dl download.Download
+	for _, state := range []download.State{download.Starting, download.Downloading, download.Verifying, download.PostProcessing, download.Completed} {
+		var err error
+		if dl, err = s.downloads.Transition(id, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(download.Dir(s.downloadPath, dl), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.downloadFile(dl), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dl
+}
+
+func TestCompletedMovesManualEpisode(t *testing.T) {
+	s := newTestServer(t)
+
+	// a search result the client sends back without the episode
+	mv, err := movie.MapFromProtoObject(movie.Movie{ID: "ep1", Filename: "Some.Show.S01E02.1080p", Extension: ".mkv"}.MapToProto())
+	if err != nil {
+		t.Fatal(err)
+	}
+	detectEpisode(mv)
+	dl, _, err := s.downloads.Add(download.Request{Movie: mv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete(t, s, dl.ID)
+
+	if _, err := s.Completed(context.Background(), &moviedownloader.CompletedRequest{CompletedId: dl.ID}); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(s.tvPath, "Some Show", "Season 01", "Some.Show.S01E02.1080p.mkv")
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("episode not moved into the season folder: %v", err)
+	}
+}
+
+func TestCompletedMovesMovie(t *testing.T) {
+	s := newTestServer(t)
+
+	mv := &movie.Movie{ID: "mv1", Filename: "Fast.5x264.2011.720p", Extension: ".mkv"}
+	detectEpisode(mv)
+	dl, _, err := s.downloads.Add(download.Request{Movie: mv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete(t, s, dl.ID)
+
+	if _, err := s.Completed(context.Background(), &moviedownloader.CompletedRequest{CompletedId: dl.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.mediaPath, "Fast.5x264.2011.720p.mkv")); err != nil {
+		t.Fatalf("movie not moved into the media folder: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/events"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// downloadSet queues every file of the multi-part post the movie belongs
+// to. The other files are found with a search for the set name and must
+// come from the same poster.
+func (s *server) downloadSet(req *moviedownloader.DownloadRequest, mv *movie.Movie, requestedBy string) (*moviedownloader.DownloadResponse, error) {
+	if id, ok := s.downloads.IdempotencyKey(req.IdempotencyKey); ok {
+		return s.setResponse(id), nil
+	}
+
+	results, err := s.search(mv.SetName())
+	if err != nil {
+		return nil, err
+	}
+
+	found := movie.SetMembers(*mv, results.Movies)
+	members := make([]*movie.Movie, 0, len(found))
+	for i := range found {
+		if found[i].Virus {
+			log.WithField("filename", found[i].Filename+found[i].Extension).Error("set member contains a virus")
+			st := status.New(codes.FailedPrecondition, "set member contains virus: "+found[i].Filename+found[i].Extension)
+			return nil, st.Err()
+		}
+		members = append(members, &found[i])
+	}
+	log.WithFields(log.Fields{
+		"id":      mv.ID,
+		"set":     mv.SetName(),
+		"members": len(members),
+	}).Info("download set request")
+
+	if err := checkExpiry(members...); err != nil {
+		return nil, err
+	}
+	if err := s.preflight(members...); err != nil {
+		return nil, err
+	}
+
+	set, existing, err := s.downloads.AddSet(download.Request{
+		Movie:          mv,
+		IdempotencyKey: req.IdempotencyKey,
+		RequestedBy:    requestedBy,
+		Segments:       int(req.Segments),
+		Password:       req.Password,
+	}, members)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"id":     mv.ID,
+			"reason": err.Error(),
+		}).Warn("rejected duplicate download")
+		st := status.New(codes.AlreadyExists, err.Error())
+		return nil, st.Err()
+	}
+	if existing {
+		log.WithFields(log.Fields{
+			"id":              set[0].ID,
+			"idempotency_key": req.IdempotencyKey,
+		}).Info("download already requested")
+		return s.setResponse(set[0].ID), nil
+	}
+
+	for _, dl := range set {
+		s.publishDownload(events.DownloadQueued, dl.ID, "")
+	}
+	s.schedule()
+
+	if wantSidecars(req.Sidecars) {
+		go s.saveSidecars(set[0])
+	}
+
+	return s.setResponse(set[0].ID), nil
+}
+
+// setResponse describes the download and, when it belongs to a set, every
+// download of the set
+func (s *server) setResponse(id string) *moviedownloader.DownloadResponse {
+	resp := &moviedownloader.DownloadResponse{Id: id}
+
+	dl, ok := s.downloads.Get(id)
+	if !ok || dl.Set == "" {
+		return resp
+	}
+	resp.SetId = dl.Set
+	for _, member := range s.downloads.Set(dl.Set) {
+		resp.Ids = append(resp.Ids, member.ID)
+	}
+	return resp
+}
+
+// finishSet post-processes the download set once every member has been
+// downloaded and verified. Members that finish earlier wait in the
+// post-processing state; the last one to finish extracts and completes the
+// set.
+func (s *server) finishSet(id string) {
+	s.setMu.Lock()
+	members := s.downloads.Set(id)
+	for _, dl := range members {
+		if dl.State != download.PostProcessing {
+			s.setMu.Unlock()
+			log.WithField("set", id).Debug("waiting for the rest of the set")
+			return
+		}
+	}
+	if s.processingSets[id] || len(members) == 0 {
+		s.setMu.Unlock()
+		return
+	}
+	s.processingSets[id] = true
+	s.setMu.Unlock()
+
+	defer func() {
+		s.setMu.Lock()
+		delete(s.processingSets, id)
+		s.setMu.Unlock()
+	}()
+
+	logger := log.WithFields(log.Fields{
+		"set":     id,
+		"name":    members[0].SetName,
+		"members": len(members),
+	})
+	logger.Info("download set finished")
+
+	s.complete(members)
+
+	if remaining := s.downloads.Set(id); len(remaining) == 0 || remaining[0].State != download.Completed {
+		return
+	}
+	s.events.Publish(events.Event{
+		Type:       events.SetCompleted,
+		DownloadID: members[0].ID,
+		Filename:   members[0].SetName,
+		Message:    id,
+		Details:    members[0].Details,
+	})
+}
+
+// setsOf returns the combined progress of the sets the downloads belong to
+func (s *server) setsOf(ids []string) map[string]*moviedownloader.DownloadSet {
+	sets := map[string]*moviedownloader.DownloadSet{}
+	for _, id := range ids {
+		if id == "" || sets[id] != nil {
+			continue
+		}
+		members := s.downloads.Set(id)
+		if len(members) == 0 {
+			continue
+		}
+		sets[id] = download.Summarize(members).MapToProto()
+	}
+	return sets
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/safepath"
+	"github.com/midgarco/movie_downloader/sidecar"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sidecarTimeout limits fetching the NFO and the preview image of a release
+const sidecarTimeout = 30 * time.Second
+
+// thumbnails returns the thumbnail servers the provider advertised
+func (s *server) thumbnails() movie.Thumbnails {
+	s.mirrorMu.RLock()
+	defer s.mirrorMu.RUnlock()
+	return s.thumbs
+}
+
+// sidecarFetcher returns a fetcher with the credentials of the account. The
+// movie details come from clients, so only the hosts of the provider, its
+// mirror and its thumbnail servers are fetched from.
+func (s *server) sidecarFetcher() sidecar.Fetcher {
+	hosts := []string{}
+	thumbs := s.thumbnails()
+	for _, uri := range []string{s.searchUrlTemplate, s.mirror().BaseURL, thumbs.BaseURL, thumbs.LargeBaseURL} {
+		if u, err := url.Parse(uri); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	return sidecar.Fetcher{
+		Client:   &http.Client{},
+		Username: viper.GetString("USERNAME"),
+		Password: viper.GetString("PASSWORD"),
+		Hosts:    hosts,
+	}
+}
+
+// fetchSidecars downloads the NFO and the large preview image of the movie
+func (s *server) fetchSidecars(ctx context.Context, mv *movie.Movie) (sidecar.Sidecars, error) {
+	ctx, cancel := context.WithTimeout(ctx, sidecarTimeout)
+	defer cancel()
+
+	f := s.sidecarFetcher()
+	return f.Fetch(ctx, sidecar.Source{
+		NFO:      mv.Nfo,
+		ImageURL: s.thumbnails().LargeURL(*mv),
+	})
+}
+
+// wantSidecars returns whether the sidecars of a download are fetched,
+// which the request asks for or the SIDECARS setting turns on for every
+// download
+func wantSidecars(requested bool) bool {
+	return requested || viper.GetBool("SIDECARS")
+}
+
+// sidecarName returns the name the sidecars of the download are saved
+// under in the download folder: the set name for the files of a set, so
+// they are fetched once per set, and the movie name otherwise
+func sidecarName(dl download.Download) string {
+	if dl.SetName != "" {
+		return safepath.Sanitize(dl.SetName)
+	}
+	if dl.Details != nil {
+		return safepath.Sanitize(dl.Details.Filename)
+	}
+	return strings.TrimSuffix(dl.Filename, filepath.Ext(dl.Filename))
+}
+
+// saveSidecars fetches the NFO and the preview image of the download and
+// saves them next to it. A release without sidecars is not an error.
+func (s *server) saveSidecars(dl download.Download) {
+	name := sidecarName(dl)
+	logger := log.WithFields(log.Fields{
+		"id":   dl.ID,
+		"name": name,
+	})
+	if dl.Details == nil || sidecar.Exists(s.downloadPath, name) {
+		return
+	}
+
+	sc, err := s.fetchSidecars(context.Background(), dl.Details)
+	if err != nil {
+		logger.WithError(err).Warn("failed to fetch sidecars")
+	}
+	if sc.Empty() {
+		return
+	}
+	written, err := sidecar.Save(s.downloadPath, name, sc)
+	if err != nil {
+		logger.WithError(err).Warn("failed to save sidecars")
+		return
+	}
+	logger.WithField("files", written).Info("saved sidecars")
+}
+
+// moveSidecars moves the sidecars of the download next to the file in the
+// library, named after it so media servers pick them up
+func (s *server) moveSidecars(dl download.Download, destfile string) {
+	base := filepath.Base(destfile)
+	moved, err := sidecar.Move(s.downloadPath, sidecarName(dl), filepath.Dir(destfile), strings.TrimSuffix(base, filepath.Ext(base)))
+	if err != nil {
+		log.WithError(err).WithField("id", dl.ID).Warn("failed to move sidecars")
+	}
+	if len(moved) > 0 {
+		log.WithField("files", moved).Info("moved sidecars")
+	}
+}
+
+// Preview fetches the NFO and the preview image of the movie so clients can
+// show them before downloading
+func (s *server) Preview(ctx context.Context, req *moviedownloader.PreviewRequest) (*moviedownloader.PreviewResponse, error) {
+	if req.Movie == nil || req.Movie.Id == "" {
+		st := status.New(codes.InvalidArgument, "a movie is required to preview")
+		return nil, st.Err()
+	}
+	mv, err := movie.MapFromProtoObject(req.Movie)
+	if err != nil {
+		log.WithError(err).Error("failed to map proto object")
+		st := status.New(codes.Internal, "failed to map proto object")
+		return nil, st.Err()
+	}
+
+	sc, err := s.fetchSidecars(ctx, mv)
+	if err != nil {
+		log.WithError(err).WithField("id", mv.ID).Warn("failed to fetch preview")
+		if sc.Empty() {
+			st := status.New(codes.Unavailable, "failed to fetch preview: "+err.Error())
+			return nil, st.Err()
+		}
+	}
+
+	return &moviedownloader.PreviewResponse{
+		Nfo:       sc.NFO,
+		Image:     sc.Image,
+		ImageType: sc.ImageType,
+	}, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/sidecar"
+	"github.com/midgarco/movie_downloader/thumbcache"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultThumbnailCacheSize limits the thumbnail cache when
+	// THUMBNAIL_CACHE_SIZE is not configured
+	defaultThumbnailCacheSize = "100MB"
+
+	// thumbnailMaxAge is how long clients may cache a thumbnail, the
+	// preview image of a post never changes
+	thumbnailMaxAge = "604800"
+)
+
+// errNoThumbnail is returned when the provider has no preview image for
+// the post
+var errNoThumbnail = errors.New("no thumbnail")
+
+// thumbnail returns the cached preview image of the post, fetching it with
+// the account credentials on a cache miss. The image URL is built from the
+// post ID and the movie name.
+func (s *server) thumbnail(ctx context.Context, id, name string) (thumbcache.Item, error) {
+	if !thumbcache.ValidKey(id) {
+		return thumbcache.Item{}, thumbcache.ErrInvalidKey
+	}
+	if item, ok := s.thumbCache.Get(id); ok {
+		return item, nil
+	}
+
+	uri := s.thumbnails().URL(movie.Movie{ID: id, Filename: name})
+	if uri == "" {
+		return thumbcache.Item{}, errNoThumbnail
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sidecarTimeout)
+	defer cancel()
+	f := s.sidecarFetcher()
+	sc, err := f.Fetch(ctx, sidecar.Source{ImageURL: uri})
+	if err != nil {
+		return thumbcache.Item{}, err
+	}
+	if len(sc.Image) == 0 {
+		return thumbcache.Item{}, errNoThumbnail
+	}
+	return s.thumbCache.Put(id, sc.Image, sc.ImageType)
+}
+
+// thumbnailPath returns the path the server serves the preview image of
+// the movie at, which clients load without the account credentials
+func thumbnailPath(m movie.Movie) string {
+	return "/thumbs/" + url.PathEscape(m.ID) + "?name=" + url.QueryEscape(m.Filename)
+}
+
+// thumbnailHandler serves the preview image of a post at /thumbs/{id}. The
+// name query parameter is the movie name, which is part of the provider
+// URL.
+func (s *server) thumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/thumbs/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	item, err := s.thumbnail(r.Context(), id, r.URL.Query().Get("name"))
+	switch {
+	case errors.Is(err, errNoThumbnail), errors.Is(err, thumbcache.ErrInvalidKey):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		log.WithError(err).WithField("id", id).Warn("failed to fetch thumbnail")
+		http.Error(w, "failed to fetch thumbnail", http.StatusBadGateway)
+		return
+	}
+
+	f, err := os.Open(item.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", item.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age="+thumbnailMaxAge+", immutable")
+	w.Header().Set("ETag", `"`+id+`"`)
+	http.ServeContent(w, r, "", item.ModTime, f)
+}
+
+// Thumbnail returns the preview image of a post, for clients that cannot
+// reach the REST server
+func (s *server) Thumbnail(ctx context.Context, req *moviedownloader.ThumbnailRequest) (*moviedownloader.ThumbnailResponse, error) {
+	item, err := s.thumbnail(ctx, req.Id, req.Name)
+	switch {
+	case errors.Is(err, errNoThumbnail), errors.Is(err, thumbcache.ErrInvalidKey):
+		st := status.New(codes.NotFound, "no thumbnail for "+req.Id)
+		return nil, st.Err()
+	case err != nil:
+		log.WithError(err).WithField("id", req.Id).Warn("failed to fetch thumbnail")
+		st := status.New(codes.Unavailable, "failed to fetch thumbnail")
+		return nil, st.Err()
+	}
+
+	b, err := os.ReadFile(item.Path)
+	if err != nil {
+		st := status.New(codes.NotFound, "no thumbnail for "+req.Id)
+		return nil, st.Err()
+	}
+	return &moviedownloader.ThumbnailResponse{
+		Image:       b,
+		ContentType: item.ContentType,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/cavaliergopher/grab/v3"
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/segment"
+	"github.com/spf13/viper"
+)
+
+// transfer is a running download, either over a single grab connection or
+// split into segments
+type transfer interface {
+	Done() <-chan struct{}
+	Err() error
+	Cancel() error
+	Size() int64
+	BytesComplete() int64
+	BytesPerSecond() float64
+	Progress() float64
+	IsComplete() bool
+	Segments() int
+}
+
+// grabTransfer adapts a grab response to the transfer interface
+type grabTransfer struct {
+	*grab.Response
+}
+
+func (t grabTransfer) Done() <-chan struct{} {
+	return t.Response.Done
+}
+
+func (t grabTransfer) Segments() int {
+	return 1
+}
+
+// startTransfer starts downloading the URL into the partial file. The file
+// is split into segments when the download, or the SEGMENTS setting, asks
+// for more than one and the server supports range requests; a partial file
+// that was written in segments is always resumed in segments. Files
+// imported from an NZB file are fetched from the news server instead,
+// unless a URL was given when the download was retried.
+func (s *server) startTransfer(dl download.Download, uri, partial string, httpClient *http.Client) (transfer, error) {
+	if dl.NZB != nil && dl.URL == "" {
+		return s.startArticles(dl, partial)
+	}
+
+	segments := dl.Segments
+	if segments <= 0 {
+		segments = viper.GetInt("SEGMENTS")
+	}
+
+	_, err := os.Stat(partial + segment.StateSuffix)
+	segmented := err == nil
+
+	if segments > 1 || segmented {
+		client := &segment.Client{
+			HTTPClient: httpClient,
+			UserAgent:  "grab",
+		}
+		resp, err := client.Do(&segment.Request{
+			URL:      uri,
+			Filename: partial,
+			Segments: segments,
+			Prepare: func(r *http.Request) {
+				r.SetBasicAuth(viper.GetString("USERNAME"), viper.GetString("PASSWORD"))
+			},
+			BeforeCopy: func(size, completed int64) error {
+				return s.reserveSpaceFor(dl.ID, partial, size, completed)
+			},
+		})
+		if err == nil {
+			return resp, nil
+		}
+		if !errors.Is(err, segment.ErrRangesUnsupported) {
+			return nil, err
+		}
+
+		log.WithField("id", dl.ID).Info("server does not support range requests, using a single connection")
+		if segmented {
+			// the partial file has holes, it cannot be resumed sequentially
+			if err := download.RemovePartial(partial); err != nil {
+				return nil, err
+			}
+			if err := download.SavePartial(partial, dl); err != nil {
+				log.WithError(err).WithField("id", dl.ID).Warn("failed to save partial download metadata")
+			}
+		}
+	}
+
+	request, err := grab.NewRequest(".", uri)
+	if err != nil {
+		return nil, err
+	}
+	request.HTTPRequest.SetBasicAuth(viper.GetString("USERNAME"), viper.GetString("PASSWORD"))
+	request.Filename = partial
+	request.BeforeCopy = s.reserveSpace(dl.ID)
+
+	client := grab.Client{
+		HTTPClient: httpClient,
+		UserAgent:  "grab",
+	}
+	return grabTransfer{client.Do(request)}, nil
+}
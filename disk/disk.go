@@ -0,0 +1,32 @@
+package disk
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrUnsupported is returned when free space cannot be determined on the
+// current platform
+var ErrUnsupported = errors.New("free space is not supported on this platform")
+
+// Preallocate reserves room for the file to grow to size bytes without
+// changing its length, so a download that is resumed from the file still
+// starts at the right offset. It returns whether the room was reserved;
+// filesystems and platforms without support are silently skipped.
+func Preallocate(filename string, size int64) (bool, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if size <= fi.Size() {
+		return false, nil
+	}
+
+	return preallocate(f, fi.Size(), size-fi.Size())
+}
@@ -0,0 +1,19 @@
+package disk
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE, which allocates the blocks without
+// extending the file
+const fallocKeepSize = 0x01
+
+func preallocate(f *os.File, offset, length int64) (bool, error) {
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, offset, length)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return false, nil
+	}
+	return err == nil, err
+}
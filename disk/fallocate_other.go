@@ -0,0 +1,9 @@
+//go:build !linux
+
+package disk
+
+import "os"
+
+func preallocate(f *os.File, offset, length int64) (bool, error) {
+	return false, nil
+}
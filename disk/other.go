@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package disk
+
+// Free is not supported on this platform
+func Free(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package disk
+
+import "syscall"
+
+// Free returns the number of bytes available to unprivileged users on the
+// filesystem holding the path
+func Free(path string) (uint64, error) {
+	st := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,144 @@
+package download
+
+import (
+	"errors"
+	"time"
+
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/nzb"
+	"github.com/midgarco/movie_downloader/par2"
+	"github.com/midgarco/movie_downloader/probe"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/safepath"
+)
+
+// ErrNotFound is returned when the download is not known by the Manager
+var ErrNotFound = errors.New("download not found")
+
+// Download is the bookkeeping record of a single download. Values handed
+// out by the Manager are snapshots; the Details movie is shared between
+// snapshots and must be treated as read-only.
+type Download struct {
+	ID    string
+	State State
+
+	BytesPerSecond int64
+	BytesCompleted int64
+	Size           int64
+	Progress       int64
+	Filename       string
+	Details        *movie.Movie
+	Error          string
+	RequestedBy    string
+	// URL overrides the download URL built from the provider template,
+	// e.g. when a failed download is retried from the fallback URL
+	URL string
+	// Segments is the number of connections the file is downloaded over.
+	// Zero uses the SEGMENTS setting.
+	Segments int
+	// NZB lists the usenet articles of a file imported from an NZB file,
+	// which is downloaded over NNTP instead of the HTTP gateway
+	NZB *nzb.File
+	// Preallocated is set once the room for the rest of the file was
+	// reserved on disk, which already took it from the free space
+	Preallocated bool
+	// PauseReason is set when the server paused the download on its own
+	// and cleared when it is queued again
+	PauseReason string
+	// SHA256 is the checksum of the file once it has been verified
+	SHA256 string
+	// Media is the stream information probed from the finished file
+	Media *probe.Info
+	// Set groups the downloads of the files of a multi-part post, which
+	// are post-processed together once every member has finished
+	Set     string
+	SetName string
+	// Password extracts encrypted archives. It is never sent to clients.
+	Password string
+	// Step names the post-processing step in progress, e.g. extracting,
+	// and StepProgress is its completed percentage
+	Step         string
+	StepProgress int64
+	// Repair is the result of the PAR2 verification of the set
+	Repair *par2.Result
+
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Attempts   int
+}
+
+// FilenameOf returns the sanitized file name of the movie, which is safe to
+// use as a single path element
+func FilenameOf(mv *movie.Movie) string {
+	return safepath.Sanitize(mv.Filename + mv.Extension)
+}
+
+// AverageBytesPerSecond returns the average speed since the download was
+// first started
+func (d Download) AverageBytesPerSecond() int64 {
+	if d.StartedAt.IsZero() {
+		return 0
+	}
+	end := d.FinishedAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	elapsed := end.Sub(d.StartedAt).Seconds()
+	if elapsed < 1 {
+		return d.BytesPerSecond
+	}
+	return int64(float64(d.BytesCompleted) / elapsed)
+}
+
+// ETA returns the estimated time left at the current speed, or zero when it
+// cannot be estimated
+func (d Download) ETA() time.Duration {
+	if d.State != Downloading || d.BytesPerSecond <= 0 || d.Size <= 0 || d.BytesCompleted >= d.Size {
+		return 0
+	}
+	return time.Duration(float64(d.Size-d.BytesCompleted)/float64(d.BytesPerSecond)) * time.Second
+}
+
+// MapToProto ...
+func (d Download) MapToProto() *moviedownloader.Progress {
+	p := &moviedownloader.Progress{
+		Id:                    d.ID,
+		State:                 d.State,
+		BytesPerSecond:        d.BytesPerSecond,
+		BytesCompleted:        d.BytesCompleted,
+		Size:                  d.Size,
+		Progress:              d.Progress,
+		Filename:              d.Filename,
+		Error:                 d.Error,
+		Details:               d.Details.MapToProto(),
+		CreatedAt:             formatTime(d.CreatedAt),
+		StartedAt:             formatTime(d.StartedAt),
+		FinishedAt:            formatTime(d.FinishedAt),
+		EtaSeconds:            int64(d.ETA().Seconds()),
+		AverageBytesPerSecond: d.AverageBytesPerSecond(),
+		Attempts:              int32(d.Attempts),
+		RequestedBy:           d.RequestedBy,
+		PauseReason:           d.PauseReason,
+		Sha256:                d.SHA256,
+		Segments:              int32(d.Segments),
+		SetId:                 d.Set,
+		SetName:               d.SetName,
+		Step:                  d.Step,
+		StepProgress:          d.StepProgress,
+	}
+	if d.Media != nil {
+		p.Media = d.Media.MapToProto()
+	}
+	if d.Repair != nil {
+		p.Repair = d.Repair.MapToProto()
+	}
+	return p
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,416 @@
+package download
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/nzb"
+	"github.com/midgarco/movie_downloader/safepath"
+)
+
+// IdempotencyKeyTTL is how long a client supplied idempotency key is
+// remembered
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// DuplicateError is returned when a movie is already downloading or was
+// already downloaded
+type DuplicateError struct {
+	Reason string
+}
+
+func (e *DuplicateError) Error() string {
+	return e.Reason
+}
+
+type idempotencyKey struct {
+	id      string
+	created time.Time
+}
+
+// Manager owns the downloads and their state machine. All state is guarded
+// by a single mutex; the download goroutines mutate their record through
+// Update and Transition and readers only ever receive copies, so no caller
+// can observe a record while it is being written.
+type Manager struct {
+	mu              sync.RWMutex
+	downloads       map[string]*Download
+	idempotencyKeys map[string]idempotencyKey
+
+	subMu  sync.Mutex
+	subs   map[int]*Subscription
+	subSeq int
+}
+
+// NewManager ...
+func NewManager() *Manager {
+	return &Manager{
+		downloads:       map[string]*Download{},
+		idempotencyKeys: map[string]idempotencyKey{},
+		subs:            map[int]*Subscription{},
+	}
+}
+
+// Request describes a new download
+type Request struct {
+	Movie          *movie.Movie
+	IdempotencyKey string
+	RequestedBy    string
+	Segments       int
+	Password       string
+	// SetName names the set created by AddSet instead of the set name of
+	// the movie
+	SetName string
+	// NZB maps the IDs of movies imported from an NZB file to their
+	// articles
+	NZB map[string]*nzb.File
+}
+
+// Add registers a new queued download for the movie. When the idempotency
+// key was used before, the original download is returned and existing is
+// true. A *DuplicateError is returned when the same movie, or the same
+// title and quality, is already known.
+func (m *Manager) Add(req Request) (dl Download, existing bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mv, key := req.Movie, req.IdempotencyKey
+
+	m.pruneIdempotencyKeys()
+	if k, ok := m.idempotencyKeys[key]; ok && key != "" {
+		if d, ok := m.downloads[k.id]; ok {
+			return *d, true, nil
+		}
+		return Download{ID: k.id, Details: mv}, true, nil
+	}
+
+	if reason, ok := m.duplicateOf(mv); ok {
+		return Download{}, false, &DuplicateError{Reason: reason}
+	}
+
+	id := uuid.NewString()
+	d := &Download{
+		ID:          id,
+		State:       Queued,
+		Filename:    safepath.UniqueName(FilenameOf(mv), m.filenameTaken(id, "")),
+		Details:     mv,
+		RequestedBy: req.RequestedBy,
+		Segments:    req.Segments,
+		NZB:         req.NZB[mv.ID],
+		Password:    req.Password,
+		CreatedAt:   time.Now(),
+	}
+	m.downloads[d.ID] = d
+	if key != "" {
+		m.idempotencyKeys[key] = idempotencyKey{id: d.ID, created: time.Now()}
+	}
+	m.notify(d.ID)
+
+	return *d, false, nil
+}
+
+// IdempotencyKey returns the download that was queued with the key
+func (m *Manager) IdempotencyKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ok := m.idempotencyKeys[key]
+	if !ok || time.Since(k.created) > IdempotencyKeyTTL {
+		return "", false
+	}
+	return k.id, true
+}
+
+// Update applies fn to the download while holding the lock. It returns
+// false when the download is unknown. fn must not change the state; use
+// Transition for that.
+func (m *Manager) Update(id string, fn func(*Download)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.downloads[id]
+	if !ok {
+		return false
+	}
+	before := *d
+	fn(d)
+	d.State = before.State
+	if *d != before {
+		m.notify(id)
+	}
+	return true
+}
+
+// Transition moves the download to the given state, enforcing the state
+// machine and maintaining the timestamps and the attempt counter. It
+// returns a snapshot of the download after the transition.
+func (m *Manager) Transition(id string, to State) (Download, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.downloads[id]
+	if !ok {
+		return Download{}, ErrNotFound
+	}
+	if !CanTransition(d.State, to) {
+		return *d, &InvalidTransitionError{From: d.State, To: to}
+	}
+
+	now := time.Now()
+	switch to {
+	case Starting:
+		d.Attempts++
+		if d.StartedAt.IsZero() {
+			d.StartedAt = now
+		}
+		d.Error = ""
+	case Queued:
+		d.FinishedAt = time.Time{}
+		d.BytesPerSecond = 0
+		d.PauseReason = ""
+	case Failed, Completed, Done:
+		d.FinishedAt = now
+		d.BytesPerSecond = 0
+	case Paused, Retrying:
+		d.BytesPerSecond = 0
+	}
+	d.State = to
+	m.notify(id)
+
+	return *d, nil
+}
+
+// Remove forgets the download
+func (m *Manager) Remove(id string) (Download, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.downloads[id]
+	if !ok {
+		return Download{}, false
+	}
+	delete(m.downloads, id)
+	m.notify(id)
+	return *d, true
+}
+
+// Discard forgets a download, but only while it is in one of the allowed
+// states. An *InvalidTransitionError is returned for any other state so a
+// running download can never lose its record.
+func (m *Manager) Discard(id string, allowed ...State) (Download, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.downloads[id]
+	if !ok {
+		return Download{}, ErrNotFound
+	}
+	found := false
+	for _, s := range allowed {
+		if d.State == s {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return *d, &InvalidTransitionError{From: d.State, To: d.State}
+	}
+	delete(m.downloads, id)
+	m.notify(id)
+	return *d, nil
+}
+
+// Restore puts a discarded download back, e.g. a completed download that
+// was restored from the recycle bin. It returns false when a download with
+// the same ID is already known.
+func (m *Manager) Restore(dl Download) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.downloads[dl.ID]; ok {
+		return false
+	}
+	d := dl
+	m.downloads[d.ID] = &d
+	m.notify(d.ID)
+	return true
+}
+
+// Get returns a snapshot of the download
+func (m *Manager) Get(id string) (Download, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d, ok := m.downloads[id]
+	if !ok {
+		return Download{}, false
+	}
+	return *d, true
+}
+
+// Active returns a snapshot of the downloads that are not completed yet,
+// including the failed ones
+func (m *Manager) Active() map[string]Download {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filter(func(d *Download) bool {
+		return d.State != Completed && d.State != Moving && d.State != Done
+	})
+}
+
+// Completed returns a snapshot of the completed downloads waiting to be
+// moved into the library
+func (m *Manager) Completed() map[string]Download {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.filter(func(d *Download) bool {
+		return d.State == Completed
+	})
+}
+
+// Snapshot returns a consistent copy of the active and completed downloads
+func (m *Manager) Snapshot() (active, completed map[string]Download) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	active = m.filter(func(d *Download) bool {
+		return d.State != Completed && d.State != Moving && d.State != Done
+	})
+	completed = m.filter(func(d *Download) bool {
+		return d.State == Completed || d.State == Moving
+	})
+	return active, completed
+}
+
+// Running returns the number of downloads holding a download slot
+func (m *Manager) Running() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, d := range m.downloads {
+		if IsRunning(d.State) {
+			n++
+		}
+	}
+	return n
+}
+
+// Queued returns the queued downloads in the order they should be started
+func (m *Manager) Queued() []Download {
+	return m.inState(Queued)
+}
+
+// Paused returns the paused downloads, oldest first
+func (m *Manager) Paused() []Download {
+	return m.inState(Paused)
+}
+
+// UniqueFilename returns the name, with a collision suffix when another
+// download in the same folder already uses it. The download with the given
+// ID is ignored.
+func (m *Manager) UniqueFilename(name, id string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := ""
+	if d, ok := m.downloads[id]; ok {
+		set = d.Set
+	}
+	return safepath.UniqueName(safepath.Sanitize(name), m.filenameTaken(id, set))
+}
+
+// filenameTaken returns a function reporting whether a download other than
+// id writes to the file name in the folder of the set, or in the download
+// folder when set is empty. Names are compared case-insensitively for the
+// sake of case-insensitive filesystems. The caller must hold m.mu.
+func (m *Manager) filenameTaken(id, set string) func(string) bool {
+	return func(name string) bool {
+		for _, d := range m.downloads {
+			if d.ID != id && d.Set == set && strings.EqualFold(d.Filename, name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Duplicate checks the movie against the known downloads by provider ID and
+// by normalized title and quality
+func (m *Manager) Duplicate(mv *movie.Movie) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.duplicateOf(mv)
+}
+
+func (m *Manager) duplicateOf(mv *movie.Movie) (string, bool) {
+	fingerprint := mv.Fingerprint()
+
+	for _, d := range m.downloads {
+		if d.Details.ID != mv.ID && d.Details.Fingerprint() != fingerprint {
+			continue
+		}
+
+		switch d.State {
+		case Failed:
+			return fmt.Sprintf("a failed download of the same movie exists: %s", d.Filename), true
+		case Completed, Moving, Done:
+			if d.Details.ID == mv.ID {
+				return "movie was already downloaded", true
+			}
+			return fmt.Sprintf("same title and quality was already downloaded: %s", d.Filename), true
+		default:
+			if d.Details.ID == mv.ID {
+				return "movie is already downloading", true
+			}
+			return fmt.Sprintf("same title and quality is already downloading: %s", d.Filename), true
+		}
+	}
+
+	return "", false
+}
+
+func (m *Manager) inState(state State) []Download {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Download{}
+	for _, d := range m.downloads {
+		if d.State == state {
+			list = append(list, *d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (m *Manager) filter(keep func(*Download) bool) map[string]Download {
+	dst := map[string]Download{}
+	for id, d := range m.downloads {
+		if keep(d) {
+			dst[id] = *d
+		}
+	}
+	return dst
+}
+
+func (m *Manager) pruneIdempotencyKeys() {
+	for k, v := range m.idempotencyKeys {
+		if time.Since(v.created) > IdempotencyKeyTTL {
+			delete(m.idempotencyKeys, k)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/midgarco/movie_downloader/movie"
+)
+
+func testMovie(n int) *movie.Movie {
+	return &movie.Movie{
+		ID:        fmt.Sprintf("id%04d", n),
+		Filename:  fmt.Sprintf("Film%04d.2020.1080p.WEB", n),
+		Extension: ".mkv",
+	}
+}
+
+func TestAddIdempotencyKey(t *testing.T) {
+	m := NewManager()
+
+	first, existing, err := m.Add(Request{Movie: testMovie(1), IdempotencyKey: "key"})
+	if err != nil || existing {
+		t.Fatalf("first add: existing=%v err=%v", existing, err)
+	}
+	again, existing, err := m.Add(Request{Movie: testMovie(1), IdempotencyKey: "key"})
+	if err != nil || !existing || again.ID != first.ID {
+		t.Fatalf("retried add: id=%s existing=%v err=%v, want %s", again.ID, existing, err, first.ID)
+	}
+	if id, ok := m.IdempotencyKey("key"); !ok || id != first.ID {
+		t.Fatalf("IdempotencyKey = %s, %v", id, ok)
+	}
+}
+
+func TestAddDuplicate(t *testing.T) {
+	m := NewManager()
+
+	if _, _, err := m.Add(Request{Movie: testMovie(1)}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := m.Add(Request{Movie: testMovie(1)})
+	var dup *DuplicateError
+	if !errors.As(err, &dup) {
+		t.Fatalf("err = %v, want *DuplicateError", err)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	m := NewManager()
+	dl, _, _ := m.Add(Request{Movie: testMovie(1)})
+
+	if _, err := m.Transition(dl.ID, Completed); err == nil {
+		t.Fatal("queued download moved to completed")
+	}
+	for _, to := range []State{Starting, Downloading, Verifying, PostProcessing, Completed} {
+		if _, err := m.Transition(dl.ID, to); err != nil {
+			t.Fatalf("transition to %s: %v", StateName(to), err)
+		}
+	}
+	got, _ := m.Get(dl.ID)
+	if got.Attempts != 1 || got.StartedAt.IsZero() || got.FinishedAt.IsZero() {
+		t.Fatalf("bookkeeping not maintained: %+v", got)
+	}
+	if _, err := m.Transition("unknown", Queued); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateKeepsState(t *testing.T) {
+	m := NewManager()
+	dl, _, _ := m.Add(Request{Movie: testMovie(1)})
+
+	m.Update(dl.ID, func(d *Download) {
+		d.State = Done
+		d.Progress = 50
+	})
+	got, _ := m.Get(dl.ID)
+	if got.State != Queued || got.Progress != 50 {
+		t.Fatalf("state=%s progress=%d", StateName(got.State), got.Progress)
+	}
+}
+
+// TestConcurrentDownloadProgressCompleted runs what the Download, Progress
+// and Completed handlers do at the same time; run it with -race
+func TestConcurrentDownloadProgressCompleted(t *testing.T) {
+	const n = 50
+	m := NewManager()
+
+	sub := m.Subscribe()
+	defer sub.Close()
+
+	var (
+		wg     sync.WaitGroup
+		moved  atomic.Int32
+		stop   = make(chan struct{})
+		ids    = make(chan string, n)
+		reader sync.WaitGroup
+	)
+
+	// Progress: snapshots and deltas while the downloads change
+	reader.Add(1)
+	go func() {
+		defer reader.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sub.C():
+				for _, id := range sub.Changed() {
+					if dl, ok := m.Get(id); ok {
+						_ = dl.MapToProto()
+					}
+				}
+				m.Snapshot()
+			}
+		}
+	}()
+
+	// Download: queue and run every download through to completed
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dl, existing, err := m.Add(Request{Movie: testMovie(i), IdempotencyKey: fmt.Sprintf("key%d", i)})
+			if err != nil || existing {
+				t.Errorf("add %d: existing=%v err=%v", i, existing, err)
+				return
+			}
+			for _, to := range []State{Starting, Downloading} {
+				if _, err := m.Transition(dl.ID, to); err != nil {
+					t.Errorf("transition: %v", err)
+					return
+				}
+			}
+			for p := int64(0); p <= 100; p += 10 {
+				m.Update(dl.ID, func(d *Download) {
+					d.Progress = p
+					d.BytesCompleted = p * 1000
+				})
+			}
+			for _, to := range []State{Verifying, PostProcessing, Completed} {
+				if _, err := m.Transition(dl.ID, to); err != nil {
+					t.Errorf("transition: %v", err)
+					return
+				}
+			}
+			ids <- dl.ID
+		}(i)
+	}
+
+	// Completed: several clients race to move every completed download,
+	// exactly one of them may win
+	finished := make(chan struct{})
+	for c := 0; c < 4; c++ {
+		completed := m.Subscribe()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer completed.Close()
+			for {
+				select {
+				case <-finished:
+					return
+				case <-completed.C():
+				}
+				completed.Changed()
+				for id := range m.Completed() {
+					if _, err := m.Transition(id, Moving); err != nil {
+						continue
+					}
+					if _, err := m.Transition(id, Done); err != nil {
+						t.Errorf("finish %s: %v", id, err)
+					}
+					if _, ok := m.Remove(id); !ok {
+						t.Errorf("remove %s: already gone", id)
+					}
+					if moved.Add(1) == n {
+						close(finished)
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stop)
+	reader.Wait()
+	close(ids)
+
+	if got := moved.Load(); got != n {
+		t.Fatalf("moved %d downloads, want %d", got, n)
+	}
+	for id := range ids {
+		if _, ok := m.Get(id); ok {
+			t.Errorf("download %s still known after it was moved", id)
+		}
+	}
+}
+
+func TestAddSetKeepsNames(t *testing.T) {
+	m := NewManager()
+
+	// another release of the same name, in another quality
+	single := &movie.Movie{ID: "single", Filename: "Release.part01", Extension: ".rar", Height: "720"}
+	if _, _, err := m.Add(Request{Movie: single}); err != nil {
+		t.Fatal(err)
+	}
+
+	members := []*movie.Movie{
+		{ID: "vol1", Filename: "Release.part01", Extension: ".rar"},
+		{ID: "vol2", Filename: "Release.part02", Extension: ".rar"},
+	}
+	set, _, err := m.AddSet(Request{SetName: "Release"}, members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, dl := range set {
+		// the set has a folder of its own, other downloads do not collide
+		if want := FilenameOf(members[i]); dl.Filename != want {
+			t.Errorf("member %d filename = %q, want %q", i, dl.Filename, want)
+		}
+		if got := m.UniqueFilename(dl.Filename, dl.ID); got != dl.Filename {
+			t.Errorf("UniqueFilename(%q) = %q", dl.Filename, got)
+		}
+	}
+}
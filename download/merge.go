@@ -0,0 +1,28 @@
+package download
+
+import (
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// MergeProgress applies a progress stream response to the downloads known
+// by a client. Snapshots replace the map; deltas update the changed
+// downloads, keeping the movie details sent earlier, and drop the removed
+// ones.
+func MergeProgress(downloads map[string]*moviedownloader.Progress, res *moviedownloader.ProgressResponse) map[string]*moviedownloader.Progress {
+	if res.Snapshot || downloads == nil {
+		downloads = map[string]*moviedownloader.Progress{}
+	}
+
+	for id, p := range res.ActiveDownloads {
+		if prev, ok := downloads[id]; ok && p.Details == nil {
+			p.Details = prev.Details
+		}
+		downloads[id] = p
+	}
+
+	for _, id := range res.Removed {
+		delete(downloads, id)
+	}
+
+	return downloads
+}
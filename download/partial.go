@@ -0,0 +1,194 @@
+package download
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/nntp"
+	"github.com/midgarco/movie_downloader/nzb"
+	"github.com/midgarco/movie_downloader/safepath"
+	"github.com/midgarco/movie_downloader/segment"
+)
+
+const (
+	// PartialSuffix is appended to the filename while the download is in
+	// progress so media scanners never pick up a half written movie
+	PartialSuffix = ".part"
+
+	// SetDirPrefix is the prefix of the folder the files of a set are
+	// downloaded into, followed by the set ID
+	SetDirPrefix = ".set-"
+
+	// metaSuffix is appended to the partial filename for the metadata file
+	// that allows resuming the download after a restart
+	metaSuffix = ".json"
+)
+
+// partialMeta is the information needed to queue a partial download again
+type partialMeta struct {
+	ID          string       `json:"id"`
+	Filename    string       `json:"filename"`
+	URL         string       `json:"url,omitempty"`
+	RequestedBy string       `json:"requested_by,omitempty"`
+	Segments    int          `json:"segments,omitempty"`
+	NZB         *nzb.File    `json:"nzb,omitempty"`
+	Set         string       `json:"set,omitempty"`
+	SetName     string       `json:"set_name,omitempty"`
+	Password    string       `json:"password,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Details     *movie.Movie `json:"details"`
+}
+
+// Dir returns the folder the download is written to in the download
+// folder. The files of a set get a folder of their own so they keep the
+// names that tie archive volumes and PAR2 files together, without
+// colliding with other downloads.
+func Dir(dir string, dl Download) string {
+	if dl.Set == "" {
+		return dir
+	}
+	return filepath.Join(dir, SetDirPrefix+safepath.Sanitize(dl.Set))
+}
+
+// PartialFile returns the path the download is written to while it is in
+// progress
+func PartialFile(dir string, dl Download) string {
+	return filepath.Join(Dir(dir, dl), safepath.Sanitize(dl.Filename)+PartialSuffix)
+}
+
+// SavePartial writes the metadata file next to the partial file. It holds
+// the archive password, so only the owner can read it.
+func SavePartial(partial string, dl Download) error {
+	b, err := json.MarshalIndent(partialMeta{
+		ID:          dl.ID,
+		Filename:    dl.Filename,
+		URL:         dl.URL,
+		RequestedBy: dl.RequestedBy,
+		Segments:    dl.Segments,
+		NZB:         dl.NZB,
+		Set:         dl.Set,
+		SetName:     dl.SetName,
+		Password:    dl.Password,
+		CreatedAt:   dl.CreatedAt,
+		Details:     dl.Details,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(partial+metaSuffix, b, 0600); err != nil {
+		return err
+	}
+	// files written by earlier versions were readable by everyone
+	return os.Chmod(partial+metaSuffix, 0600)
+}
+
+// RemovePartial deletes the partial file, its metadata and the segment
+// or article state of a segmented or NNTP download
+func RemovePartial(partial string) error {
+	if err := ForgetPartial(partial); err != nil {
+		return err
+	}
+	for _, suffix := range []string{segment.StateSuffix, nntp.StateSuffix} {
+		if err := os.Remove(partial + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(partial); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ForgetPartial deletes the metadata only, so the partial file is not
+// resumed after a restart
+func ForgetPartial(partial string) error {
+	if err := os.Remove(partial + metaSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Finalize atomically renames the partial file to its final name and
+// deletes the metadata
+func Finalize(partial, filename string) error {
+	if err := os.Rename(partial, filename); err != nil {
+		return err
+	}
+	return ForgetPartial(partial)
+}
+
+// ScanPartials looks for the partial files left behind by an earlier run,
+// in the download folder and the folders of the sets. Partial downloads
+// with metadata are returned as queued downloads so they can be resumed;
+// partial files without metadata cannot be resumed and are returned as
+// orphans.
+func ScanPartials(dir string) (resume []Download, orphans []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), SetDirPrefix) {
+			r, o, err := ScanPartials(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, nil, err
+			}
+			resume, orphans = append(resume, r...), append(orphans, o...)
+			continue
+		}
+		if e.IsDir() {
+			continue
+		}
+		name := filepath.Join(dir, e.Name())
+
+		switch {
+		case strings.HasSuffix(name, PartialSuffix+metaSuffix):
+			b, err := os.ReadFile(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			meta := partialMeta{}
+			if err := json.Unmarshal(b, &meta); err != nil || meta.ID == "" || meta.Details == nil {
+				orphans = append(orphans, strings.TrimSuffix(name, metaSuffix))
+				continue
+			}
+			filename := FilenameOf(meta.Details)
+			if meta.Filename != "" {
+				filename = safepath.Sanitize(meta.Filename)
+			}
+			resume = append(resume, Download{
+				ID:          meta.ID,
+				State:       Queued,
+				Filename:    filename,
+				Details:     meta.Details,
+				URL:         meta.URL,
+				RequestedBy: meta.RequestedBy,
+				Segments:    meta.Segments,
+				NZB:         meta.NZB,
+				Set:         meta.Set,
+				SetName:     meta.SetName,
+				Password:    meta.Password,
+				CreatedAt:   meta.CreatedAt,
+			})
+
+		case strings.HasSuffix(name, PartialSuffix):
+			if _, err := os.Stat(name + metaSuffix); os.IsNotExist(err) {
+				orphans = append(orphans, name)
+			}
+		}
+	}
+
+	return resume, orphans, nil
+}
@@ -0,0 +1,68 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSavePartial(t *testing.T) {
+	dir := t.TempDir()
+	dl := Download{
+		ID:        "1",
+		Filename:  "movie.mkv",
+		Details:   testMovie(1),
+		SetName:   "movie",
+		Password:  "secret",
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	partial := PartialFile(dir, dl)
+
+	// an earlier version left the metadata readable by everyone
+	if err := os.WriteFile(partial+metaSuffix, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePartial(partial, dl); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(partial + metaSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Fatalf("metadata permissions = %o, want 600", perm)
+	}
+
+	resume, orphans, err := ScanPartials(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resume) != 1 || len(orphans) != 0 {
+		t.Fatalf("resume = %v, orphans = %v", resume, orphans)
+	}
+	got := resume[0]
+	if got.ID != dl.ID || got.Password != dl.Password || got.State != Queued || !got.CreatedAt.Equal(dl.CreatedAt) {
+		t.Fatalf("resumed %+v", got)
+	}
+}
+
+func TestScanPartialsInSetDir(t *testing.T) {
+	dir := t.TempDir()
+	dl := Download{ID: "1", Filename: "movie.part01.rar", Set: "set1", Details: testMovie(1)}
+	partial := PartialFile(dir, dl)
+	if want := filepath.Join(dir, SetDirPrefix+"set1", "movie.part01.rar"+PartialSuffix); partial != want {
+		t.Fatalf("PartialFile = %s, want %s", partial, want)
+	}
+	if err := SavePartial(partial, dl); err != nil {
+		t.Fatal(err)
+	}
+
+	resume, orphans, err := ScanPartials(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resume) != 1 || len(orphans) != 0 || resume[0].Set != dl.Set {
+		t.Fatalf("resume = %v, orphans = %v", resume, orphans)
+	}
+}
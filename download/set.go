@@ -0,0 +1,191 @@
+package download
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/safepath"
+)
+
+// SetProgress is the combined progress of the members of a download set
+type SetProgress struct {
+	ID               string
+	Name             string
+	State            State
+	Members          int
+	CompletedMembers int
+	Size             int64
+	BytesCompleted   int64
+	BytesPerSecond   int64
+	Step             string
+	StepProgress     int64
+}
+
+// Summarize combines the progress of the members of a download set. The
+// set is failed when any member failed, downloading while any member still
+// has to be downloaded and otherwise as far along as its slowest member.
+func Summarize(members []Download) SetProgress {
+	p := SetProgress{Members: len(members)}
+
+	var running, queued, paused bool
+	done := Done
+	for _, d := range members {
+		p.ID, p.Name = d.Set, d.SetName
+
+		size := d.Size
+		if size <= 0 && d.Details != nil {
+			size = int64(d.Details.RawSize)
+		}
+		p.Size += size
+		p.BytesCompleted += d.BytesCompleted
+		p.BytesPerSecond += d.BytesPerSecond
+		if d.Step != "" {
+			p.Step, p.StepProgress = d.Step, d.StepProgress
+		}
+
+		switch d.State {
+		case Failed:
+			p.State = Failed
+		case Starting, Downloading, Retrying, Verifying:
+			running = true
+		case Queued:
+			queued = true
+		case Paused:
+			paused = true
+		default:
+			if d.State >= Completed {
+				p.CompletedMembers++
+			}
+			if d.State < done {
+				done = d.State
+			}
+		}
+	}
+
+	switch {
+	case p.State == Failed:
+	case running:
+		p.State = Downloading
+	case queued:
+		p.State = Queued
+	case paused:
+		p.State = Paused
+	default:
+		p.State = done
+	}
+	return p
+}
+
+// Progress returns the completed percentage of the set
+func (p SetProgress) Progress() int64 {
+	if p.Size <= 0 {
+		return 0
+	}
+	return 100 * p.BytesCompleted / p.Size
+}
+
+// MapToProto ...
+func (p SetProgress) MapToProto() *moviedownloader.DownloadSet {
+	return &moviedownloader.DownloadSet{
+		Id:               p.ID,
+		Name:             p.Name,
+		State:            p.State,
+		Members:          int32(p.Members),
+		CompletedMembers: int32(p.CompletedMembers),
+		Size:             p.Size,
+		BytesCompleted:   p.BytesCompleted,
+		BytesPerSecond:   p.BytesPerSecond,
+		Progress:         p.Progress(),
+		Step:             p.Step,
+		StepProgress:     p.StepProgress,
+	}
+}
+
+// AddSet registers a queued download for every member of a multi-part post
+// and groups them into one set. The duplicate checks of Add apply to every
+// member, but the members are not compared with each other since they
+// share the release title. The members are written to a folder of their
+// own, see Dir, so they keep their names. When the idempotency key was used
+// before, the original set is returned and existing is true.
+func (m *Manager) AddSet(req Request, members []*movie.Movie) (set []Download, existing bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := req.IdempotencyKey
+
+	m.pruneIdempotencyKeys()
+	if k, ok := m.idempotencyKeys[key]; ok && key != "" {
+		if d, ok := m.downloads[k.id]; ok {
+			if d.Set == "" {
+				return []Download{*d}, true, nil
+			}
+			return m.set(d.Set), true, nil
+		}
+		return []Download{{ID: k.id, Details: req.Movie}}, true, nil
+	}
+
+	for _, mv := range members {
+		if reason, ok := m.duplicateOf(mv); ok {
+			return nil, false, &DuplicateError{Reason: reason}
+		}
+	}
+
+	setID := uuid.NewString()
+	setName := req.SetName
+	if setName == "" {
+		setName = req.Movie.SetName()
+	}
+	setName = safepath.Sanitize(setName)
+	for _, mv := range members {
+		id := uuid.NewString()
+		d := &Download{
+			ID:          id,
+			State:       Queued,
+			Filename:    safepath.UniqueName(FilenameOf(mv), m.filenameTaken(id, setID)),
+			Details:     mv,
+			RequestedBy: req.RequestedBy,
+			Segments:    req.Segments,
+			NZB:         req.NZB[mv.ID],
+			Password:    req.Password,
+			Set:         setID,
+			SetName:     setName,
+			CreatedAt:   time.Now(),
+		}
+		m.downloads[d.ID] = d
+		set = append(set, *d)
+		m.notify(d.ID)
+	}
+	if key != "" && len(set) > 0 {
+		m.idempotencyKeys[key] = idempotencyKey{id: set[0].ID, created: time.Now()}
+	}
+
+	return set, false, nil
+}
+
+// Set returns a snapshot of the members of the download set in the order
+// they were queued
+func (m *Manager) Set(id string) []Download {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.set(id)
+}
+
+func (m *Manager) set(id string) []Download {
+	list := []Download{}
+	if id == "" {
+		return list
+	}
+	for _, d := range m.downloads {
+		if d.Set == id {
+			list = append(list, *d)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
@@ -0,0 +1,73 @@
+package download
+
+import (
+	"fmt"
+	"strings"
+
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// State ...
+type State = moviedownloader.DownloadState
+
+const (
+	Queued         = moviedownloader.DownloadState_DOWNLOAD_STATE_QUEUED
+	Starting       = moviedownloader.DownloadState_DOWNLOAD_STATE_STARTING
+	Downloading    = moviedownloader.DownloadState_DOWNLOAD_STATE_DOWNLOADING
+	Paused         = moviedownloader.DownloadState_DOWNLOAD_STATE_PAUSED
+	Retrying       = moviedownloader.DownloadState_DOWNLOAD_STATE_RETRYING
+	Failed         = moviedownloader.DownloadState_DOWNLOAD_STATE_FAILED
+	Verifying      = moviedownloader.DownloadState_DOWNLOAD_STATE_VERIFYING
+	PostProcessing = moviedownloader.DownloadState_DOWNLOAD_STATE_POST_PROCESSING
+	Completed      = moviedownloader.DownloadState_DOWNLOAD_STATE_COMPLETED
+	Moving         = moviedownloader.DownloadState_DOWNLOAD_STATE_MOVING
+	Done           = moviedownloader.DownloadState_DOWNLOAD_STATE_DONE
+)
+
+// transitions lists the states each state is allowed to move to
+var transitions = map[State][]State{
+	Queued:         {Starting, Paused, Failed},
+	Starting:       {Downloading, Retrying, Failed},
+	Downloading:    {Paused, Retrying, Failed, Verifying},
+	Paused:         {Queued, Failed},
+	Retrying:       {Queued, Failed},
+	Failed:         {Queued, PostProcessing},
+	Verifying:      {PostProcessing, Retrying, Failed},
+	PostProcessing: {Completed, Failed},
+	Completed:      {Moving},
+	Moving:         {Done, Completed},
+	Done:           {},
+}
+
+// InvalidTransitionError is returned when a download is asked to move to a
+// state that is not reachable from its current state
+type InvalidTransitionError struct {
+	From State
+	To   State
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot move download from %s to %s", StateName(e.From), StateName(e.To))
+}
+
+// CanTransition returns whether a download may move from one state to the
+// other
+func CanTransition(from, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRunning returns whether the state holds one of the download slots
+func IsRunning(s State) bool {
+	return s == Starting || s == Downloading
+}
+
+// StateName returns the short lowercase name of the state, e.g.
+// post_processing
+func StateName(s State) string {
+	return strings.ToLower(strings.TrimPrefix(s.String(), "DOWNLOAD_STATE_"))
+}
@@ -0,0 +1,82 @@
+package download
+
+import "sync"
+
+// Subscription collects the IDs of the downloads that changed since the
+// last call to Changed. Notifications never block the Manager: changes are
+// coalesced into a set and a single pending signal, so a slow subscriber
+// only ever sees the latest state of each download.
+type Subscription struct {
+	m  *Manager
+	id int
+
+	mu      sync.Mutex
+	changed map[string]struct{}
+	signal  chan struct{}
+}
+
+// Subscribe registers a new subscription for download changes. The caller
+// must Close it when done.
+func (m *Manager) Subscribe() *Subscription {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	m.subSeq++
+	sub := &Subscription{
+		m:       m,
+		id:      m.subSeq,
+		changed: map[string]struct{}{},
+		signal:  make(chan struct{}, 1),
+	}
+	m.subs[sub.id] = sub
+
+	return sub
+}
+
+// C is signalled whenever there are changes waiting to be collected
+func (s *Subscription) C() <-chan struct{} {
+	return s.signal
+}
+
+// Changed returns and clears the IDs that changed since the last call
+func (s *Subscription) Changed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.changed))
+	for id := range s.changed {
+		ids = append(ids, id)
+	}
+	s.changed = map[string]struct{}{}
+
+	return ids
+}
+
+// Close stops the subscription from receiving further changes
+func (s *Subscription) Close() {
+	s.m.subMu.Lock()
+	defer s.m.subMu.Unlock()
+
+	delete(s.m.subs, s.id)
+}
+
+func (s *Subscription) notify(id string) {
+	s.mu.Lock()
+	s.changed[id] = struct{}{}
+	s.mu.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// notify tells every subscriber that the download changed
+func (m *Manager) notify(id string) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	for _, sub := range m.subs {
+		sub.notify(id)
+	}
+}
@@ -0,0 +1,124 @@
+package download
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestSubscriptionCoalesces(t *testing.T) {
+	m := NewManager()
+	sub := m.Subscribe()
+	defer sub.Close()
+
+	dl, _, _ := m.Add(Request{Movie: testMovie(1)})
+	for i := int64(0); i < 10; i++ {
+		m.Update(dl.ID, func(d *Download) { d.Progress = i })
+	}
+
+	<-sub.C()
+	if ids := sub.Changed(); len(ids) != 1 || ids[0] != dl.ID {
+		t.Fatalf("changed = %v, want [%s]", ids, dl.ID)
+	}
+	select {
+	case <-sub.C():
+		if ids := sub.Changed(); len(ids) != 0 {
+			t.Fatalf("changed again: %v", ids)
+		}
+	default:
+	}
+}
+
+func TestSubscriptionUnchangedUpdate(t *testing.T) {
+	m := NewManager()
+	dl, _, _ := m.Add(Request{Movie: testMovie(1)})
+
+	sub := m.Subscribe()
+	defer sub.Close()
+	m.Update(dl.ID, func(d *Download) {})
+
+	select {
+	case <-sub.C():
+		t.Fatalf("notified without a change: %v", sub.Changed())
+	default:
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	m := NewManager()
+	sub := m.Subscribe()
+	sub.Close()
+
+	m.Add(Request{Movie: testMovie(1)})
+	if ids := sub.Changed(); len(ids) != 0 {
+		t.Fatalf("closed subscription received %v", ids)
+	}
+}
+
+// TestSubscriptionConcurrent checks that a subscriber collecting changes
+// while many downloads change sees every one of them; run it with -race
+func TestSubscriptionConcurrent(t *testing.T) {
+	const n = 100
+	m := NewManager()
+	sub := m.Subscribe()
+	defer sub.Close()
+
+	seen := map[string]bool{}
+	done := make(chan struct{})
+	var collected sync.WaitGroup
+	collected.Add(1)
+	go func() {
+		defer collected.Done()
+		for {
+			select {
+			case <-sub.C():
+				for _, id := range sub.Changed() {
+					seen[id] = true
+				}
+			case <-done:
+				for _, id := range sub.Changed() {
+					seen[id] = true
+				}
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	want := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dl, _, err := m.Add(Request{Movie: testMovie(i)})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			want[i] = dl.ID
+			m.Update(dl.ID, func(d *Download) { d.Progress = 1 })
+		}(i)
+	}
+
+	// subscribers come and go while the downloads change
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := m.Subscribe()
+			s.Changed()
+			s.Close()
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	collected.Wait()
+
+	sort.Strings(want)
+	for _, id := range want {
+		if !seen[id] {
+			t.Fatalf("change of %s was never collected", id)
+		}
+	}
+}
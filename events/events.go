@@ -0,0 +1,170 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// DefaultHistory is the number of events kept for resuming subscribers
+const DefaultHistory = 1000
+
+// Type ...
+type Type = moviedownloader.EventType
+
+const (
+	DownloadQueued    = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_QUEUED
+	DownloadStarted   = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_STARTED
+	DownloadRetrying  = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_RETRYING
+	DownloadFailed    = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_FAILED
+	DownloadCompleted = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_COMPLETED
+	DownloadMoved     = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_MOVED
+	DownloadRemoved   = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_REMOVED
+	ConfigChanged     = moviedownloader.EventType_EVENT_TYPE_CONFIG_CHANGED
+	SearchPerformed   = moviedownloader.EventType_EVENT_TYPE_SEARCH_PERFORMED
+	FileDeleted       = moviedownloader.EventType_EVENT_TYPE_FILE_DELETED
+	FileRestored      = moviedownloader.EventType_EVENT_TYPE_FILE_RESTORED
+	DownloadPaused    = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_PAUSED
+	DownloadResumed   = moviedownloader.EventType_EVENT_TYPE_DOWNLOAD_RESUMED
+	SetCompleted      = moviedownloader.EventType_EVENT_TYPE_SET_COMPLETED
+	Reset             = moviedownloader.EventType_EVENT_TYPE_RESET
+)
+
+// Event is a single lifecycle event. Sequence and Timestamp are assigned by
+// the Bus when the event is published.
+type Event struct {
+	Sequence   uint64
+	Timestamp  time.Time
+	Type       Type
+	DownloadID string
+	Filename   string
+	Message    string
+	Details    *movie.Movie
+	Results    int
+}
+
+// MapToProto ...
+func (e Event) MapToProto(streamID string) *moviedownloader.Event {
+	ev := &moviedownloader.Event{
+		StreamId:   streamID,
+		Sequence:   e.Sequence,
+		Timestamp:  e.Timestamp.Format(time.RFC3339Nano),
+		Type:       e.Type,
+		DownloadId: e.DownloadID,
+		Filename:   e.Filename,
+		Message:    e.Message,
+		Results:    int32(e.Results),
+	}
+	if e.Details != nil {
+		ev.Details = e.Details.MapToProto()
+	}
+	return ev
+}
+
+// Bus numbers the published events, keeps a bounded history of them and
+// fans them out to the subscribers. The stream ID changes every time the
+// server starts so clients can tell that their sequence numbers no longer
+// apply.
+type Bus struct {
+	mu       sync.Mutex
+	streamID string
+	sequence uint64
+	history  []Event
+	size     int
+	subs     map[chan struct{}]struct{}
+}
+
+// NewBus creates a bus that keeps the last size events
+func NewBus(size int) *Bus {
+	if size <= 0 {
+		size = DefaultHistory
+	}
+	return &Bus{
+		streamID: uuid.NewString(),
+		size:     size,
+		subs:     map[chan struct{}]struct{}{},
+	}
+}
+
+// StreamID identifies this run of the server
+func (b *Bus) StreamID() string {
+	return b.streamID
+}
+
+// Sequence returns the sequence number of the last published event
+func (b *Bus) Sequence() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sequence
+}
+
+// Missed returns whether events after the sequence number were dropped
+// from the history, or the sequence number is not one of this run
+func (b *Bus) Missed(after uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if after > b.sequence {
+		return true
+	}
+	return len(b.history) > 0 && b.history[0].Sequence > after+1
+}
+
+// Publish stamps the event with the next sequence number and the current
+// time and wakes up the subscribers
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	e.Sequence = b.sequence
+	e.Timestamp = time.Now()
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+
+	return e
+}
+
+// Since returns the retained events with a sequence number greater than
+// after
+func (b *Bus) Since(after uint64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := []Event{}
+	for _, e := range b.history {
+		if e.Sequence > after {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Subscribe returns a channel that is signalled whenever new events are
+// published, and a function to release it
+func (b *Bus) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import "testing"
+
+func TestSince(t *testing.T) {
+	b := NewBus(3)
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Type: DownloadQueued})
+	}
+	if b.Sequence() != 5 {
+		t.Fatalf("sequence = %d", b.Sequence())
+	}
+
+	got := b.Since(3)
+	if len(got) != 2 || got[0].Sequence != 4 || got[1].Sequence != 5 {
+		t.Fatalf("since 3 = %+v", got)
+	}
+	if got := b.Since(0); len(got) != 3 || got[0].Sequence != 3 {
+		t.Fatalf("since 0 = %+v", got)
+	}
+}
+
+func TestMissed(t *testing.T) {
+	b := NewBus(3)
+	if b.Missed(0) {
+		t.Fatal("missed events of an empty bus")
+	}
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Type: DownloadQueued})
+	}
+
+	// events 1 and 2 were dropped from the history
+	for after, want := range map[uint64]bool{0: true, 1: true, 2: false, 4: false, 5: false, 6: true} {
+		if got := b.Missed(after); got != want {
+			t.Errorf("Missed(%d) = %v, want %v", after, got, want)
+		}
+	}
+}
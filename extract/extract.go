@@ -0,0 +1,189 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/midgarco/movie_downloader/safepath"
+)
+
+var (
+	// ErrPassword is returned when the archive is encrypted and the password
+	// is missing or wrong
+	ErrPassword = errors.New("archive is password protected, the password is missing or wrong")
+
+	// ErrUnsupported is returned for files that are not a supported archive
+	ErrUnsupported = errors.New("unsupported archive")
+)
+
+// Format ...
+type Format int
+
+const (
+	None Format = iota
+	RAR
+	ZIP
+	SevenZip
+)
+
+var (
+	// rarPartRegex matches the volumes of a new style multi-volume RAR
+	// archive and captures the volume number, e.g. name.part01.rar
+	rarPartRegex = regexp.MustCompile(`(?i)\.part(\d+)\.rar$`)
+	// oldVolumeRegex matches the continuation volumes of an old style RAR
+	// archive and split 7z and ZIP archives, e.g. name.r00 or name.7z.002
+	oldVolumeRegex = regexp.MustCompile(`(?i)\.(r\d{2,3}|(7z|zip)\.\d{3})$`)
+	// splitFirstRegex matches the first volume of a split archive
+	splitFirstRegex = regexp.MustCompile(`(?i)\.(7z|zip)\.001$`)
+)
+
+// Detect returns the archive format of the file from its name. Only the
+// first volume of a multi-volume archive is detected, so every archive is
+// extracted exactly once.
+func Detect(filename string) Format {
+	name := strings.ToLower(filename)
+
+	if m := rarPartRegex.FindStringSubmatch(name); m != nil {
+		if strings.TrimLeft(m[1], "0") == "1" {
+			return RAR
+		}
+		return None
+	}
+	if m := splitFirstRegex.FindStringSubmatch(name); m != nil {
+		if m[1] == "7z" {
+			return SevenZip
+		}
+		return ZIP
+	}
+	if oldVolumeRegex.MatchString(name) {
+		return None
+	}
+
+	switch filepath.Ext(name) {
+	case ".rar":
+		return RAR
+	case ".zip":
+		return ZIP
+	case ".7z":
+		return SevenZip
+	}
+	return None
+}
+
+// IsVolume returns whether the file is a volume of an archive, the first or
+// any of the others
+func IsVolume(filename string) bool {
+	return Detect(filename) != None || rarPartRegex.MatchString(filename) || oldVolumeRegex.MatchString(filename)
+}
+
+// Options ...
+type Options struct {
+	// Password decrypts encrypted archives
+	Password string
+
+	// Progress is called with the number of bytes written and the total
+	// uncompressed size of the archive
+	Progress func(written, total int64)
+}
+
+// Extract unpacks the archive into the folder and returns the paths of the
+// extracted files. Entry names are sanitized so no file can be written
+// outside of the folder. The checksums of the entries are verified while
+// they are extracted.
+func Extract(ctx context.Context, archive, dir string, opts Options) ([]string, error) {
+	switch Detect(filepath.Base(archive)) {
+	case RAR:
+		return extractRAR(ctx, archive, dir, opts)
+	case ZIP:
+		return extractZIP(ctx, archive, dir, opts)
+	case SevenZip:
+		return extractSevenZip(ctx, archive, dir, opts)
+	}
+	return nil, ErrUnsupported
+}
+
+// entryPath returns the path of an archive entry inside the folder
+func entryPath(dir, name string) (string, error) {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	if len(parts) == 0 {
+		return "", safepath.ErrEscape
+	}
+	return safepath.Join(dir, parts...)
+}
+
+// progress counts the bytes written across the entries of an archive
+type progress struct {
+	written atomic.Int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func (p *progress) add(n int64) {
+	written := p.written.Add(n)
+	if p.fn != nil {
+		p.fn(written, p.total)
+	}
+}
+
+// writeEntry copies the entry into the file at path, checking for
+// cancellation between the chunks
+func writeEntry(ctx context.Context, path string, r io.Reader, p *progress) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			f.Close()
+			return err
+		}
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				f.Close()
+				return err
+			}
+			p.add(int64(n))
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			f.Close()
+			return rerr
+		}
+	}
+	return f.Close()
+}
+
+// passwordRegexes find the password of a release in a post subject or an
+// NFO file, e.g. {{secret}} or "Password: secret"
+var passwordRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`\{\{([^}]+)\}\}`),
+	regexp.MustCompile(`(?im)\b(?:password|passwort|passwd|pass|pw)\s*[:=]\s*(\S+)`),
+}
+
+// FindPassword returns the archive password announced in the text
+func FindPassword(text string) (string, bool) {
+	for _, re := range passwordRegexes {
+		if m := re.FindStringSubmatch(text); m != nil {
+			if pw := strings.TrimSpace(m[1]); pw != "" {
+				return pw, true
+			}
+		}
+	}
+	return "", false
+}
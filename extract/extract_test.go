@@ -0,0 +1,215 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/midgarco/movie_downloader/safepath"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"movie.rar", RAR},
+		{"Movie.RAR", RAR},
+		{"movie.part01.rar", RAR},
+		{"movie.part1.rar", RAR},
+		{"movie.part001.rar", RAR},
+		{"movie.part02.rar", None},
+		{"movie.part10.rar", None},
+		{"movie.r00", None},
+		{"movie.r123", None},
+		{"movie.zip", ZIP},
+		{"movie.zip.001", ZIP},
+		{"movie.zip.002", None},
+		{"movie.7z", SevenZip},
+		{"movie.7z.001", SevenZip},
+		{"movie.7z.002", None},
+		{"movie.mkv", None},
+		{"movie.par2", None},
+		{"movie.nfo", None},
+		{"rar", None},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.name); got != tt.want {
+			t.Errorf("Detect(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsVolume(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"movie.rar", true},
+		{"movie.part01.rar", true},
+		{"movie.part02.rar", true},
+		{"movie.r00", true},
+		{"movie.R15", true},
+		{"movie.7z.003", true},
+		{"movie.zip.002", true},
+		{"movie.mkv", false},
+		{"movie.vol00+01.par2", false},
+		{"movie.sfv", false},
+		{"movie.r", false},
+	}
+	for _, tt := range tests {
+		if got := IsVolume(tt.name); got != tt.want {
+			t.Errorf("IsVolume(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFindPassword(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{`Some.Movie.2019.1080p {{s3cr3t}} "movie.part01.rar" yEnc (1/50)`, "s3cr3t", true},
+		{"Password: hunter2", "hunter2", true},
+		{"release info\npw=abc123\nenjoy", "abc123", true},
+		{"PASSWORT : geheim", "geheim", true},
+		{"passwd:x", "x", true},
+		{"{{ spaced }}", "spaced", true},
+		{"{{}}", "", false},
+		{"no password here", "", false},
+		{"compass: north", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := FindPassword(tt.text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("FindPassword(%q) = %q, %v, want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"movie.mkv", "movie.mkv"},
+		{"Sample/sample.mkv", filepath.Join("Sample", "sample.mkv")},
+		{`Subs\english.srt`, filepath.Join("Subs", "english.srt")},
+		{"/etc/passwd", filepath.Join("etc", "passwd")},
+		{"../../etc/passwd", filepath.Join("download", "download", "etc", "passwd")},
+		{`..\..\boot.ini`, filepath.Join("download", "download", "boot.ini")},
+	}
+	for _, tt := range tests {
+		got, err := entryPath(dir, tt.name)
+		if err != nil {
+			t.Errorf("entryPath(%q): %v", tt.name, err)
+			continue
+		}
+		if want := filepath.Join(dir, tt.want); got != want {
+			t.Errorf("entryPath(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+
+	for _, name := range []string{"", "/", `\\`} {
+		if _, err := entryPath(dir, name); !errors.Is(err, safepath.ErrEscape) {
+			t.Errorf("entryPath(%q) err = %v, want safepath.ErrEscape", name, err)
+		}
+	}
+}
+
+// the 7z archives in testdata come from github.com/bodgit/sevenzip, see
+// testdata/README. t1.7z and t2.7z hold foo and bar, t2.7z encrypted along
+// with its headers and t4.7z only the data, both with the password
+// "password". multi.7z is split into six volumes.
+func TestExtractSevenZip(t *testing.T) {
+	tests := []struct {
+		archive  string
+		password string
+		files    []string
+	}{
+		{"t1.7z", "", []string{"bar", "foo"}},
+		{"t2.7z", "password", []string{"bar", "foo"}},
+		{"t4.7z", "password", []string{"bar", "foo"}},
+		{"multi.7z.001", "", []string{"01", "02", "03", "04", "05", "06", "07", "08", "09", "10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.archive, func(t *testing.T) {
+			dir := t.TempDir()
+			var written, total int64
+			files, err := Extract(context.Background(), filepath.Join("testdata", tt.archive), dir, Options{
+				Password: tt.password,
+				Progress: func(w, t int64) { written, total = w, t },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tt.files) {
+				t.Fatalf("files = %v, want %v", files, tt.files)
+			}
+			for i, name := range tt.files {
+				if files[i] != filepath.Join(dir, name) {
+					t.Errorf("files[%d] = %q, want %q", i, files[i], filepath.Join(dir, name))
+				}
+			}
+			if total == 0 || written != total {
+				t.Errorf("progress = %d/%d", written, total)
+			}
+
+			if tt.archive == "multi.7z.001" {
+				b, err := os.ReadFile(files[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(string(b), "Lorem ipsum") {
+					t.Errorf("01 = %q...", b[:min(len(b), 20)])
+				}
+				return
+			}
+			for _, name := range tt.files {
+				b, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != name+"\n" {
+					t.Errorf("%s = %q, want %q", name, b, name+"\n")
+				}
+			}
+		})
+	}
+}
+
+func TestExtractWrongPassword(t *testing.T) {
+	tests := []struct {
+		archive  string
+		password string
+	}{
+		{"t2.7z", ""},
+		{"t2.7z", "wrong"},
+		{"t4.7z", ""},
+		{"t4.7z", "wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.archive+"/"+tt.password, func(t *testing.T) {
+			_, err := Extract(context.Background(), filepath.Join("testdata", tt.archive), t.TempDir(), Options{Password: tt.password})
+			if !errors.Is(err, ErrPassword) {
+				t.Fatalf("err = %v, want ErrPassword", err)
+			}
+		})
+	}
+}
+
+func TestExtractUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "movie.mkv")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Extract(context.Background(), path, t.TempDir(), Options{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("err = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,69 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/nwaples/rardecode/v2"
+)
+
+func extractRAR(ctx context.Context, archive, dir string, opts Options) ([]string, error) {
+	var options []rardecode.Option
+	if opts.Password != "" {
+		options = append(options, rardecode.Password(opts.Password))
+	}
+
+	// the listing gives the total size for the progress reports
+	list, err := rardecode.List(archive, options...)
+	if err != nil {
+		return nil, rarError(err)
+	}
+	p := &progress{fn: opts.Progress}
+	for _, f := range list {
+		if !f.IsDir && f.UnPackedSize > 0 {
+			p.total += f.UnPackedSize
+		}
+	}
+
+	// solid archives can only be read sequentially
+	r, err := rardecode.OpenReader(archive, options...)
+	if err != nil {
+		return nil, rarError(err)
+	}
+	defer r.Close()
+
+	files := []string{}
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, rarError(err)
+		}
+		if h.IsDir {
+			continue
+		}
+
+		path, err := entryPath(dir, h.Name)
+		if err != nil {
+			return files, err
+		}
+		if err := writeEntry(ctx, path, r, p); err != nil {
+			return files, rarError(err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+func rarError(err error) error {
+	switch {
+	case errors.Is(err, rardecode.ErrArchiveEncrypted),
+		errors.Is(err, rardecode.ErrArchivedFileEncrypted),
+		errors.Is(err, rardecode.ErrBadPassword):
+		return ErrPassword
+	}
+	return err
+}
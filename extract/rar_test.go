@@ -0,0 +1,210 @@
+package extract
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// RAR 4 block types and flags, see the RAR 4 technote
+const (
+	rarBlockArc  = 0x73
+	rarBlockFile = 0x74
+	rarBlockEnd  = 0x7b
+
+	rarArcVolume    = 0x0001
+	rarArcNewNaming = 0x0010
+
+	rarFileSplitBefore = 0x0001
+	rarFileSplitAfter  = 0x0002
+	rarFileEncrypted   = 0x0004
+	rarFileHasData     = 0x8000
+
+	rarEndNotLast = 0x0001
+)
+
+// rarEntry is a file of a test archive, split across the volumes in parts
+type rarEntry struct {
+	name      string
+	parts     [][]byte
+	encrypted bool
+}
+
+// writeRAR writes a stored RAR 4 archive with one volume per part of the
+// entries, named name.partNN.rar when there is more than one, and returns
+// the path of the first volume
+func writeRAR(t *testing.T, dir, name string, entries ...rarEntry) string {
+	t.Helper()
+	volumes := 1
+	for _, e := range entries {
+		volumes = max(volumes, len(e.parts))
+	}
+
+	var first string
+	for v := 0; v < volumes; v++ {
+		var buf bytes.Buffer
+		buf.WriteString("Rar!\x1a\x07\x00")
+
+		arcFlags := uint16(0)
+		if volumes > 1 {
+			arcFlags = rarArcVolume | rarArcNewNaming
+		}
+		rarBlock(&buf, rarBlockArc, arcFlags, make([]byte, 6), nil)
+
+		for _, e := range entries {
+			if v >= len(e.parts) {
+				continue
+			}
+			var whole []byte
+			for _, p := range e.parts {
+				whole = append(whole, p...)
+			}
+			flags := uint16(rarFileHasData)
+			if v > 0 {
+				flags |= rarFileSplitBefore
+			}
+			if v < len(e.parts)-1 {
+				flags |= rarFileSplitAfter
+			}
+			if e.encrypted {
+				flags |= rarFileEncrypted
+			}
+
+			data := make([]byte, 25, 25+len(e.name))
+			binary.LittleEndian.PutUint32(data[0:], uint32(len(e.parts[v])))
+			binary.LittleEndian.PutUint32(data[4:], uint32(len(whole)))
+			data[8] = 3 // unix
+			binary.LittleEndian.PutUint32(data[9:], crc32.ChecksumIEEE(whole))
+			binary.LittleEndian.PutUint32(data[13:], 0x5a210000)
+			data[17] = 29   // unpack version
+			data[18] = 0x30 // store
+			binary.LittleEndian.PutUint16(data[19:], uint16(len(e.name)))
+			binary.LittleEndian.PutUint32(data[21:], 0644)
+			data = append(data, e.name...)
+			rarBlock(&buf, rarBlockFile, flags, data, e.parts[v])
+		}
+
+		endFlags := uint16(0)
+		if v < volumes-1 {
+			endFlags = rarEndNotLast
+		}
+		rarBlock(&buf, rarBlockEnd, endFlags, nil, nil)
+
+		filename := name + ".rar"
+		if volumes > 1 {
+			filename = fmt.Sprintf("%s.part%02d.rar", name, v+1)
+		}
+		path := filepath.Join(dir, filename)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if v == 0 {
+			first = path
+		}
+	}
+	return first
+}
+
+// rarBlock writes a block header with its CRC, followed by the packed data
+func rarBlock(buf *bytes.Buffer, kind byte, flags uint16, data, packed []byte) {
+	header := make([]byte, 7, 7+len(data))
+	header[2] = kind
+	binary.LittleEndian.PutUint16(header[3:], flags)
+	binary.LittleEndian.PutUint16(header[5:], uint16(7+len(data)))
+	header = append(header, data...)
+	binary.LittleEndian.PutUint16(header, uint16(crc32.ChecksumIEEE(header[2:])))
+	buf.Write(header)
+	buf.Write(packed)
+}
+
+func TestExtractRAR(t *testing.T) {
+	movie := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	tests := []struct {
+		name    string
+		entries []rarEntry
+		files   map[string][]byte
+	}{
+		{
+			name: "single",
+			entries: []rarEntry{
+				{name: "movie.mkv", parts: [][]byte{movie}},
+				{name: `Subs\english.srt`, parts: [][]byte{[]byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n")}},
+			},
+			files: map[string][]byte{
+				"movie.mkv":                          movie,
+				filepath.Join("Subs", "english.srt"): []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"),
+			},
+		},
+		{
+			name: "multi-volume",
+			entries: []rarEntry{
+				{name: "movie.mkv", parts: [][]byte{movie[:5000], movie[5000:10000], movie[10000:]}},
+			},
+			files: map[string][]byte{"movie.mkv": movie},
+		},
+		{
+			name: "escape",
+			entries: []rarEntry{
+				{name: `..\..\movie.mkv`, parts: [][]byte{movie}},
+			},
+			files: map[string][]byte{filepath.Join("download", "download", "movie.mkv"): movie},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dir := t.TempDir(), t.TempDir()
+			archive := writeRAR(t, src, "movie", tt.entries...)
+			if Detect(filepath.Base(archive)) != RAR {
+				t.Fatalf("%s not detected as RAR", filepath.Base(archive))
+			}
+
+			var written, total int64
+			files, err := Extract(context.Background(), archive, dir, Options{
+				Progress: func(w, t int64) { written, total = w, t },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tt.files) {
+				t.Fatalf("files = %v", files)
+			}
+			for name, want := range tt.files {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s has %d bytes, want %d", name, len(got), len(want))
+				}
+			}
+			if total == 0 || written != total {
+				t.Errorf("progress = %d/%d", written, total)
+			}
+		})
+	}
+}
+
+func TestExtractRARMissingVolume(t *testing.T) {
+	src := t.TempDir()
+	archive := writeRAR(t, src, "movie", rarEntry{name: "movie.mkv", parts: [][]byte{[]byte("first"), []byte("second")}})
+	if err := os.Remove(filepath.Join(src, "movie.part02.rar")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Extract(context.Background(), archive, t.TempDir(), Options{}); err == nil {
+		t.Fatal("extracted an archive with a missing volume")
+	}
+}
+
+func TestExtractRARPassword(t *testing.T) {
+	archive := writeRAR(t, t.TempDir(), "movie", rarEntry{name: "movie.mkv", parts: [][]byte{[]byte("encrypted data")}, encrypted: true})
+	_, err := Extract(context.Background(), archive, t.TempDir(), Options{})
+	if !errors.Is(err, ErrPassword) {
+		t.Fatalf("err = %v, want ErrPassword", err)
+	}
+}
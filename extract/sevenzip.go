@@ -0,0 +1,53 @@
+package extract
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bodgit/sevenzip"
+)
+
+func extractSevenZip(ctx context.Context, archive, dir string, opts Options) ([]string, error) {
+	// a .7z.001 archive is opened with all of its volumes
+	r, err := sevenzip.OpenReaderWithPassword(archive, opts.Password)
+	if err != nil {
+		return nil, sevenZipError(err)
+	}
+	defer r.Close()
+
+	p := &progress{fn: opts.Progress}
+	for _, f := range r.File {
+		p.total += int64(f.UncompressedSize)
+	}
+
+	files := []string{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		path, err := entryPath(dir, f.Name)
+		if err != nil {
+			return files, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return files, sevenZipError(err)
+		}
+		err = writeEntry(ctx, path, rc, p)
+		rc.Close()
+		if err != nil {
+			return files, sevenZipError(err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+func sevenZipError(err error) error {
+	var re *sevenzip.ReadError
+	if errors.As(err, &re) && re.Encrypted {
+		return ErrPassword
+	}
+	return err
+}
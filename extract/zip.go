@@ -0,0 +1,153 @@
+package extract
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// zipEncrypted is the general purpose flag of encrypted ZIP entries
+const zipEncrypted = 0x1
+
+// errZipStrongEncryption is returned for ZIP archives encrypted with the
+// PKWARE strong encryption, only ZipCrypto and WinZip AES are supported
+var errZipStrongEncryption = errors.New("ZIP archives with PKWARE strong encryption are not supported")
+
+func extractZIP(ctx context.Context, archive, dir string, opts Options) ([]string, error) {
+	r, closer, err := openZIP(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	p := &progress{fn: opts.Progress}
+	for _, f := range r.File {
+		p.total += int64(f.UncompressedSize64)
+	}
+
+	files := []string{}
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		path, err := entryPath(dir, f.Name)
+		if err != nil {
+			return files, err
+		}
+		var rc io.ReadCloser
+		if f.Flags&zipEncrypted != 0 {
+			rc, err = openEncrypted(f, opts.Password)
+		} else {
+			rc, err = f.Open()
+		}
+		if err != nil {
+			return files, err
+		}
+		// the readers return zip.ErrChecksum when the CRC does not match
+		err = writeEntry(ctx, path, rc, p)
+		rc.Close()
+		if err != nil {
+			return files, err
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// openZIP opens a ZIP archive, joining the volumes of a split archive
+// (name.zip.001, name.zip.002, ...) into one reader
+func openZIP(archive string) (*zip.Reader, io.Closer, error) {
+	if !splitFirstRegex.MatchString(archive) {
+		rc, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &rc.Reader, rc, nil
+	}
+
+	volumes, err := filepath.Glob(escapeGlob(strings.TrimSuffix(archive, filepath.Ext(archive))) + ".[0-9][0-9][0-9]")
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(volumes)
+
+	mr, err := openMulti(volumes)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := zip.NewReader(mr, mr.size)
+	if err != nil {
+		mr.Close()
+		return nil, nil, err
+	}
+	return r, mr, nil
+}
+
+// escapeGlob escapes the glob meta characters of a path
+func escapeGlob(path string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`).Replace(path)
+}
+
+// multiReader reads the volumes of a split archive as one file
+type multiReader struct {
+	files   []*os.File
+	offsets []int64
+	size    int64
+}
+
+func openMulti(names []string) (*multiReader, error) {
+	mr := &multiReader{}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			mr.Close()
+			return nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			mr.Close()
+			return nil, err
+		}
+		mr.files = append(mr.files, f)
+		mr.offsets = append(mr.offsets, mr.size)
+		mr.size += fi.Size()
+	}
+	return mr, nil
+}
+
+func (mr *multiReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= mr.size {
+		return 0, io.EOF
+	}
+
+	i := sort.Search(len(mr.offsets), func(i int) bool { return mr.offsets[i] > off }) - 1
+	n := 0
+	for ; i < len(mr.files) && n < len(p); i++ {
+		m, err := mr.files[i].ReadAt(p[n:], off+int64(n)-mr.offsets[i])
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mr *multiReader) Close() error {
+	var err error
+	for _, f := range mr.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
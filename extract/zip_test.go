@@ -0,0 +1,108 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the encrypted archives hold movie.mkv, deflated, and notes.txt, stored,
+// with the password secret. aes.zip was written by an independent WinZip
+// AES encoder, AES-256 AE-1 for the movie and AES-128 AE-2 for the notes;
+// zipcrypto.zip by Info-ZIP zip -P.
+var (
+	encryptedMovie = bytes.Repeat([]byte("video data "), 300)
+	encryptedNotes = []byte("release notes\n")
+)
+
+func TestExtractEncryptedZIP(t *testing.T) {
+	for _, archive := range []string{"aes.zip", "zipcrypto.zip"} {
+		t.Run(archive, func(t *testing.T) {
+			dir := t.TempDir()
+			files, err := Extract(context.Background(), filepath.Join("testdata", archive), dir, Options{Password: "secret"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 2 {
+				t.Fatalf("files = %v", files)
+			}
+			for name, want := range map[string][]byte{"movie.mkv": encryptedMovie, "notes.txt": encryptedNotes} {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s = %q..., want %q...", name, got[:min(len(got), 20)], want[:20])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractEncryptedZIPWrongPassword(t *testing.T) {
+	for _, archive := range []string{"aes.zip", "zipcrypto.zip"} {
+		for _, password := range []string{"", "wrong"} {
+			_, err := Extract(context.Background(), filepath.Join("testdata", archive), t.TempDir(), Options{Password: password})
+			if !errors.Is(err, ErrPassword) {
+				t.Errorf("%s with password %q: err = %v, want ErrPassword", archive, password, err)
+			}
+		}
+	}
+}
+
+func TestExtractTamperedAESZIP(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "aes.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the encrypted data of movie.mkv follows the local header, the name,
+	// the AES extra field, the salt and the password verifier
+	b[30+len("movie.mkv")+11+16+2+10] ^= 0xff
+	archive := filepath.Join(t.TempDir(), "tampered.zip")
+	if err := os.WriteFile(archive, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Extract(context.Background(), archive, t.TempDir(), Options{Password: "secret"})
+	if !errors.Is(err, zip.ErrChecksum) {
+		t.Fatalf("err = %v, want zip.ErrChecksum", err)
+	}
+}
+
+func TestZipCryptoRoundTrip(t *testing.T) {
+	plain := []byte("the quick brown fox")
+	data := append([]byte(nil), plain...)
+
+	// encrypting feeds the plain bytes into the keys, like decrypting does
+	enc := newZipCryptoKeys("secret")
+	for i, c := range data {
+		t := uint16(enc[2] | 2)
+		data[i] = c ^ byte((t*(t^1))>>8)
+		enc.update(c)
+	}
+	if bytes.Equal(data, plain) {
+		t.Fatal("nothing was encrypted")
+	}
+	newZipCryptoKeys("secret").decrypt(data)
+	if !bytes.Equal(data, plain) {
+		t.Fatalf("decrypted %q, want %q", data, plain)
+	}
+}
+
+func TestAESExtra(t *testing.T) {
+	extra := []byte{
+		0x01, 0x00, 0x04, 0x00, 1, 2, 3, 4, // another field first
+		0x01, 0x99, 0x07, 0x00, 0x02, 0x00, 'A', 'E', 0x03, 0x08, 0x00,
+	}
+	version, keySize, method, ok := aesExtra(extra)
+	if !ok || version != 2 || keySize != 32 || method != 8 {
+		t.Fatalf("aesExtra = %d, %d, %d, %v", version, keySize, method, ok)
+	}
+	if _, _, _, ok := aesExtra(extra[:8]); ok {
+		t.Fatal("found AES information without the field")
+	}
+}
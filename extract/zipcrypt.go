@@ -0,0 +1,311 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// zipDataDescriptor is the general purpose flag of entries whose CRC
+	// follows the data, the ZipCrypto check byte is then the modification
+	// time
+	zipDataDescriptor = 0x8
+	// zipStrongEncryption is the general purpose flag of the PKWARE strong
+	// encryption, which is not supported
+	zipStrongEncryption = 0x40
+
+	// zipMethodAES is the compression method of WinZip AES entries, the
+	// real method is in the AES extra field
+	zipMethodAES = 99
+	// zipAESExtraID is the ID of the WinZip AES extra field
+	zipAESExtraID = 0x9901
+
+	// zipCryptoHeaderSize is the size of the encryption header of a
+	// ZipCrypto entry, zipAESMACSize the size of the authentication code
+	// that follows the data of an AES entry
+	zipCryptoHeaderSize = 12
+	zipAESMACSize       = 10
+)
+
+// openEncrypted returns a reader of the decrypted and decompressed data of
+// an encrypted ZIP entry. Traditional PKWARE (ZipCrypto) and WinZip AES
+// encryption are supported. ErrPassword is returned when the password does
+// not match.
+func openEncrypted(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&zipStrongEncryption != 0 {
+		return nil, errZipStrongEncryption
+	}
+	if password == "" {
+		return nil, ErrPassword
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Method == zipMethodAES {
+		return openAES(f, raw, password)
+	}
+
+	header := make([]byte, zipCryptoHeaderSize)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	keys := newZipCryptoKeys(password)
+	keys.decrypt(header)
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipDataDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[zipCryptoHeaderSize-1] != check {
+		return nil, ErrPassword
+	}
+
+	size := int64(f.CompressedSize64) - zipCryptoHeaderSize
+	data := &zipCryptoReader{r: io.LimitReader(raw, size), keys: keys}
+	rc, err := decompress(f.Method, data)
+	if err != nil {
+		return nil, err
+	}
+	// the check byte lets one in 256 wrong passwords through, their data
+	// fails the CRC
+	return &crcReader{rc: rc, hash: crc32.NewIEEE(), want: f.CRC32, err: ErrPassword}, nil
+}
+
+// openAES decrypts a WinZip AES entry: the salt and the password verifier
+// are followed by the AES-CTR encrypted data and an HMAC-SHA1 of it
+func openAES(f *zip.File, raw io.Reader, password string) (io.ReadCloser, error) {
+	version, keySize, method, ok := aesExtra(f.Extra)
+	if !ok {
+		return nil, errors.New("encrypted ZIP entry without AES information")
+	}
+
+	salt := make([]byte, keySize/2)
+	verifier := make([]byte, 2)
+	if _, err := io.ReadFull(raw, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(raw, verifier); err != nil {
+		return nil, err
+	}
+	key := pbkdf2.Key([]byte(password), salt, 1000, 2*keySize+2, sha1.New)
+	if !bytes.Equal(key[2*keySize:], verifier) {
+		return nil, ErrPassword
+	}
+
+	block, err := aes.NewCipher(key[:keySize])
+	if err != nil {
+		return nil, err
+	}
+	size := int64(f.CompressedSize64) - int64(len(salt)+len(verifier)+zipAESMACSize)
+	if size < 0 {
+		return nil, zip.ErrFormat
+	}
+	data := &aesReader{
+		r:      io.LimitReader(raw, size),
+		trail:  raw,
+		stream: newWinZipCTR(block),
+		mac:    hmac.New(sha1.New, key[keySize:2*keySize]),
+	}
+	rc, err := decompress(method, data)
+	if err != nil {
+		return nil, err
+	}
+	rc = &drainReader{ReadCloser: rc, data: data}
+	// AE-2 leaves the CRC out, the authentication code covers the data
+	if version == 2 {
+		return rc, nil
+	}
+	return &crcReader{rc: rc, hash: crc32.NewIEEE(), want: f.CRC32, err: zip.ErrChecksum}, nil
+}
+
+// aesExtra parses the WinZip AES extra field into the AE version, the key
+// size in bytes and the compression method of the data
+func aesExtra(extra []byte) (version, keySize int, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		n := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+n {
+			break
+		}
+		field := extra[4 : 4+n]
+		extra = extra[4+n:]
+		if id != zipAESExtraID || n < 7 {
+			continue
+		}
+
+		switch field[4] {
+		case 1:
+			keySize = 16
+		case 2:
+			keySize = 24
+		case 3:
+			keySize = 32
+		default:
+			return 0, 0, 0, false
+		}
+		return int(binary.LittleEndian.Uint16(field)), keySize, binary.LittleEndian.Uint16(field[5:]), true
+	}
+	return 0, 0, 0, false
+}
+
+// decompress returns a reader of the decompressed data of the methods
+// encrypted entries use
+func decompress(method uint16, r io.Reader) (io.ReadCloser, error) {
+	switch method {
+	case zip.Store:
+		return io.NopCloser(r), nil
+	case zip.Deflate:
+		return flate.NewReader(r), nil
+	}
+	return nil, zip.ErrAlgorithm
+}
+
+// zipCryptoKeys is the state of the traditional PKWARE encryption
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{305419896, 591751049, 878082192}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Update(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Update(k[2], byte(k[1]>>24))
+}
+
+// decrypt decrypts the bytes in place
+func (k *zipCryptoKeys) decrypt(p []byte) {
+	for i, c := range p {
+		t := uint16(k[2] | 2)
+		p[i] = c ^ byte((t*(t^1))>>8)
+		k.update(p[i])
+	}
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.keys.decrypt(p[:n])
+	return n, err
+}
+
+// winZipCTR is the counter mode of WinZip AES, a little-endian counter
+// that starts at one
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.used]
+		c.used++
+	}
+}
+
+// aesReader decrypts the data of an AES entry and checks the
+// authentication code that follows it once the data is read
+type aesReader struct {
+	r      io.Reader
+	trail  io.Reader
+	stream cipher.Stream
+	mac    hash.Hash
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	a.mac.Write(p[:n])
+	a.stream.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		code := make([]byte, zipAESMACSize)
+		if _, rerr := io.ReadFull(a.trail, code); rerr != nil {
+			return n, rerr
+		}
+		if !hmac.Equal(a.mac.Sum(nil)[:zipAESMACSize], code) {
+			return n, zip.ErrChecksum
+		}
+	}
+	return n, err
+}
+
+// drainReader reads the rest of the data once the decompressor is done,
+// the decompressor stops at the end of the stream and the authentication
+// code is only checked at the end of the data
+type drainReader struct {
+	io.ReadCloser
+	data io.Reader
+}
+
+func (d *drainReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if err == io.EOF {
+		if _, derr := io.Copy(io.Discard, d.data); derr != nil {
+			return n, derr
+		}
+	}
+	return n, err
+}
+
+// crcReader checks the CRC of the data once it is read. Data that fails
+// the CRC or cannot be decompressed returns err.
+type crcReader struct {
+	rc   io.ReadCloser
+	hash hash.Hash32
+	want uint32
+	err  error
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	c.hash.Write(p[:n])
+	var corrupt flate.CorruptInputError
+	if (err == io.EOF && c.hash.Sum32() != c.want) || errors.As(err, &corrupt) {
+		return n, c.err
+	}
+	return n, err
+}
+
+func (c *crcReader) Close() error {
+	return c.rc.Close()
+}
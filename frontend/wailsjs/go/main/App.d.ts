@@ -2,12 +2,28 @@
 // This file is automatically generated. DO NOT EDIT
 import {moviedownloader} from '../models';
 
-export function Complete(arg1:number):Promise<void>;
+export function Complete(arg1:string):Promise<void>;
 
-export function Download(arg1:string):Promise<void>;
+export function Delete(arg1:string):Promise<void>;
+
+export function Download(arg1:string,arg2:string):Promise<string>;
+
+export function DownloadSet(arg1:string,arg2:string):Promise<string>;
+
+export function Extract(arg1:string,arg2:string):Promise<void>;
 
 export function GetEndpoint():Promise<string>;
 
+export function ImportNZB():Promise<string>;
+
+export function Preview(arg1:string):Promise<moviedownloader.PreviewResponse>;
+
+export function Remove(arg1:string,arg2:boolean):Promise<void>;
+
+export function Retry(arg1:string,arg2:boolean):Promise<void>;
+
 export function SaveEndpoint(arg1:string):Promise<void>;
 
 export function Search(arg1:string):Promise<moviedownloader.SearchResponse>;
+
+export function Thumbnail(arg1:string,arg2:string):Promise<string>;
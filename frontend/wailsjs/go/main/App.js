@@ -6,14 +6,42 @@ export function Complete(arg1) {
   return window['go']['main']['App']['Complete'](arg1);
 }
 
-export function Download(arg1) {
-  return window['go']['main']['App']['Download'](arg1);
+export function Delete(arg1) {
+  return window['go']['main']['App']['Delete'](arg1);
+}
+
+export function Download(arg1, arg2) {
+  return window['go']['main']['App']['Download'](arg1, arg2);
+}
+
+export function DownloadSet(arg1, arg2) {
+  return window['go']['main']['App']['DownloadSet'](arg1, arg2);
+}
+
+export function Extract(arg1, arg2) {
+  return window['go']['main']['App']['Extract'](arg1, arg2);
 }
 
 export function GetEndpoint() {
   return window['go']['main']['App']['GetEndpoint']();
 }
 
+export function ImportNZB() {
+  return window['go']['main']['App']['ImportNZB']();
+}
+
+export function Preview(arg1) {
+  return window['go']['main']['App']['Preview'](arg1);
+}
+
+export function Remove(arg1, arg2) {
+  return window['go']['main']['App']['Remove'](arg1, arg2);
+}
+
+export function Retry(arg1, arg2) {
+  return window['go']['main']['App']['Retry'](arg1, arg2);
+}
+
 export function SaveEndpoint(arg1) {
   return window['go']['main']['App']['SaveEndpoint'](arg1);
 }
@@ -21,3 +49,7 @@ export function SaveEndpoint(arg1) {
 export function Search(arg1) {
   return window['go']['main']['App']['Search'](arg1);
 }
+
+export function Thumbnail(arg1, arg2) {
+  return window['go']['main']['App']['Thumbnail'](arg1, arg2);
+}
@@ -1,5 +1,43 @@
 export namespace moviedownloader {
 	
+	export class PreviewResponse {
+	    nfo?: string;
+	    image?: number[];
+	    image_type?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new PreviewResponse(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nfo = source["nfo"];
+	        this.image = source["image"];
+	        this.image_type = source["image_type"];
+	    }
+	}
+	export class Episode {
+	    show?: string;
+	    season?: number;
+	    episode?: number;
+	    end_episode?: number;
+	    air_date?: string;
+	    season_pack?: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Episode(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.show = source["show"];
+	        this.season = source["season"];
+	        this.episode = source["episode"];
+	        this.end_episode = source["end_episode"];
+	        this.air_date = source["air_date"];
+	        this.season_pack = source["season_pack"];
+	    }
+	}
 	export class Movie {
 	    id?: string;
 	    filename?: string;
@@ -27,6 +65,29 @@ export namespace moviedownloader {
 	    ts?: number;
 	    sub_languages?: string[];
 	    raw_size?: number;
+	    // Go type: Episode
+	    episode?: any;
+	    already_have?: boolean;
+	    nfo?: string;
+	    thumbnail_width?: number;
+	    thumbnail_height?: number;
+	    thumbnail_url?: string;
+	    expires?: string;
+	    password_protected?: boolean;
+	    volume?: boolean;
+	    sb?: number;
+	    sc?: string;
+	    field_8?: string;
+	    field_35?: string;
+	    size_bytes?: number;
+	    width_pixels?: number;
+	    height_pixels?: number;
+	    runtime_seconds?: number;
+	    post_time?: number;
+	    age_seconds?: number;
+	    expire_time?: number;
+	    expires_in_seconds?: number;
+	    expiring_soon?: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new Movie(source);
@@ -60,7 +121,47 @@ export namespace moviedownloader {
 	        this.ts = source["ts"];
 	        this.sub_languages = source["sub_languages"];
 	        this.raw_size = source["raw_size"];
+	        this.episode = this.convertValues(source["episode"], null);
+	        this.already_have = source["already_have"];
+	        this.nfo = source["nfo"];
+	        this.thumbnail_width = source["thumbnail_width"];
+	        this.thumbnail_height = source["thumbnail_height"];
+	        this.thumbnail_url = source["thumbnail_url"];
+	        this.expires = source["expires"];
+	        this.password_protected = source["password_protected"];
+	        this.volume = source["volume"];
+	        this.sb = source["sb"];
+	        this.sc = source["sc"];
+	        this.field_8 = source["field_8"];
+	        this.field_35 = source["field_35"];
+	        this.size_bytes = source["size_bytes"];
+	        this.width_pixels = source["width_pixels"];
+	        this.height_pixels = source["height_pixels"];
+	        this.runtime_seconds = source["runtime_seconds"];
+	        this.post_time = source["post_time"];
+	        this.age_seconds = source["age_seconds"];
+	        this.expire_time = source["expire_time"];
+	        this.expires_in_seconds = source["expires_in_seconds"];
+	        this.expiring_soon = source["expiring_soon"];
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class SearchResults {
 	    movies?: Movie[];
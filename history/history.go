@@ -0,0 +1,310 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/midgarco/movie_downloader/download"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/probe"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// Record is the history entry of a single download
+type Record struct {
+	ID                    string         `json:"id"`
+	State                 download.State `json:"state"`
+	Filename              string         `json:"filename"`
+	Movie                 *movie.Movie   `json:"movie,omitempty"`
+	RequestedBy           string         `json:"requested_by,omitempty"`
+	Size                  int64          `json:"size"`
+	Duration              time.Duration  `json:"duration"`
+	AverageBytesPerSecond int64          `json:"average_bytes_per_second"`
+	Path                  string         `json:"path,omitempty"`
+	Error                 string         `json:"error,omitempty"`
+	Attempts              int            `json:"attempts"`
+	SHA256                string         `json:"sha256,omitempty"`
+	Media                 *probe.Info    `json:"media,omitempty"`
+	CreatedAt             time.Time      `json:"created_at"`
+	FinishedAt            time.Time      `json:"finished_at"`
+}
+
+// FromDownload builds the history record of the download. The path is the
+// final location of the file, if any.
+func FromDownload(dl download.Download, path string) Record {
+	r := Record{
+		ID:                    dl.ID,
+		State:                 dl.State,
+		Filename:              dl.Filename,
+		Movie:                 dl.Details,
+		RequestedBy:           dl.RequestedBy,
+		Size:                  dl.Size,
+		AverageBytesPerSecond: dl.AverageBytesPerSecond(),
+		Path:                  path,
+		Error:                 dl.Error,
+		Attempts:              dl.Attempts,
+		SHA256:                dl.SHA256,
+		Media:                 dl.Media,
+		CreatedAt:             dl.CreatedAt,
+		FinishedAt:            dl.FinishedAt,
+	}
+	if r.FinishedAt.IsZero() {
+		r.FinishedAt = time.Now()
+	}
+	if !dl.StartedAt.IsZero() {
+		r.Duration = r.FinishedAt.Sub(dl.StartedAt)
+	}
+	return r
+}
+
+// MapToProto ...
+func (r Record) MapToProto() *moviedownloader.HistoryRecord {
+	rec := &moviedownloader.HistoryRecord{
+		Id:                    r.ID,
+		State:                 r.State,
+		Filename:              r.Filename,
+		RequestedBy:           r.RequestedBy,
+		Size:                  r.Size,
+		DurationSeconds:       int64(r.Duration.Seconds()),
+		AverageBytesPerSecond: r.AverageBytesPerSecond,
+		Path:                  r.Path,
+		Error:                 r.Error,
+		Attempts:              int32(r.Attempts),
+		Sha256:                r.SHA256,
+		CreatedAt:             r.CreatedAt.Format(time.RFC3339),
+		FinishedAt:            r.FinishedAt.Format(time.RFC3339),
+	}
+	if r.Movie != nil {
+		rec.Details = r.Movie.MapToProto()
+	}
+	if r.Media != nil {
+		rec.Media = r.Media.MapToProto()
+	}
+	return rec
+}
+
+// Filter selects history records. Zero values match everything.
+type Filter struct {
+	From   time.Time
+	To     time.Time
+	States []download.State
+	Query  string
+}
+
+// Match returns whether the record is selected by the filter
+func (f Filter) Match(r Record) bool {
+	if !f.From.IsZero() && r.FinishedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && r.FinishedAt.After(f.To) {
+		return false
+	}
+	if len(f.States) > 0 {
+		found := false
+		for _, s := range f.States {
+			if s == r.State {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q := strings.TrimSpace(strings.ToLower(f.Query)); q != "" {
+		text := strings.ToLower(strings.Join([]string{r.Filename, r.RequestedBy, r.Path, r.Error}, " "))
+		if r.Movie != nil {
+			text += " " + strings.ToLower(r.Movie.Subject+" "+r.Movie.Group)
+		}
+		if !strings.Contains(text, q) {
+			return false
+		}
+	}
+	return true
+}
+
+// Store keeps the download history in memory and appends every change to a
+// JSON lines file. The last line written for an ID wins when the file is
+// loaded.
+type Store struct {
+	mu       sync.Mutex
+	filename string
+	records  map[string]Record
+}
+
+// Open loads the history file. A missing file results in an empty history.
+func Open(filename string) (*Store, error) {
+	s := &Store{
+		filename: filename,
+		records:  map[string]Record{},
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		r := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// skip a line that was cut short by a crash
+			continue
+		}
+		s.records[r.ID] = r
+	}
+
+	return s, scanner.Err()
+}
+
+// Record stores the record, replacing an earlier record with the same ID
+func (s *Store) Record(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[r.ID] = r
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// List returns the records selected by the filter, newest first, starting
+// at offset and returning at most limit records. A limit of zero returns
+// every remaining record. The total number of matching records is
+// returned as well.
+func (s *Store) List(f Filter, offset, limit int) ([]Record, int) {
+	s.mu.Lock()
+	matched := []Record{}
+	for _, r := range s.records {
+		if f.Match(r) {
+			matched = append(matched, r)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].FinishedAt.Equal(matched[j].FinishedAt) {
+			return matched[i].ID < matched[j].ID
+		}
+		return matched[i].FinishedAt.After(matched[j].FinishedAt)
+	})
+
+	total := len(matched)
+	if offset >= total {
+		return []Record{}, total
+	}
+	matched = matched[offset:]
+	if limit > 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, total
+}
+
+// Purge removes the records that finished before the cutoff and compacts
+// the history file. It returns the number of removed records.
+func (s *Store) Purge(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for id, r := range s.records {
+		if r.FinishedAt.Before(cutoff) {
+			delete(s.records, id)
+			removed++
+		}
+	}
+
+	return removed, s.compact()
+}
+
+// compact rewrites the history file with one line per record. The caller
+// must hold s.mu.
+func (s *Store) compact() error {
+	buf := &bytes.Buffer{}
+	for _, r := range s.records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.filename), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.filename + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename)
+}
+
+// ExportJSON encodes the records as an indented JSON array
+func ExportJSON(records []Record) ([]byte, error) {
+	return json.MarshalIndent(records, "", "  ")
+}
+
+// ExportCSV encodes the records as CSV with a header row
+func ExportCSV(records []Record) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+
+	header := []string{"id", "state", "filename", "requested_by", "size", "duration_seconds", "average_bytes_per_second", "path", "error", "attempts", "created_at", "finished_at", "sha256"}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		row := []string{
+			r.ID,
+			download.StateName(r.State),
+			r.Filename,
+			r.RequestedBy,
+			strconv.FormatInt(r.Size, 10),
+			strconv.FormatInt(int64(r.Duration.Seconds()), 10),
+			strconv.FormatInt(r.AverageBytesPerSecond, 10),
+			r.Path,
+			r.Error,
+			strconv.Itoa(r.Attempts),
+			r.CreatedAt.Format(time.RFC3339),
+			r.FinishedAt.Format(time.RFC3339),
+			r.SHA256,
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
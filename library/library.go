@@ -0,0 +1,157 @@
+package library
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/midgarco/movie_downloader/movie"
+)
+
+// VideoExtensions are the file extensions that are treated as library items
+var VideoExtensions = map[string]bool{
+	".avi":  true,
+	".m2ts": true,
+	".m4v":  true,
+	".mkv":  true,
+	".mov":  true,
+	".mp4":  true,
+	".mpg":  true,
+	".ts":   true,
+	".wmv":  true,
+}
+
+// Index keeps the fingerprints of the video files found in the library
+// folders. It is rescanned lazily once it is older than the refresh
+// interval.
+type Index struct {
+	mu      sync.Mutex
+	paths   []string
+	refresh time.Duration
+	scanned time.Time
+	items   map[string]string
+}
+
+// New creates an index over the given library folders
+func New(refresh time.Duration, paths ...string) *Index {
+	return &Index{
+		paths:   paths,
+		refresh: refresh,
+		items:   map[string]string{},
+	}
+}
+
+// Lookup returns the path of a library file with the same fingerprint as
+// the movie
+func (idx *Index) Lookup(mv movie.Movie) (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if time.Since(idx.scanned) > idx.refresh {
+		idx.scan()
+	}
+
+	p, ok := idx.items[mv.Fingerprint()]
+	return p, ok
+}
+
+// Add records a file that was moved into the library
+func (idx *Index) Add(filename string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, key := range fingerprints(filename) {
+		idx.items[key] = filename
+	}
+}
+
+// Remove forgets a file that was taken out of the library
+func (idx *Index) Remove(filename string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, key := range fingerprints(filename) {
+		if idx.items[key] == filename {
+			delete(idx.items, key)
+		}
+	}
+}
+
+// Contains returns whether the file is located inside one of the library
+// folders, also once the symlinks of the folders it is in are resolved, so
+// a symlinked folder cannot point it outside the library
+func (idx *Index) Contains(filename string) bool {
+	filename = filepath.Clean(filename)
+	dir, err := filepath.EvalSymlinks(filepath.Dir(filename))
+	if err != nil {
+		return false
+	}
+	resolved := filepath.Join(dir, filepath.Base(filename))
+
+	for _, root := range idx.paths {
+		if root == "" || !within(root, filename) {
+			continue
+		}
+		if real, err := filepath.EvalSymlinks(root); err == nil && within(real, resolved) {
+			return true
+		}
+	}
+	return false
+}
+
+// within returns whether the path is below the folder, lexically
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (idx *Index) scan() {
+	items := map[string]string{}
+	seen := map[string]bool{}
+
+	for _, root := range idx.paths {
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// skip unreadable folders instead of aborting the scan
+				if d != nil && d.IsDir() && p != root {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !VideoExtensions[strings.ToLower(filepath.Ext(p))] {
+				return nil
+			}
+			for _, key := range fingerprints(p) {
+				items[key] = p
+			}
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).WithField("path", root).Warn("failed to scan library")
+		}
+	}
+
+	idx.items = items
+	idx.scanned = time.Now()
+}
+
+// fingerprints returns the fingerprint of the file, and when its name looks
+// like a TV episode the fingerprint the series watcher gives the episode
+func fingerprints(filename string) []string {
+	base := filepath.Base(filename)
+	mv := movie.Movie{Filename: strings.TrimSuffix(base, filepath.Ext(base))}
+	keys := []string{mv.Fingerprint()}
+	if ep, ok := movie.ParseEpisode(mv.Filename); ok {
+		mv.EpisodeInfo = ep
+		keys = append(keys, mv.Fingerprint())
+	}
+	return keys
+}
@@ -0,0 +1,57 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContains(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "library")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "Movies"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	idx := New(time.Hour, root)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(root, "Movies", "movie.mkv"), true},
+		{filepath.Join(root, "movie.mkv"), true},
+		{root, false},
+		{filepath.Join(root, "..", "outside", "movie.mkv"), false},
+		{filepath.Join(outside, "movie.mkv"), false},
+		// lexically inside, but the folder is a symlink to the outside
+		{filepath.Join(root, "escape", "movie.mkv"), false},
+	}
+	for _, tt := range tests {
+		if got := idx.Contains(tt.path); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestContainsSymlinkedRoot(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "media")
+	if err := os.Mkdir(real, 0755); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "library")
+	if err := os.Symlink(real, root); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	if !New(time.Hour, root).Contains(filepath.Join(root, "movie.mkv")) {
+		t.Fatal("a file in a symlinked library folder is not contained")
+	}
+}
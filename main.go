@@ -2,27 +2,40 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/google/uuid"
 	"github.com/midgarco/movie_downloader/config"
+	"github.com/midgarco/movie_downloader/download"
 	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
 	"github.com/spf13/viper"
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
+// requestAttempts is how often a download request is sent while the
+// server cannot be reached
+const requestAttempts = 3
+
 var configFile = flag.String("config", os.Getenv("HOME")+"/.pmd/agent.yaml", "The path to the config.yaml file")
 
 func init() {
@@ -55,7 +68,12 @@ type App struct {
 
 	endpoint  string
 	conn      *grpc.ClientConn
-	downloads map[int32]*moviedownloader.Progress
+	downloads map[string]*moviedownloader.Progress
+
+	// progressMu guards cancelProgress, which ends the progress stream so it
+	// is opened again with a new snapshot
+	progressMu     sync.Mutex
+	cancelProgress context.CancelFunc
 }
 
 func (a *App) startup(ctx context.Context) {
@@ -147,21 +165,120 @@ func (a *App) Search(query string) (*moviedownloader.SearchResponse, error) {
 	return results, nil
 }
 
-func (a *App) Download(selected string) error {
+// Download queues the selected movie. The key identifies the click of the
+// user, the frontend passes the same key when the user tries again so the
+// movie is queued once.
+func (a *App) Download(selected string, key string) (string, error) {
+	return a.download(selected, key, false)
+}
+
+// DownloadSet downloads every file of the multi-part post the selected
+// file belongs to
+func (a *App) DownloadSet(selected string, key string) (string, error) {
+	return a.download(selected, key, true)
+}
+
+func (a *App) download(selected string, key string, set bool) (string, error) {
 	movie := &moviedownloader.Movie{}
 	if err := json.Unmarshal([]byte(selected), movie); err != nil {
+		return "", err
+	}
+	if key == "" {
+		key = uuid.NewString()
+	}
+
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+
+	req := &moviedownloader.DownloadRequest{
+		Movie:          movie,
+		IdempotencyKey: key,
+		Set:            set,
+	}
+	var resp *moviedownloader.DownloadResponse
+	err := withRetry(func() (err error) {
+		resp, err = client.Download(context.Background(), req)
 		return err
+	})
+	if err != nil {
+		return "", err
 	}
 
+	return resp.Id, nil
+}
+
+// withRetry sends the request again while the server cannot be reached.
+// The request keeps its idempotency key, so it is queued once even when an
+// attempt reached the server.
+func withRetry(send func() error) error {
+	var err error
+	for attempt := 0; attempt < requestAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err = send(); status.Code(err) != codes.Unavailable {
+			return err
+		}
+	}
+	return err
+}
+
+// Preview fetches the NFO and the preview image of the selected movie
+func (a *App) Preview(selected string) (*moviedownloader.PreviewResponse, error) {
+	movie := &moviedownloader.Movie{}
+	if err := json.Unmarshal([]byte(selected), movie); err != nil {
+		return nil, err
+	}
+
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+	return client.Preview(context.Background(), &moviedownloader.PreviewRequest{Movie: movie})
+}
+
+// Thumbnail returns the preview image of the search result as a data URI
+func (a *App) Thumbnail(id string, name string) (string, error) {
 	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+	resp, err := client.Thumbnail(context.Background(), &moviedownloader.ThumbnailRequest{Id: id, Name: name})
+	if err != nil {
+		return "", err
+	}
+	return "data:" + resp.ContentType + ";base64," + base64.StdEncoding.EncodeToString(resp.Image), nil
+}
+
+// ImportNZB asks for an NZB file and queues its files for download from
+// the news server. An empty id is returned when no file was picked.
+func (a *App) ImportNZB() (string, error) {
+	filename, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Import NZB",
+		Filters: []runtime.FileFilter{
+			{DisplayName: "NZB files (*.nzb)", Pattern: "*.nzb"},
+		},
+	})
+	if err != nil || filename == "" {
+		return "", err
+	}
 
-	req := &moviedownloader.DownloadRequest{Movie: movie}
-	_, err := client.Download(context.Background(), req)
+	b, err := os.ReadFile(filename)
 	if err != nil {
+		return "", err
+	}
+
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+
+	// importing the same file again is the same request
+	sum := sha256.Sum256(b)
+	req := &moviedownloader.ImportNZBRequest{
+		Nzb:            b,
+		IdempotencyKey: "nzb-" + hex.EncodeToString(sum[:]),
+	}
+	var resp *moviedownloader.DownloadResponse
+	err = withRetry(func() (err error) {
+		resp, err = client.ImportNZB(context.Background(), req)
 		return err
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	return resp.Id, nil
 }
 
 func (a *App) domready(ctx context.Context) {
@@ -169,37 +286,113 @@ func (a *App) domready(ctx context.Context) {
 
 	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
 
+	// forward the lifecycle events
+	go a.watchEvents(ctx, client)
+
 	// display download content
-	go func(client moviedownloader.MovieDownloaderServiceClient) {
-		stream, err := client.Progress(ctx, &moviedownloader.ProgressRequest{})
-		if err != nil {
-			runtime.LogErrorf(a.ctx, "Error connecting to pmd service: %v", err)
+	go a.watchProgress(ctx, client)
+}
+
+// watchProgress forwards the download progress to the frontend. The stream
+// starts with a snapshot of the downloads, and is opened again when
+// resnapshot asks for a new one.
+func (a *App) watchProgress(ctx context.Context, client moviedownloader.MovieDownloaderServiceClient) {
+	for {
+		streamCtx, cancel := context.WithCancel(ctx)
+		a.progressMu.Lock()
+		a.cancelProgress = cancel
+		a.progressMu.Unlock()
+
+		a.streamProgress(streamCtx, client)
+		cancel()
+		if streamCtx.Err() == nil || ctx.Err() != nil {
+			// the server connection was lost
 			return
 		}
+		runtime.LogInfo(a.ctx, "Taking a new snapshot of the downloads")
+	}
+}
 
-		log.Infof("Connected to progress stream %s", viper.GetString("GRPC_ENDPOINT"))
-		for {
-			res, err := stream.Recv()
-			if err == io.EOF {
-				runtime.LogWarning(a.ctx, "Server connection lost")
-				break
-			}
-			if err != nil {
-				runtime.LogErrorf(a.ctx, "Failure receiving progress updates: %v", err)
-				continue
-			}
+// resnapshot replaces the downloads with a new snapshot from the server
+func (a *App) resnapshot() {
+	a.progressMu.Lock()
+	defer a.progressMu.Unlock()
+	if a.cancelProgress != nil {
+		a.cancelProgress()
+	}
+}
+
+func (a *App) streamProgress(ctx context.Context, client moviedownloader.MovieDownloaderServiceClient) {
+	stream, err := client.Progress(ctx, &moviedownloader.ProgressRequest{})
+	if err != nil {
+		runtime.LogErrorf(a.ctx, "Error connecting to pmd service: %v", err)
+		return
+	}
+
+	log.Infof("Connected to progress stream %s", viper.GetString("GRPC_ENDPOINT"))
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			runtime.LogWarning(a.ctx, "Server connection lost")
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			runtime.LogErrorf(a.ctx, "Failure receiving progress updates: %v", err)
+			continue
+		}
+
+		if res == nil {
+			continue
+		}
+
+		a.downloads = download.MergeProgress(a.downloads, res)
+		runtime.EventsEmit(ctx, "progress", a.downloads)
+	}
+}
 
-			if res == nil {
-				continue
+// watchEvents forwards the server lifecycle events to the frontend,
+// resuming after the last received event whenever the stream has to be
+// reconnected
+func (a *App) watchEvents(ctx context.Context, client moviedownloader.MovieDownloaderServiceClient) {
+	req := &moviedownloader.WatchEventsRequest{}
+	for {
+		stream, err := client.WatchEvents(ctx, req)
+		if err != nil {
+			runtime.LogErrorf(a.ctx, "Error connecting to event stream: %v", err)
+		} else {
+			for {
+				ev, err := stream.Recv()
+				if err != nil {
+					if err != io.EOF {
+						runtime.LogErrorf(a.ctx, "Failure receiving events: %v", err)
+					}
+					break
+				}
+				req.StreamId = ev.StreamId
+				req.AfterSequence = ev.Sequence
+				if ev.Type == moviedownloader.EventType_EVENT_TYPE_RESET {
+					// events were missed, the downloads may be out of date
+					a.resnapshot()
+				}
+
+				name := strings.ToLower(strings.TrimPrefix(ev.Type.String(), "EVENT_TYPE_"))
+				runtime.EventsEmit(ctx, "event", name, ev)
 			}
+		}
 
-			a.downloads = res.ActiveDownloads
-			runtime.EventsEmit(ctx, "progress", a.downloads)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+			runtime.LogWarning(a.ctx, "Reconnecting to event stream")
 		}
-	}(client)
+	}
 }
 
-func (a *App) Complete(id int32) error {
+func (a *App) Complete(id string) error {
 	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
 
 	req := &moviedownloader.CompletedRequest{CompletedId: id}
@@ -209,3 +402,40 @@ func (a *App) Complete(id int32) error {
 	}
 	return nil
 }
+
+// Retry re-queues a failed download
+func (a *App) Retry(id string, useFallback bool) error {
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+
+	req := &moviedownloader.RetryRequest{Id: id, UseFallback: useFallback}
+	_, err := client.Retry(context.Background(), req)
+	return err
+}
+
+// Extract extracts the archives of a download that failed post-processing
+// again, with a new password when one is given
+func (a *App) Extract(id string, password string) error {
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+
+	req := &moviedownloader.ExtractRequest{Id: id, Password: password}
+	_, err := client.Extract(context.Background(), req)
+	return err
+}
+
+// Remove dismisses a download that is not in progress
+func (a *App) Remove(id string, deleteData bool) error {
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+
+	req := &moviedownloader.RemoveRequest{Id: id, DeleteData: deleteData}
+	_, err := client.Remove(context.Background(), req)
+	return err
+}
+
+// Delete moves a completed download into the recycle bin
+func (a *App) Delete(id string) error {
+	client := moviedownloader.NewMovieDownloaderServiceClient(a.conn)
+
+	req := &moviedownloader.DeleteRequest{CompletedId: id}
+	_, err := client.Delete(context.Background(), req)
+	return err
+}
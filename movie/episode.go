@@ -0,0 +1,201 @@
+package movie
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// Episode describes the TV information parsed out of a release name
+type Episode struct {
+	Show       string
+	Season     int
+	Episode    int
+	EndEpisode int
+	AirDate    time.Time
+	SeasonPack bool
+}
+
+var (
+	// Show.Name.S01E02, S01E02E03 and S01E02-E03
+	seasonEpisodeRegex = regexp.MustCompile(`(?i)^(.*?)[\s._-]+s(\d{1,2})[\s._-]?e(\d{1,3})(?:(?:-e?|e)(\d{1,3}))?(?:[\s._-]|$)`)
+	// Show.Name.1x02 and 1x02-03
+	crossEpisodeRegex = regexp.MustCompile(`(?i)^(.*?)[\s._-]+(\d{1,2})x(\d{2,3})(?:-(\d{2,3}))?(?:[\s._-]|$)`)
+	// Show.Name.2024.01.15
+	dateEpisodeRegex = regexp.MustCompile(`^(.*?)[\s._-]+((?:19|20)\d{2})[\s._-](\d{2})[\s._-](\d{2})(?:[\s._-]|$)`)
+	// Show.Name.S01, Show.Name.S01.COMPLETE and Show.Name.Season.1
+	seasonPackRegex = regexp.MustCompile(`(?i)^(.*?)[\s._-]+(?:s(\d{1,2})|season[\s._-]?(\d{1,2}))(?:[\s._-]|$)`)
+	// the patterns DetectEpisode accepts: S01E02, 1x02 but not 5x264, air
+	// dates and S01 but not S1 or Season.1
+	detectRegex = regexp.MustCompile(`(?i)[\s._-](?:s\d{1,2}[\s._-]?e\d{1,3}|(?:\d{1,2}x\d{2}|(?:19|20)\d{2}[\s._-]\d{2}[\s._-]\d{2}|s\d{2})(?:[\s._-]|$))`)
+
+	separatorRegex = regexp.MustCompile(`[\s._]+`)
+	yearRegex      = regexp.MustCompile(`\s*\(?((?:19|20)\d{2})\)?$`)
+)
+
+// ParseEpisode extracts the show, season and episode information from a
+// release name. The second return value is false when the name does not
+// look like a TV release.
+func ParseEpisode(name string) (*Episode, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, false
+	}
+
+	if m := seasonEpisodeRegex.FindStringSubmatch(name); m != nil {
+		ep := &Episode{
+			Show:    cleanShowName(m[1]),
+			Season:  atoi(m[2]),
+			Episode: atoi(m[3]),
+		}
+		if m[4] != "" {
+			ep.EndEpisode = atoi(m[4])
+		}
+		return ep.valid()
+	}
+
+	if m := crossEpisodeRegex.FindStringSubmatch(name); m != nil {
+		ep := &Episode{
+			Show:    cleanShowName(m[1]),
+			Season:  atoi(m[2]),
+			Episode: atoi(m[3]),
+		}
+		if m[4] != "" {
+			ep.EndEpisode = atoi(m[4])
+		}
+		return ep.valid()
+	}
+
+	if m := dateEpisodeRegex.FindStringSubmatch(name); m != nil {
+		aired, err := time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%s", m[2], m[3], m[4]))
+		if err == nil {
+			ep := &Episode{
+				Show:    cleanShowName(m[1]),
+				Season:  aired.Year(),
+				AirDate: aired,
+			}
+			return ep.valid()
+		}
+	}
+
+	if m := seasonPackRegex.FindStringSubmatch(name); m != nil {
+		season := m[2]
+		if season == "" {
+			season = m[3]
+		}
+		ep := &Episode{
+			Show:       cleanShowName(m[1]),
+			Season:     atoi(season),
+			SeasonPack: true,
+		}
+		return ep.valid()
+	}
+
+	return nil, false
+}
+
+// DetectEpisode parses the episode information from a release name, but
+// only when it uses one of the patterns that rarely show up in movie
+// names: S01E02, 1x02, an air date or a season pack like S01
+func DetectEpisode(name string) (*Episode, bool) {
+	if !detectRegex.MatchString(name) {
+		return nil, false
+	}
+	return ParseEpisode(name)
+}
+
+func (e *Episode) valid() (*Episode, bool) {
+	if e.Show == "" {
+		return nil, false
+	}
+	if e.EndEpisode != 0 && e.EndEpisode <= e.Episode {
+		e.EndEpisode = 0
+	}
+	return e, true
+}
+
+// IsDaily returns whether the episode is identified by air date rather than
+// by an episode number
+func (e Episode) IsDaily() bool {
+	return !e.AirDate.IsZero()
+}
+
+// Key returns a stable identifier for the episode that can be used to
+// remember which episodes of a show have already been grabbed
+func (e Episode) Key() string {
+	switch {
+	case e.IsDaily():
+		return e.AirDate.Format("2006-01-02")
+	case e.SeasonPack:
+		return e.SeasonKey()
+	default:
+		return fmt.Sprintf("S%02dE%02d", e.Season, e.Episode)
+	}
+}
+
+// SeasonKey returns the identifier of the whole season
+func (e Episode) SeasonKey() string {
+	return fmt.Sprintf("S%02d", e.Season)
+}
+
+// SeasonFolder returns the library folder for the episode season
+func (e Episode) SeasonFolder() string {
+	return fmt.Sprintf("Season %02d", e.Season)
+}
+
+// MapToProto ...
+func (e Episode) MapToProto() *moviedownloader.Episode {
+	ep := &moviedownloader.Episode{
+		Show:       e.Show,
+		Season:     int32(e.Season),
+		Episode:    int32(e.Episode),
+		EndEpisode: int32(e.EndEpisode),
+		SeasonPack: e.SeasonPack,
+	}
+	if e.IsDaily() {
+		ep.AirDate = e.AirDate.Format("2006-01-02")
+	}
+	return ep
+}
+
+// MapEpisodeFromProto maps the proto episode back to the episode, nil when
+// the movie is not an episode
+func MapEpisodeFromProto(e *moviedownloader.Episode) *Episode {
+	if e == nil {
+		return nil
+	}
+	ep := &Episode{
+		Show:       e.Show,
+		Season:     int(e.Season),
+		Episode:    int(e.Episode),
+		EndEpisode: int(e.EndEpisode),
+		SeasonPack: e.SeasonPack,
+	}
+	if aired, err := time.Parse("2006-01-02", e.AirDate); err == nil {
+		ep.AirDate = aired
+	}
+	return ep
+}
+
+// NormalizeTitle lowercases the title and collapses release separators so
+// that names from different posts can be compared
+func NormalizeTitle(title string) string {
+	title = separatorRegex.ReplaceAllString(strings.ToLower(title), " ")
+	return strings.TrimSpace(title)
+}
+
+func cleanShowName(name string) string {
+	name = separatorRegex.ReplaceAllString(name, " ")
+	name = strings.Trim(name, " -_")
+	name = yearRegex.ReplaceAllString(name, " ($1)")
+	return strings.TrimSpace(name)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
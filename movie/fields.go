@@ -0,0 +1,122 @@
+package movie
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+var (
+	// runtimeRegex matches runtimes like 1:52:03, 52:03 and 1h 52m 3s
+	runtimeRegex = regexp.MustCompile(`^(?:(\d+):)?(\d+):(\d+)$|^(?:(\d+)\s*h)?[\s:]*(?:(\d+)\s*m)?[\s:]*(?:(\d+)\s*s)?$`)
+	// resolutionRegex matches resolutions like 1920 x 1080 and 1920x1080
+	resolutionRegex = regexp.MustCompile(`(\d{2,5})\s*[xX×]\s*(\d{2,5})`)
+)
+
+// postDateLayouts are the formats the post and expiry dates are written
+// in, by the provider and by the NZB import
+var postDateLayouts = []string{
+	time.DateTime,
+	time.RFC3339,
+	"01-02-2006 15:04:05",
+	"01-02-2006 15:04",
+	time.DateOnly,
+	"01-02-2006",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+}
+
+// Bytes returns the size of the file in bytes, from the raw size or else
+// parsed from the human readable size, e.g. 1.4 GB
+func (m Movie) Bytes() int64 {
+	if m.RawSize > 0 {
+		return int64(m.RawSize)
+	}
+	n, err := humanize.ParseBytes(strings.TrimSpace(m.Size))
+	if err != nil {
+		return 0
+	}
+	return int64(n)
+}
+
+// Dimensions returns the width and height of the video in pixels, from the
+// width and height or else parsed from the resolution. Unknown dimensions
+// are zero.
+func (m Movie) Dimensions() (width, height int) {
+	width, _ = strconv.Atoi(strings.TrimSpace(m.Width))
+	height, _ = strconv.Atoi(strings.TrimSpace(m.Height))
+	if width > 0 && height > 0 {
+		return width, height
+	}
+	for _, res := range []string{m.Fullres, m.Resolution} {
+		if r := resolutionRegex.FindStringSubmatch(res); r != nil {
+			width, _ = strconv.Atoi(r[1])
+			height, _ = strconv.Atoi(r[2])
+			return width, height
+		}
+	}
+	return width, height
+}
+
+// RuntimeDuration parses the runtime, e.g. 1:52:03 or 1h 52m 3s
+func (m Movie) RuntimeDuration() (time.Duration, bool) {
+	s := strings.ToLower(strings.TrimSpace(m.Runtime))
+	r := runtimeRegex.FindStringSubmatch(s)
+	if s == "" || r == nil {
+		return 0, false
+	}
+
+	n := func(v string) time.Duration {
+		i, _ := strconv.Atoi(v)
+		return time.Duration(i)
+	}
+	var d time.Duration
+	if r[2] != "" {
+		d = n(r[1])*time.Hour + n(r[2])*time.Minute + n(r[3])*time.Second
+	} else {
+		d = n(r[4])*time.Hour + n(r[5])*time.Minute + n(r[6])*time.Second
+	}
+	return d, d > 0
+}
+
+// PostTime parses the post date, which is in UTC
+func (m Movie) PostTime() (time.Time, bool) {
+	return parseDate(m.PostDate)
+}
+
+// ExpiresAt returns when the provider drops the post: the expiry date the
+// provider advertised or else the post date plus the retention of the
+// provider. A zero retention means it is not known.
+func (m Movie) ExpiresAt(retention time.Duration) (time.Time, bool) {
+	if t, ok := parseDate(m.Expires); ok {
+		return t, true
+	}
+	if retention <= 0 {
+		return time.Time{}, false
+	}
+	if t, ok := m.PostTime(); ok {
+		return t.Add(retention), true
+	}
+	return time.Time{}, false
+}
+
+// parseDate parses a date in one of the post date layouts, or in seconds
+// since the Unix epoch
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0).UTC(), n > 0
+	}
+	for _, layout := range postDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,55 @@
+package movie
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	qualityRegex = regexp.MustCompile(`(?i)(?:^|[\s._\-\[(])(2160|1080|720|576|480)[pi](?:$|[\s._\-\])])`)
+	// everything after the year or the first release tag is not part of the
+	// title
+	titleEndRegex = regexp.MustCompile(`(?i)[\s._\-\[(]+(?:(?:19|20)\d{2}[\s._\-\])]|(?:19|20)\d{2}$|2160p|1080[pi]|720p|576[pi]|480[pi]|4k|uhd|hdr|bluray|blu-ray|brrip|bdrip|web-?dl|webrip|hdtv|dvdrip|remux|x264|x265|h264|h265|hevc|proper|repack)`)
+	yearTagRegex  = regexp.MustCompile(`(?:^|[\s._\-\[(])((?:19|20)\d{2})(?:$|[\s._\-\])])`)
+)
+
+// Quality returns the vertical resolution tag of the release, e.g. 1080p.
+// The filename is preferred over the provider height because it describes
+// the release rather than the encode.
+func (m Movie) Quality() string {
+	if q := qualityRegex.FindStringSubmatch(m.Filename); q != nil {
+		return q[1] + "p"
+	}
+	switch strings.TrimSpace(m.Height) {
+	case "2160", "1080", "720", "576", "480":
+		return strings.TrimSpace(m.Height) + "p"
+	}
+	return ""
+}
+
+// Title returns the normalized title of the release. Releases recognised as
+// episodes are titled by show and episode key so that different releases
+// of the same episode compare equal.
+func (m Movie) Title() string {
+	if ep, ok := m.Episode(); ok {
+		return NormalizeTitle(ep.Show + " " + ep.Key())
+	}
+
+	title := m.Filename
+	if loc := titleEndRegex.FindStringIndex(title); loc != nil && loc[0] > 0 {
+		title = title[:loc[0]]
+	}
+	title = NormalizeTitle(title)
+
+	if y := yearTagRegex.FindStringSubmatch(m.Filename); y != nil && !strings.HasSuffix(title, y[1]) {
+		title = title + " " + y[1]
+	}
+
+	return title
+}
+
+// Fingerprint identifies the release by normalized title and quality so
+// that different posts of the same movie can be detected as duplicates
+func (m Movie) Fingerprint() string {
+	return m.Title() + "|" + m.Quality()
+}
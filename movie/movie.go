@@ -1,6 +1,8 @@
 package movie
 
 import (
+	"math"
+
 	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
 )
 
@@ -47,10 +49,22 @@ type Movie struct {
 	Virus       bool     `json:"virus,omitempty"`
 	Volume      bool     `json:"volume,omitempty"`
 	Width       string   `json:"width,omitempty"`
+
+	// EpisodeInfo is the TV episode the release was recognised as, by the
+	// series watcher or by DetectEpisode. The name alone is never treated as
+	// an episode, the looser episode patterns match too many movie names.
+	EpisodeInfo *Episode `json:"episode,omitempty"`
+
+	// ThumbnailURL is the path the server proxies the preview image at,
+	// /thumbs/{id}?name=..., when the provider has one
+	ThumbnailURL string `json:"thumbnailURL,omitempty"`
 }
 
+// MapToProto maps every field of the movie, along with the numeric fields
+// parsed from the text fields. MapFromProtoObject maps the result back to
+// the same movie.
 func (m Movie) MapToProto() *moviedownloader.Movie {
-	return &moviedownloader.Movie{
+	mv := &moviedownloader.Movie{
 		Id:             m.ID,
 		Filename:       m.Filename,
 		Extension:      m.Extension,
@@ -61,8 +75,10 @@ func (m Movie) MapToProto() *moviedownloader.Movie {
 		Width:          m.Width,
 		Height:         m.Height,
 		Subject:        m.Subject,
+		Poster:         m.Poster,
 		Group:          m.Group,
 		PostDate:       m.PostDate,
+		Expires:        m.Expires,
 
 		Codec:          m.VideoCodec,
 		AudioCodec:     m.AudioCodec,
@@ -72,37 +88,99 @@ func (m Movie) MapToProto() *moviedownloader.Movie {
 		SampleRate:     int32(m.SampleRate),
 		Fps:            m.FPS,
 
-		Virus: m.Virus,
-		Type:  m.Type,
+		Virus:             m.Virus,
+		Type:              m.Type,
+		Ts:                int32(m.Ts),
+		PasswordProtected: m.Passwd,
+		Volume:            m.Volume,
+
+		PrimaryUrl:  m.PrimaryURL,
+		FallbackUrl: m.FallbackURL,
+
+		Nfo:             m.Nfo,
+		ThumbnailWidth:  int32(m.Twidth),
+		ThumbnailHeight: int32(m.Theight),
+		ThumbnailUrl:    m.ThumbnailURL,
+
+		Sb:       int32(m.Sb),
+		Sc:       m.Sc,
+		Field_8:  m.Eight,
+		Field_35: m.Three5,
+
+		SizeBytes: m.Bytes(),
+	}
+	if m.RawSize <= math.MaxInt32 {
+		mv.RawSize = int32(m.RawSize)
+	}
+	width, height := m.Dimensions()
+	mv.WidthPixels, mv.HeightPixels = int32(width), int32(height)
+	if d, ok := m.RuntimeDuration(); ok {
+		mv.RuntimeSeconds = int64(d.Seconds())
 	}
+	if t, ok := m.PostTime(); ok {
+		mv.PostTime = t.Unix()
+	}
+
+	if ep, ok := m.Episode(); ok {
+		mv.Episode = ep.MapToProto()
+	}
+
+	return mv
 }
 
+// Episode returns the TV episode the release was recognised as
+func (m Movie) Episode() (*Episode, bool) {
+	return m.EpisodeInfo, m.EpisodeInfo != nil
+}
+
+// MapFromProtoObject maps the proto movie back to the movie. The parsed
+// numeric fields are derived from the text fields and ignored, except for
+// size_bytes which wins over raw_size when set, it holds the raw size of
+// files too large for raw_size.
 func MapFromProtoObject(m *moviedownloader.Movie) (*Movie, error) {
+	rawSize := int(m.RawSize)
+	if m.SizeBytes > 0 {
+		rawSize = int(m.SizeBytes)
+	}
+
 	return &Movie{
-		ID:          m.Id,
-		Filename:    m.Filename,
-		VideoCodec:  m.Codec,
-		Runtime:     m.Runtime,
-		BPS:         int(m.Bps),
-		SampleRate:  int(m.SampleRate),
-		FPS:         m.Fps,
-		AudioCodec:  m.AudioCodec,
-		Extension:   m.Extension,
-		Resolution:  m.Resolution,
-		Size:        m.Size,
-		PostDate:    m.PostDate,
-		Subject:     m.Subject,
-		Poster:      m.Poster,
-		Group:       m.Group,
-		Alangs:      m.AudioLanguages,
-		FallbackURL: m.FallbackUrl,
-		Fullres:     m.FullResolution,
-		Height:      m.Height,
-		PrimaryURL:  m.PrimaryUrl,
-		RawSize:     int(m.RawSize),
-		Slangs:      m.SubLanguages,
-		Type:        m.Type,
-		Virus:       m.Virus,
-		Width:       m.Width,
+		ID:           m.Id,
+		Filename:     m.Filename,
+		VideoCodec:   m.Codec,
+		Runtime:      m.Runtime,
+		BPS:          int(m.Bps),
+		SampleRate:   int(m.SampleRate),
+		FPS:          m.Fps,
+		AudioCodec:   m.AudioCodec,
+		Extension:    m.Extension,
+		Resolution:   m.Resolution,
+		Three5:       m.Field_35,
+		Size:         m.Size,
+		PostDate:     m.PostDate,
+		Subject:      m.Subject,
+		Poster:       m.Poster,
+		Eight:        m.Field_8,
+		Group:        m.Group,
+		Alangs:       m.AudioLanguages,
+		Expires:      m.Expires,
+		FallbackURL:  m.FallbackUrl,
+		Fullres:      m.FullResolution,
+		Height:       m.Height,
+		Nfo:          m.Nfo,
+		Passwd:       m.PasswordProtected,
+		PrimaryURL:   m.PrimaryUrl,
+		RawSize:      rawSize,
+		Sb:           int(m.Sb),
+		Sc:           m.Sc,
+		Slangs:       m.SubLanguages,
+		Theight:      int(m.ThumbnailHeight),
+		Ts:           int(m.Ts),
+		Twidth:       int(m.ThumbnailWidth),
+		ThumbnailURL: m.ThumbnailUrl,
+		Type:         m.Type,
+		Virus:        m.Virus,
+		Volume:       m.Volume,
+		Width:        m.Width,
+		EpisodeInfo:  MapEpisodeFromProto(m.Episode),
 	}, nil
 }
@@ -0,0 +1,170 @@
+package movie
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// fullMovie returns a movie with every field set, so a field the mapping
+// misses shows up as a difference
+func fullMovie() Movie {
+	return Movie{
+		ID:           "0123456789abcdef",
+		Filename:     "Some.Movie.2020.1080p.BluRay.x264",
+		VideoCodec:   "h264",
+		Runtime:      "1:52:03",
+		BPS:          8000,
+		SampleRate:   48000,
+		FPS:          23.976,
+		AudioCodec:   "aac",
+		Extension:    ".mkv",
+		Resolution:   "1920 x 1080",
+		Three5:       "35",
+		Size:         "1.4 GB",
+		PostDate:     "2024-01-02 03:04:05",
+		Subject:      `"Some.Movie.2020.1080p.BluRay.x264.mkv" yEnc (1/100)`,
+		Poster:       "poster@example.com",
+		Eight:        "8",
+		Group:        "alt.binaries.movies",
+		Alangs:       []string{"en", "fr"},
+		Expires:      "2025-01-02 03:04:05",
+		FallbackURL:  "https://fallback.example.com/dl/movie.mkv",
+		Fullres:      "1920 x 1080",
+		Height:       "1080",
+		Nfo:          "release notes",
+		Passwd:       true,
+		PrimaryURL:   "https://primary.example.com/dl/movie.mkv",
+		RawSize:      1503238553,
+		Sb:           1,
+		Sc:           "sc",
+		Slangs:       []string{"en"},
+		Theight:      90,
+		Ts:           1704164645,
+		Twidth:       160,
+		Type:         "VIDEO",
+		Virus:        true,
+		Volume:       true,
+		Width:        "1920",
+		EpisodeInfo:  &Episode{Show: "Some Show", Season: 1, Episode: 2, EndEpisode: 3},
+		ThumbnailURL: "/thumbs/0123456789abcdef",
+	}
+}
+
+func TestFullMovieSetsEveryField(t *testing.T) {
+	v := reflect.ValueOf(fullMovie())
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Errorf("fullMovie does not set %s", v.Type().Field(i).Name)
+		}
+	}
+}
+
+func TestMapToProtoRoundTrip(t *testing.T) {
+	m := fullMovie()
+	got, err := MapFromProtoObject(m.MapToProto())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, m) {
+		t.Fatalf("round trip changed the movie:\ngot  %+v\nwant %+v", *got, m)
+	}
+}
+
+func TestMapToProtoLargeFile(t *testing.T) {
+	m := fullMovie()
+	m.RawSize = math.MaxInt32 + 1000
+	m.Size = "2 GB"
+
+	p := m.MapToProto()
+	if p.RawSize != 0 || p.SizeBytes != int64(m.RawSize) {
+		t.Fatalf("raw_size = %d, size_bytes = %d", p.RawSize, p.SizeBytes)
+	}
+	got, err := MapFromProtoObject(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, m) {
+		t.Fatalf("round trip changed the movie:\ngot  %+v\nwant %+v", *got, m)
+	}
+}
+
+func TestMapToProtoDerivedFields(t *testing.T) {
+	p := fullMovie().MapToProto()
+	if p.SizeBytes != 1503238553 || p.WidthPixels != 1920 || p.HeightPixels != 1080 {
+		t.Fatalf("size_bytes = %d, dimensions = %dx%d", p.SizeBytes, p.WidthPixels, p.HeightPixels)
+	}
+	if p.RuntimeSeconds != 6723 || p.PostTime != 1704164645 {
+		t.Fatalf("runtime_seconds = %d, post_time = %d", p.RuntimeSeconds, p.PostTime)
+	}
+
+	// size_bytes wins over raw_size when set
+	p.RawSize, p.SizeBytes = 100, 200
+	got, _ := MapFromProtoObject(p)
+	if got.RawSize != 200 {
+		t.Fatalf("raw size = %d, want size_bytes", got.RawSize)
+	}
+	p.SizeBytes = 0
+	got, _ = MapFromProtoObject(p)
+	if got.RawSize != 100 {
+		t.Fatalf("raw size = %d, want raw_size", got.RawSize)
+	}
+}
+
+func TestMapEpisodeRoundTrip(t *testing.T) {
+	for _, name := range []string{"Some.Show.S01E02.1080p", "Some.Show.2024.01.15.720p", "Some.Show.S03.COMPLETE"} {
+		ep, ok := ParseEpisode(name)
+		if !ok {
+			t.Fatalf("%s is not an episode", name)
+		}
+		if got := MapEpisodeFromProto(ep.MapToProto()); !reflect.DeepEqual(got, ep) {
+			t.Fatalf("round trip of %s = %+v, want %+v", name, got, ep)
+		}
+	}
+	if MapEpisodeFromProto(nil) != nil {
+		t.Fatal("mapped a missing episode")
+	}
+}
+
+func TestTitleIgnoresEpisodePatterns(t *testing.T) {
+	// movie names the episode patterns match
+	for name, want := range map[string]string{
+		"Mission.Impossible.Season.1.1996.1080p": "mission impossible season 1 1996",
+		"The.Movie.S1.2019.1080p":                "the movie s1 2019",
+		"Fast.5x264.2011.720p":                   "fast 5x264 2011",
+	} {
+		if got := (Movie{Filename: name}).Title(); got != want {
+			t.Errorf("Title(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	ep, _ := ParseEpisode("Some.Show.S01E02.Pilot.1080p")
+	m := Movie{Filename: "Some.Show.S01E02.Pilot.1080p", EpisodeInfo: ep}
+	if got := m.Title(); got != "some show s01e02" {
+		t.Fatalf("episode title = %q", got)
+	}
+}
+
+func TestDetectEpisode(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"Some.Show.S01E02.1080p", "S01E02"},
+		{"Some.Show.S01E02E03.720p", "S01E02"},
+		{"Some.Show.1x02.HDTV", "S01E02"},
+		{"Some.Show.2024.01.15.720p", "2024-01-15"},
+		{"Some.Show.S03.COMPLETE.1080p", "S03"},
+		// movie names the looser patterns match
+		{"Mission.Impossible.Season.1.1996.1080p", ""},
+		{"The.Movie.S1.2019.1080p", ""},
+		{"Fast.5x264.2011.720p", ""},
+		{"Some.Movie.2019.1080p", ""},
+	}
+	for _, tt := range tests {
+		ep, ok := DetectEpisode(tt.name)
+		if ok != (tt.key != "") || (ok && ep.Key() != tt.key) {
+			t.Errorf("DetectEpisode(%q) = %+v, %v, want %q", tt.name, ep, ok, tt.key)
+		}
+	}
+}
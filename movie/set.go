@@ -0,0 +1,101 @@
+package movie
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// volumeNameRegex matches the volume suffix of the filename, e.g.
+	// name.part01 of name.part01.rar or name.vol03+04 of name.vol03+04.par2
+	volumeNameRegex = regexp.MustCompile(`(?i)\.(part|vol)(\d+)(?:\+\d+)?$`)
+	// volumeExtRegex matches the extensions of the files of a multi-part
+	// post: .rar, .r00, .001, .zip, .7z, .par2 and .sfv
+	volumeExtRegex = regexp.MustCompile(`(?i)^\.(rar|r(\d{2,3})|(\d{3})|zip|7z|par2|sfv)$`)
+	// splitNameRegex matches the archive or container extension left in the
+	// filename of split files, e.g. name.7z of name.7z.001
+	splitNameRegex = regexp.MustCompile(`(?i)\.(7z|zip|rar|mkv|mp4|avi|ts)$`)
+)
+
+// IsVolume returns whether the file is one of the files of a multi-part
+// post, e.g. a RAR volume or a PAR2 recovery file
+func (m Movie) IsVolume() bool {
+	return m.Volume || volumeExtRegex.MatchString(m.Extension) || volumeNameRegex.MatchString(m.Filename)
+}
+
+// SetName returns the name the files of a multi-part post share, e.g.
+// Movie.2020.1080p for Movie.2020.1080p.part01.rar and Movie.2020.1080p.r00
+func (m Movie) SetName() string {
+	name := volumeNameRegex.ReplaceAllString(m.Filename, "")
+	if ext := volumeExtRegex.FindStringSubmatch(m.Extension); ext != nil && ext[3] != "" {
+		name = splitNameRegex.ReplaceAllString(name, "")
+	}
+	return name
+}
+
+// volumeOrder sorts the archive volumes first, in the order they are
+// extracted, followed by the recovery and checksum files
+func (m Movie) volumeOrder() (int, int) {
+	number := -1
+	if v := volumeNameRegex.FindStringSubmatch(m.Filename); v != nil {
+		number, _ = strconv.Atoi(v[2])
+	}
+
+	ext := volumeExtRegex.FindStringSubmatch(m.Extension)
+	switch {
+	case ext == nil:
+		return 0, number
+	case ext[2] != "":
+		// old style volumes follow the .rar file: .rar, .r00, .r01, ...
+		n, _ := strconv.Atoi(ext[2])
+		return 0, n
+	case ext[3] != "":
+		n, _ := strconv.Atoi(ext[3])
+		return 0, n
+	case strings.EqualFold(ext[1], "par2"):
+		return 1, number
+	case strings.EqualFold(ext[1], "sfv"):
+		return 2, number
+	}
+	return 0, number
+}
+
+// SetMembers returns the files of the multi-part post the movie belongs to,
+// picked from the candidates by set name and poster and sorted in volume
+// order. The movie itself is always part of the set.
+func SetMembers(mv Movie, candidates []Movie) []Movie {
+	name := mv.SetName()
+	seen := map[string]bool{mv.ID: true}
+	members := []Movie{mv}
+
+	for _, c := range candidates {
+		if seen[c.ID] || !c.IsVolume() || !strings.EqualFold(c.SetName(), name) {
+			continue
+		}
+		if mv.Poster != "" && c.Poster != mv.Poster {
+			continue
+		}
+		seen[c.ID] = true
+		members = append(members, c)
+	}
+
+	SortVolumes(members)
+	return members
+}
+
+// SortVolumes sorts the files of a multi-part post in volume order
+func SortVolumes(members []Movie) {
+	sort.SliceStable(members, func(i, j int) bool {
+		ri, ni := members[i].volumeOrder()
+		rj, nj := members[j].volumeOrder()
+		if ri != rj {
+			return ri < rj
+		}
+		if ni != nj {
+			return ni < nj
+		}
+		return members[i].Filename+members[i].Extension < members[j].Filename+members[j].Extension
+	})
+}
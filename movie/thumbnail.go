@@ -0,0 +1,47 @@
+package movie
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Thumbnails is where the provider serves the preview images of the posts.
+// The search results advertise the base URLs, which are protocol relative,
+// e.g. //th.easynews.com/thumbnails-
+type Thumbnails struct {
+	BaseURL      string
+	LargeBaseURL string
+}
+
+// DefaultThumbnails is used until the provider advertised the thumbnail
+// servers
+var DefaultThumbnails = Thumbnails{
+	BaseURL: "//th.easynews.com/thumbnails-",
+}
+
+// URL returns the URL of the small preview image of the movie
+func (t Thumbnails) URL(m Movie) string {
+	return thumbnailURL(t.BaseURL, m)
+}
+
+// LargeURL returns the URL of the large preview image of the movie, or the
+// small one when the provider has no large images
+func (t Thumbnails) LargeURL(m Movie) string {
+	if t.LargeBaseURL == "" {
+		return t.URL(m)
+	}
+	return thumbnailURL(t.LargeBaseURL, m)
+}
+
+// thumbnailURL builds the image URL, which is sharded by the first three
+// characters of the post ID, e.g.
+// https://th.easynews.com/thumbnails-a1b/pr-a1b2c3.jpg/th-Movie.2020.jpg
+func thumbnailURL(base string, m Movie) string {
+	if base == "" || len(m.ID) < 3 {
+		return ""
+	}
+	if strings.HasPrefix(base, "//") {
+		base = "https:" + base
+	}
+	return base + m.ID[:3] + "/pr-" + m.ID + ".jpg/th-" + url.PathEscape(m.Filename) + ".jpg"
+}
@@ -0,0 +1,384 @@
+package nntp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/midgarco/movie_downloader/nzb"
+	"github.com/midgarco/movie_downloader/yenc"
+)
+
+const (
+	// StateSuffix is appended to the file name for the file that records
+	// the articles already written, so an interrupted download resumes
+	// with the articles it is missing
+	StateSuffix = ".articles"
+
+	// DefaultRetries is the number of times a failing article is retried
+	// when the request does not say otherwise
+	DefaultRetries = 3
+)
+
+// Request describes the download of a file from its articles
+type Request struct {
+	Filename string
+	File     *nzb.File
+
+	// Retries is the number of times a failing article is retried
+	Retries int
+
+	// AllowMissing leaves the articles that cannot be fetched as zero
+	// filled holes instead of failing the download, for files that PAR2
+	// can repair
+	AllowMissing bool
+
+	// BeforeCopy is called with the estimated file size and the bytes
+	// already on disk before any data is written. Returning an error stops
+	// the download.
+	BeforeCopy func(size, completed int64) error
+}
+
+type state struct {
+	Size int64 `json:"size"`
+	// Articles maps the numbers of the articles written to the number of
+	// bytes they decoded to
+	Articles map[int]int64 `json:"articles"`
+	Missing  []int         `json:"missing,omitempty"`
+}
+
+// Response is a running article download. Its methods are safe to call
+// while the download is in progress.
+type Response struct {
+	Filename string
+
+	pool      *Pool
+	file      *nzb.File
+	size      atomic.Int64
+	completed atomic.Int64
+	speed     atomic.Uint64
+	workers   int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	stateMu sync.Mutex
+	state   *state
+}
+
+// Do starts downloading the articles of the file in the background, over
+// as many connections as the pool allows. Articles that were written
+// before are skipped.
+func (p *Pool) Do(req *Request) (*Response, error) {
+	if req.File == nil || len(req.File.Segments) == 0 {
+		return nil, errors.New("nntp: no articles to download")
+	}
+
+	st := &state{Articles: map[int]int64{}}
+	if b, err := os.ReadFile(req.Filename + StateSuffix); err == nil {
+		if err := json.Unmarshal(b, st); err != nil || st.Articles == nil {
+			st = &state{Articles: map[int]int64{}}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	// missing articles are tried again
+	st.Missing = nil
+
+	if err := p.start(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := &Response{
+		Filename: req.Filename,
+		pool:     p,
+		file:     req.File,
+		workers:  min(p.cfg.Connections, len(req.File.Segments)),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		state:    st,
+	}
+	resp.size.Store(st.Size)
+	for _, n := range st.Articles {
+		resp.completed.Add(n)
+	}
+
+	go resp.run(req)
+
+	return resp, nil
+}
+
+func (r *Response) run(req *Request) {
+	defer close(r.done)
+	defer r.pool.finish()
+	defer r.cancel()
+
+	if req.BeforeCopy != nil {
+		if r.err = req.BeforeCopy(r.Size(), r.completed.Load()); r.err != nil {
+			return
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.Filename), 0755); err != nil {
+		r.err = err
+		return
+	}
+	if r.err = r.saveState(); r.err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(r.Filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	go r.measure()
+
+	retries := req.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+
+	jobs := make(chan nzb.Segment)
+	go func() {
+		defer close(jobs)
+		for _, s := range r.file.Segments {
+			if r.written(s.Number) {
+				continue
+			}
+			select {
+			case jobs <- s:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		lastSave atomic.Int64
+	)
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				err := r.fetch(f, s, retries)
+				if err != nil && req.AllowMissing && r.ctx.Err() == nil {
+					r.stateMu.Lock()
+					r.state.Missing = append(r.state.Missing, s.Number)
+					r.stateMu.Unlock()
+					continue
+				}
+				if err != nil {
+					once.Do(func() {
+						r.err = err
+						r.cancel()
+					})
+					return
+				}
+
+				if now := time.Now().Unix(); now-lastSave.Load() >= 2 {
+					lastSave.Store(now)
+					r.saveState()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// articles decode to the exact size of the file, but a missing last
+	// article leaves the file short
+	if size := r.Size(); r.err == nil && size > 0 {
+		if err := f.Truncate(size); err != nil {
+			r.err = err
+		}
+	}
+	if err := f.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if r.err != nil {
+		r.saveState()
+		return
+	}
+	if err := os.Remove(r.Filename + StateSuffix); err != nil && !os.IsNotExist(err) {
+		r.err = err
+	}
+}
+
+// fetch downloads and decodes the article, retrying with a growing delay.
+// Articles the server does not have are not retried.
+func (r *Response) fetch(f *os.File, s nzb.Segment, retries int) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			case <-time.After(time.Duration(1<<uint(attempt-1)) * time.Second):
+			}
+		}
+
+		if err = r.fetchOnce(f, s); err == nil {
+			return nil
+		}
+		if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		}
+		if errors.Is(err, ErrArticleNotFound) {
+			break
+		}
+	}
+	return fmt.Errorf("article %d <%s>: %w", s.Number, s.MessageID, err)
+}
+
+func (r *Response) fetchOnce(f *os.File, s nzb.Segment) error {
+	body, err := r.pool.Body(r.ctx, s.MessageID)
+	if err != nil {
+		return err
+	}
+	part, err := yenc.Decode(body)
+	if err != nil {
+		return err
+	}
+
+	if part.Size > 0 && r.size.Load() != part.Size {
+		r.size.Store(part.Size)
+		r.stateMu.Lock()
+		r.state.Size = part.Size
+		r.stateMu.Unlock()
+	}
+	if _, err := f.WriteAt(part.Data, part.Begin); err != nil {
+		return err
+	}
+
+	r.stateMu.Lock()
+	r.state.Articles[s.Number] = int64(len(part.Data))
+	r.stateMu.Unlock()
+	r.completed.Add(int64(len(part.Data)))
+	return nil
+}
+
+func (r *Response) written(number int) bool {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	_, ok := r.state.Articles[number]
+	return ok
+}
+
+func (r *Response) saveState() error {
+	r.stateMu.Lock()
+	b, err := json.Marshal(r.state)
+	r.stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.Filename+StateSuffix, b, 0644)
+}
+
+// measure samples the transfer speed once a second until the download ends
+func (r *Response) measure() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	last, lastTime := r.completed.Load(), time.Now()
+	for {
+		select {
+		case <-r.done:
+			r.speed.Store(0)
+			return
+		case now := <-t.C:
+			completed := r.completed.Load()
+			speed := float64(completed-last) / now.Sub(lastTime).Seconds()
+			r.speed.Store(math.Float64bits(speed))
+			last, lastTime = completed, now
+		}
+	}
+}
+
+// Done is closed when the download finished or failed
+func (r *Response) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the error of a failed download once Done is closed
+func (r *Response) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// Cancel stops the download, keeping the state so it can be resumed
+func (r *Response) Cancel() error {
+	r.cancel()
+	<-r.done
+	return r.err
+}
+
+// Size returns the size of the file. Until the first article is decoded
+// it is estimated from the size of the articles.
+func (r *Response) Size() int64 {
+	if size := r.size.Load(); size > 0 {
+		return size
+	}
+	return r.file.Size()
+}
+
+// BytesComplete returns the number of decoded bytes on disk
+func (r *Response) BytesComplete() int64 {
+	return r.completed.Load()
+}
+
+// BytesPerSecond returns the aggregate speed of all connections
+func (r *Response) BytesPerSecond() float64 {
+	return math.Float64frombits(r.speed.Load())
+}
+
+// Progress returns the completed fraction between 0 and 1
+func (r *Response) Progress() float64 {
+	size := r.Size()
+	if size <= 0 {
+		return 0
+	}
+	return math.Min(1, float64(r.BytesComplete())/float64(size))
+}
+
+// IsComplete returns whether the download finished successfully
+func (r *Response) IsComplete() bool {
+	select {
+	case <-r.done:
+		return r.err == nil
+	default:
+		return false
+	}
+}
+
+// Segments returns the number of connections the articles are fetched
+// over
+func (r *Response) Segments() int {
+	return r.workers
+}
+
+// Missing returns the number of articles that could not be fetched and
+// were left as holes
+func (r *Response) Missing() int {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return len(r.state.Missing)
+}
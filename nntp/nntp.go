@@ -0,0 +1,297 @@
+package nntp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrArticleNotFound is returned when the server does not have the
+	// article, e.g. because it expired or was taken down
+	ErrArticleNotFound = errors.New("nntp: article not found")
+
+	// ErrAuthFailed is returned when the server rejects the credentials
+	ErrAuthFailed = errors.New("nntp: authentication failed")
+
+	// ErrClosed is returned when the pool was closed
+	ErrClosed = errors.New("nntp: pool closed")
+)
+
+const (
+	// DefaultConnections is the size of the pool when the configuration
+	// does not say otherwise
+	DefaultConnections = 8
+
+	// DefaultTimeout limits every command when the context has no deadline
+	DefaultTimeout = 30 * time.Second
+)
+
+// Config ...
+type Config struct {
+	// Addr is the host:port of the server
+	Addr        string
+	TLS         bool
+	Username    string
+	Password    string
+	Connections int
+	Timeout     time.Duration
+}
+
+// Pool keeps authenticated connections to the server open and limits how
+// many are used at the same time
+type Pool struct {
+	cfg   Config
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+	// active counts the downloads started with Do that are running, a
+	// draining pool is closed once they finished
+	active   int
+	draining bool
+}
+
+type conn struct {
+	nc net.Conn
+	*textproto.Conn
+}
+
+// NewPool returns a pool of at most cfg.Connections connections. The
+// connections are opened when they are first needed.
+func NewPool(cfg Config) *Pool {
+	if cfg.Connections <= 0 {
+		cfg.Connections = DefaultConnections
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &Pool{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.Connections),
+	}
+}
+
+// Body fetches the body of the article, with the dot-stuffing removed
+// and the lines ending in a single newline
+func (p *Pool) Body(ctx context.Context, messageID string) ([]byte, error) {
+	c, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.body(ctx, messageID, p.cfg.Timeout)
+	p.put(c, err == nil || errors.Is(err, ErrArticleNotFound))
+	return body, err
+}
+
+// Close closes the idle connections; connections in use are closed when
+// they are handed back
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, c := range p.idle {
+		c.quit()
+	}
+	p.idle = nil
+	return nil
+}
+
+// Drain closes the pool once the downloads started on it finished. They
+// keep using its connections until then.
+func (p *Pool) Drain() {
+	p.mu.Lock()
+	p.draining = true
+	idle := p.active == 0
+	p.mu.Unlock()
+
+	if idle {
+		p.Close()
+	}
+}
+
+// start counts a download that uses the pool
+func (p *Pool) start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	p.active++
+	return nil
+}
+
+// finish counts a download as done, closing a draining pool once it was
+// the last one
+func (p *Pool) finish() {
+	p.mu.Lock()
+	p.active--
+	idle := p.draining && p.active == 0
+	p.mu.Unlock()
+
+	if idle {
+		p.Close()
+	}
+}
+
+// get takes an idle connection, or dials a new one when there is a free
+// slot
+func (p *Pool) get(ctx context.Context) (*conn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, ErrClosed
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	c, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// put hands the connection back, closing it when it is broken
+func (p *Pool) put(c *conn, healthy bool) {
+	defer func() { <-p.slots }()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !healthy || p.closed {
+		c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+// dial connects and authenticates
+func (p *Pool) dial(ctx context.Context) (*conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	var (
+		nc  net.Conn
+		err error
+	)
+	dialer := &net.Dialer{}
+	if p.cfg.TLS {
+		host, _, _ := net.SplitHostPort(p.cfg.Addr)
+		td := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		nc, err = td.DialContext(ctx, "tcp", p.cfg.Addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", p.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{nc: nc, Conn: textproto.NewConn(nc)}
+	if err := c.handshake(ctx, p.cfg); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake reads the greeting and logs in with AUTHINFO USER/PASS
+func (c *conn) handshake(ctx context.Context, cfg Config) error {
+	stop := c.deadline(ctx, cfg.Timeout)
+	defer stop()
+
+	if _, _, err := c.ReadCodeLine(20); err != nil {
+		return fmt.Errorf("nntp: greeting: %w", err)
+	}
+	if cfg.Username == "" {
+		return nil
+	}
+
+	code, _, err := c.cmd("AUTHINFO USER %s", cfg.Username)
+	if err != nil {
+		return err
+	}
+	if code == 381 {
+		code, _, err = c.cmd("AUTHINFO PASS %s", cfg.Password)
+		if err != nil {
+			return err
+		}
+	}
+	if code != 281 {
+		return ErrAuthFailed
+	}
+	return nil
+}
+
+func (c *conn) body(ctx context.Context, messageID string, timeout time.Duration) ([]byte, error) {
+	stop := c.deadline(ctx, timeout)
+	defer stop()
+
+	code, msg, err := c.cmd("BODY <%s>", messageID)
+	if err != nil {
+		return nil, err
+	}
+	switch code {
+	case 222:
+	case 423, 430:
+		return nil, ErrArticleNotFound
+	default:
+		return nil, &textproto.Error{Code: code, Msg: msg}
+	}
+
+	body, err := c.ReadDotBytes()
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// cmd sends the command and reads the status line
+func (c *conn) cmd(format string, args ...any) (int, string, error) {
+	if err := c.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	// any status is accepted, it is for the caller to handle
+	return c.ReadCodeLine(0)
+}
+
+// deadline limits the exchange to the timeout, or to the deadline of the
+// context, and aborts it when the context is cancelled
+func (c *conn) deadline(ctx context.Context, timeout time.Duration) (stop func()) {
+	d, ok := ctx.Deadline()
+	if !ok {
+		d = time.Now().Add(timeout)
+	}
+	c.nc.SetDeadline(d)
+
+	cancel := context.AfterFunc(ctx, func() {
+		c.nc.SetDeadline(time.Unix(1, 0))
+	})
+	return func() { cancel() }
+}
+
+func (c *conn) quit() {
+	c.nc.SetDeadline(time.Now().Add(time.Second))
+	c.PrintfLine("QUIT")
+	c.Close()
+}
@@ -0,0 +1,441 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/midgarco/movie_downloader/nzb"
+)
+
+// crcRegex matches the checksum of the part in the trailer
+var crcRegex = regexp.MustCompile(`pcrc32=[0-9a-f]{8}`)
+
+// fakeServer is an in-process NNTP server that serves yEnc encoded
+// articles
+type fakeServer struct {
+	t        *testing.T
+	ln       net.Listener
+	username string
+	password string
+
+	mu       sync.Mutex
+	articles map[string][]byte
+	// corrupt is the number of times each article is served with a bad CRC
+	// before the good copy
+	corrupt  map[string]int
+	requests map[string]int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		t:        t,
+		ln:       ln,
+		username: "user",
+		password: "pass",
+		articles: map[string][]byte{},
+		corrupt:  map[string]int{},
+		requests: map[string]int{},
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeServer) pool(connections int) *Pool {
+	p := NewPool(Config{
+		Addr:        s.ln.Addr().String(),
+		Username:    s.username,
+		Password:    s.password,
+		Connections: connections,
+		Timeout:     5 * time.Second,
+	})
+	s.t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *fakeServer) handle(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+		w.Flush()
+	}
+
+	reply("200 fake server ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(cmd) {
+		case "AUTHINFO":
+			kind, value, _ := strings.Cut(arg, " ")
+			switch {
+			case strings.EqualFold(kind, "USER") && value == s.username:
+				reply("381 password required")
+			case strings.EqualFold(kind, "PASS") && value == s.password:
+				reply("281 authentication accepted")
+			default:
+				reply("481 authentication failed")
+			}
+		case "BODY":
+			id := strings.Trim(arg, "<>")
+			body, ok := s.body(id)
+			if !ok {
+				reply("430 no such article")
+				continue
+			}
+			reply("222 0 <%s>", id)
+			for _, l := range bytes.SplitAfter(body, []byte("\r\n")) {
+				if len(l) == 0 {
+					continue
+				}
+				if l[0] == '.' {
+					w.WriteByte('.')
+				}
+				w.Write(l)
+			}
+			reply(".")
+		case "QUIT":
+			reply("205 bye")
+			return
+		default:
+			reply("500 unknown command")
+		}
+	}
+}
+
+// body returns the article, damaged while it has corrupt copies left
+func (s *fakeServer) body(id string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[id]++
+	body, ok := s.articles[id]
+	if !ok {
+		return nil, false
+	}
+	if s.corrupt[id] > 0 {
+		s.corrupt[id]--
+		body = crcRegex.ReplaceAllFunc(body, func(m []byte) []byte {
+			var crc uint32
+			fmt.Sscanf(string(m), "pcrc32=%x", &crc)
+			return []byte(fmt.Sprintf("pcrc32=%08x", ^crc))
+		})
+	}
+	return body, true
+}
+
+func (s *fakeServer) count(id string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[id]
+}
+
+// post splits the data into articles and returns the NZB file for them
+func (s *fakeServer) post(name string, data []byte, partSize int) *nzb.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := &nzb.File{Subject: fmt.Sprintf("%q yEnc", name)}
+	for i, n := 0, 1; i < len(data); i, n = i+partSize, n+1 {
+		part := data[i:min(i+partSize, len(data))]
+		id := fmt.Sprintf("%s.%d@fake", name, n)
+		s.articles[id] = encodePart(name, int64(len(data)), n, int64(i), part)
+		f.Segments = append(f.Segments, nzb.Segment{Number: n, Bytes: int64(len(part)), MessageID: id})
+	}
+	return f
+}
+
+// encodePart yEnc encodes a part of a file
+func encodePart(name string, size int64, part int, begin int64, data []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "=ybegin part=%d line=128 size=%d name=%s\r\n", part, size, name)
+	fmt.Fprintf(&b, "=ypart begin=%d end=%d\r\n", begin+1, begin+int64(len(data)))
+	col := 0
+	for _, c := range data {
+		e := c + 42
+		switch e {
+		case 0, '\n', '\r', '=':
+			b.WriteByte('=')
+			e += 64
+			col++
+		}
+		b.WriteByte(e)
+		col++
+		if col >= 128 {
+			b.WriteString("\r\n")
+			col = 0
+		}
+	}
+	if col > 0 {
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "=yend size=%d part=%d pcrc32=%08x\r\n", len(data), part, crc32.ChecksumIEEE(data))
+	return b.Bytes()
+}
+
+// testData returns data with every byte value, including the ones that
+// are escaped and the ones that start a dot-stuffed line
+func testData(n int) []byte {
+	d := make([]byte, n)
+	for i := range d {
+		d[i] = byte(i * 7)
+	}
+	return d
+}
+
+func wait(t *testing.T, resp *Response) {
+	t.Helper()
+	select {
+	case <-resp.Done():
+	case <-time.After(30 * time.Second):
+		t.Fatal("download did not finish")
+	}
+}
+
+func TestBody(t *testing.T) {
+	s := newFakeServer(t)
+	d := testData(1000)
+	f := s.post("movie.mkv", d, 1000)
+
+	body, err := s.pool(1).Body(context.Background(), f.Segments[0].MessageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the dot-stuffing is removed and the lines end in a newline
+	want := bytes.ReplaceAll(s.articles[f.Segments[0].MessageID], []byte("\r\n"), []byte("\n"))
+	if !bytes.Equal(body, want) {
+		t.Fatal("body differs from the article")
+	}
+
+	if _, err := s.pool(1).Body(context.Background(), "missing@fake"); !errors.Is(err, ErrArticleNotFound) {
+		t.Fatalf("err = %v, want ErrArticleNotFound", err)
+	}
+}
+
+func TestAuthFailed(t *testing.T) {
+	s := newFakeServer(t)
+	s.password = "other"
+	p := NewPool(Config{Addr: s.ln.Addr().String(), Username: "user", Password: "pass", Timeout: 5 * time.Second})
+	defer p.Close()
+
+	if _, err := p.Body(context.Background(), "a@fake"); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("err = %v, want ErrAuthFailed", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	s := newFakeServer(t)
+	d := testData(10000)
+	f := s.post("movie.mkv", d, 768)
+
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	resp, err := s.pool(4).Do(&Request{Filename: filename, File: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsComplete() || resp.Progress() != 1 || resp.Size() != int64(len(d)) {
+		t.Fatalf("complete=%v progress=%v size=%d", resp.IsComplete(), resp.Progress(), resp.Size())
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, d) {
+		t.Fatal("downloaded file differs")
+	}
+	if _, err := os.Stat(filename + StateSuffix); !os.IsNotExist(err) {
+		t.Fatalf("state file left behind: %v", err)
+	}
+}
+
+func TestDownloadRetriesCRCFailure(t *testing.T) {
+	s := newFakeServer(t)
+	d := testData(3000)
+	f := s.post("movie.mkv", d, 1000)
+	id := f.Segments[1].MessageID
+	s.corrupt[id] = 1
+
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	resp, err := s.pool(2).Do(&Request{Filename: filename, File: f, Retries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count(id); n != 2 {
+		t.Fatalf("article fetched %d times, want 2", n)
+	}
+	got, _ := os.ReadFile(filename)
+	if !bytes.Equal(got, d) {
+		t.Fatal("downloaded file differs")
+	}
+}
+
+func TestDownloadMissingArticle(t *testing.T) {
+	s := newFakeServer(t)
+	d := testData(3000)
+	f := s.post("movie.mkv", d, 1000)
+	id := f.Segments[1].MessageID
+	delete(s.articles, id)
+
+	t.Run("fails", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "movie.mkv")
+		resp, err := s.pool(1).Do(&Request{Filename: filename, File: f})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait(t, resp)
+		if err := resp.Err(); !errors.Is(err, ErrArticleNotFound) {
+			t.Fatalf("err = %v, want ErrArticleNotFound", err)
+		}
+		// the articles written so far are kept for the resume
+		if _, err := os.Stat(filename + StateSuffix); err != nil {
+			t.Fatalf("state file: %v", err)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "movie.mkv")
+		resp, err := s.pool(2).Do(&Request{Filename: filename, File: f, AllowMissing: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		wait(t, resp)
+		if err := resp.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Missing() != 1 {
+			t.Fatalf("missing = %d, want 1", resp.Missing())
+		}
+
+		got, _ := os.ReadFile(filename)
+		want := append([]byte{}, d...)
+		copy(want[1000:2000], make([]byte, 1000))
+		if !bytes.Equal(got, want) {
+			t.Fatal("missing article is not a zero filled hole")
+		}
+	})
+
+	// missing articles are not retried
+	if n := s.count(id); n != 2 {
+		t.Fatalf("missing article requested %d times, want once per download", n)
+	}
+}
+
+func TestDownloadResumes(t *testing.T) {
+	s := newFakeServer(t)
+	d := testData(3000)
+	f := s.post("movie.mkv", d, 1000)
+	id := f.Segments[2].MessageID
+	body := s.articles[id]
+	delete(s.articles, id)
+
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	resp, err := s.pool(1).Do(&Request{Filename: filename, File: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if resp.Err() == nil {
+		t.Fatal("download of a missing article succeeded")
+	}
+
+	s.mu.Lock()
+	s.articles[id] = body
+	s.mu.Unlock()
+	resp, err = s.pool(1).Do(&Request{Filename: filename, File: f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, seg := range f.Segments[:2] {
+		if n := s.count(seg.MessageID); n != 1 {
+			t.Fatalf("written article %s fetched %d times", seg.MessageID, n)
+		}
+	}
+	got, _ := os.ReadFile(filename)
+	if !bytes.Equal(got, d) {
+		t.Fatal("resumed file differs")
+	}
+}
+
+func TestDrain(t *testing.T) {
+	s := newFakeServer(t)
+	d := testData(3000)
+	f := s.post("movie.mkv", d, 1000)
+	p := s.pool(2)
+
+	drained := make(chan struct{})
+	resp, err := p.Do(&Request{
+		Filename: filepath.Join(t.TempDir(), "movie.mkv"),
+		File:     f,
+		BeforeCopy: func(size, completed int64) error {
+			<-drained
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the running download keeps the drained pool open
+	p.Drain()
+	close(drained)
+	wait(t, resp)
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Body(context.Background(), f.Segments[0].MessageID); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v, want ErrClosed once the download finished", err)
+	}
+	if _, err := p.Do(&Request{Filename: filepath.Join(t.TempDir(), "other.mkv"), File: f}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v, want ErrClosed", err)
+	}
+
+	idle := s.pool(1)
+	idle.Drain()
+	if _, err := idle.Body(context.Background(), f.Segments[0].MessageID); !errors.Is(err, ErrClosed) {
+		t.Fatalf("err = %v, want ErrClosed for an idle drained pool", err)
+	}
+}
@@ -0,0 +1,133 @@
+package nzb
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrEmpty is returned for an NZB file that lists no files to download
+var ErrEmpty = errors.New("nzb: no files")
+
+// NZB is an index of the usenet articles that make up a release
+type NZB struct {
+	Meta  map[string]string
+	Files []*File
+}
+
+// File is a file posted to usenet, split into articles
+type File struct {
+	Poster   string    `xml:"poster,attr" json:"poster"`
+	Date     int64     `xml:"date,attr" json:"date"`
+	Subject  string    `xml:"subject,attr" json:"subject"`
+	Groups   []string  `xml:"groups>group" json:"groups"`
+	Segments []Segment `xml:"segments>segment" json:"segments"`
+}
+
+// Segment is one article of a file
+type Segment struct {
+	Number    int    `xml:"number,attr" json:"number"`
+	Bytes     int64  `xml:"bytes,attr" json:"bytes"`
+	MessageID string `xml:",chardata" json:"message_id"`
+}
+
+type document struct {
+	Meta []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"head>meta"`
+	Files []*File `xml:"file"`
+}
+
+// Parse reads the NZB file. Segments are sorted by number, duplicates
+// are dropped and the message IDs are stripped of their angle brackets.
+func Parse(r io.Reader) (*NZB, error) {
+	doc := &document{}
+	dec := xml.NewDecoder(r)
+	// the DTD is not needed and NZB files are not always in UTF-8
+	dec.Strict = false
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := dec.Decode(doc); err != nil {
+		return nil, err
+	}
+
+	n := &NZB{Meta: map[string]string{}}
+	for _, m := range doc.Meta {
+		n.Meta[strings.ToLower(m.Type)] = strings.TrimSpace(m.Value)
+	}
+	for _, f := range doc.Files {
+		seen := map[int]bool{}
+		segments := []Segment{}
+		for _, s := range f.Segments {
+			s.MessageID = strings.Trim(strings.TrimSpace(s.MessageID), "<>")
+			if s.MessageID == "" || seen[s.Number] {
+				continue
+			}
+			seen[s.Number] = true
+			segments = append(segments, s)
+		}
+		if len(segments) == 0 {
+			continue
+		}
+		sort.Slice(segments, func(i, j int) bool {
+			return segments[i].Number < segments[j].Number
+		})
+		f.Segments = segments
+		n.Files = append(n.Files, f)
+	}
+	if len(n.Files) == 0 {
+		return nil, ErrEmpty
+	}
+	return n, nil
+}
+
+// Name returns the title of the release from the metadata
+func (n *NZB) Name() string {
+	if name := n.Meta["title"]; name != "" {
+		return name
+	}
+	return n.Meta["name"]
+}
+
+// Password returns the archive password from the metadata
+func (n *NZB) Password() string {
+	return n.Meta["password"]
+}
+
+var (
+	// quotedNameRegex matches the file name most posters quote in the
+	// subject, e.g. [01/10] - "Movie.2020.part01.rar" yEnc (1/100)
+	quotedNameRegex = regexp.MustCompile(`"([^"]+)"`)
+	// yencSubjectRegex matches the name in front of the yEnc part counter,
+	// e.g. Movie.2020.part01.rar yEnc (1/100)
+	yencSubjectRegex = regexp.MustCompile(`(?i)([^\s"]+\.[a-z0-9]{2,4})\s+yenc\s*\(\d+/\d+\)`)
+	// partCounterRegex matches the part counter at the end of a subject
+	partCounterRegex = regexp.MustCompile(`(?i)\s*(yenc)?\s*\(\d+/\d+\)\s*$`)
+)
+
+// Filename returns the name of the file from the subject of its articles
+func (f File) Filename() string {
+	if m := quotedNameRegex.FindStringSubmatch(f.Subject); m != nil {
+		return filepath.Base(strings.TrimSpace(m[1]))
+	}
+	if m := yencSubjectRegex.FindStringSubmatch(f.Subject); m != nil {
+		return filepath.Base(m[1])
+	}
+	return strings.TrimSpace(partCounterRegex.ReplaceAllString(f.Subject, ""))
+}
+
+// Size returns the size of the articles of the file. The decoded file is
+// a few percent smaller because of the encoding overhead.
+func (f File) Size() int64 {
+	var size int64
+	for _, s := range f.Segments {
+		size += s.Bytes
+	}
+	return size
+}
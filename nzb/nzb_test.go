@@ -0,0 +1,84 @@
+package nzb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const sample = `<?xml version="1.0" encoding="iso-8859-1" ?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <head>
+  <meta type="title">Movie 2020</meta>
+  <meta type="password"> secret </meta>
+ </head>
+ <file poster="poster@example.com" date="1700000000" subject="[01/02] - &quot;Movie.2020.part01.rar&quot; yEnc (1/3)">
+  <groups><group>alt.binaries.movies</group></groups>
+  <segments>
+   <segment bytes="200" number="2">&lt;b@example&gt;</segment>
+   <segment bytes="100" number="1">a@example</segment>
+   <segment bytes="100" number="1">duplicate@example</segment>
+   <segment bytes="50" number="3"> c@example </segment>
+  </segments>
+ </file>
+ <file poster="poster@example.com" date="1700000000" subject="Movie.2020.par2 yEnc (1/1)">
+  <groups><group>alt.binaries.movies</group></groups>
+  <segments><segment bytes="10" number="1">p@example</segment></segments>
+ </file>
+ <file poster="poster@example.com" date="1700000000" subject="empty file">
+  <groups><group>alt.binaries.movies</group></groups>
+  <segments></segments>
+ </file>
+</nzb>`
+
+func TestParse(t *testing.T) {
+	n, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Name() != "Movie 2020" || n.Password() != "secret" {
+		t.Fatalf("name=%q password=%q", n.Name(), n.Password())
+	}
+	if len(n.Files) != 2 {
+		t.Fatalf("%d files, want 2 without the empty one", len(n.Files))
+	}
+
+	f := n.Files[0]
+	if f.Poster != "poster@example.com" || f.Date != 1700000000 || len(f.Groups) != 1 {
+		t.Fatalf("file = %+v", f)
+	}
+	ids := []string{}
+	for _, s := range f.Segments {
+		ids = append(ids, s.MessageID)
+	}
+	if got := strings.Join(ids, ","); got != "a@example,b@example,c@example" {
+		t.Fatalf("segments = %s", got)
+	}
+	if f.Size() != 350 {
+		t.Fatalf("size = %d", f.Size())
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<nzb><file subject="x"><segments/></file></nzb>`))
+	if !errors.Is(err, ErrEmpty) {
+		t.Fatalf("err = %v, want ErrEmpty", err)
+	}
+	if _, err := Parse(strings.NewReader("not xml")); err == nil {
+		t.Fatal("parsed garbage")
+	}
+}
+
+func TestFilename(t *testing.T) {
+	for subject, want := range map[string]string{
+		`[01/10] - "Movie.2020.part01.rar" yEnc (1/100)`: "Movie.2020.part01.rar",
+		`"../../etc/passwd" yEnc (1/1)`:                  "passwd",
+		`Movie.2020.part01.rar yEnc (1/100)`:             "Movie.2020.part01.rar",
+		`Some Movie 2020 (1/5)`:                          "Some Movie 2020",
+	} {
+		if got := (File{Subject: subject}).Filename(); got != want {
+			t.Errorf("Filename(%q) = %q, want %q", subject, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package par2
+
+// PAR2 computes its recovery data in the Galois field GF(2^16) generated
+// by the polynomial x^16 + x^12 + x^3 + x + 1
+const (
+	gfPoly  = 0x1100b
+	gfOrder = 65535
+)
+
+var (
+	gfLog [1 << 16]uint16
+	gfExp [gfOrder]uint16
+)
+
+func init() {
+	x := 1
+	for i := 0; i < gfOrder; i++ {
+		gfExp[i] = uint16(x)
+		gfLog[x] = uint16(i)
+		x <<= 1
+		if x&0x10000 != 0 {
+			x ^= gfPoly
+		}
+	}
+}
+
+func gfMul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%gfOrder]
+}
+
+func gfInv(a uint16) uint16 {
+	return gfExp[(gfOrder-int(gfLog[a]))%gfOrder]
+}
+
+// gfPow returns the power of the base whose logarithm is given
+func gfPow(log, exponent int) uint16 {
+	return gfExp[(log*exponent)%gfOrder]
+}
+
+// inputLogs returns the logarithms of the constants of the input slices:
+// the powers of two whose logarithm is coprime to 65535
+func inputLogs(n int) []int {
+	logs := make([]int, 0, n)
+	for l := 1; len(logs) < n; l++ {
+		if l%3 != 0 && l%5 != 0 && l%17 != 0 && l%257 != 0 {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// mulTable multiplies 16-bit little-endian words by a constant, one byte
+// at a time
+type mulTable struct {
+	lo, hi [256]uint16
+}
+
+func newMulTable(c uint16) *mulTable {
+	t := &mulTable{}
+	for b := 0; b < 256; b++ {
+		t.lo[b] = gfMul(c, uint16(b))
+		t.hi[b] = gfMul(c, uint16(b)<<8)
+	}
+	return t
+}
+
+// mulAdd adds the source words multiplied by the constant to the
+// destination
+func (t *mulTable) mulAdd(dst, src []byte) {
+	for i := 0; i+1 < len(src); i += 2 {
+		v := t.lo[src[i]] ^ t.hi[src[i+1]]
+		dst[i] ^= byte(v)
+		dst[i+1] ^= byte(v >> 8)
+	}
+}
+
+// invert returns the inverse of the square matrix, or false when it is
+// singular
+func invert(m [][]uint16) ([][]uint16, bool) {
+	n := len(m)
+	a := make([][]uint16, n)
+	inv := make([][]uint16, n)
+	for i := range m {
+		a[i] = append([]uint16{}, m[i]...)
+		inv[i] = make([]uint16, n)
+		inv[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for row := col; row < n; row++ {
+			if a[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		scale := gfInv(a[col][col])
+		for j := 0; j < n; j++ {
+			a[col][j] = gfMul(a[col][j], scale)
+			inv[col][j] = gfMul(inv[col][j], scale)
+		}
+		for row := 0; row < n; row++ {
+			f := a[row][col]
+			if row == col || f == 0 {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				a[row][j] ^= gfMul(f, a[col][j])
+				inv[row][j] ^= gfMul(f, inv[col][j])
+			}
+		}
+	}
+	return inv, true
+}
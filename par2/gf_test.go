@@ -0,0 +1,142 @@
+package par2
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGFTables(t *testing.T) {
+	seen := map[uint16]bool{}
+	for i := 0; i < gfOrder; i++ {
+		x := gfExp[i]
+		if x == 0 || seen[x] {
+			t.Fatalf("2^%d = %d repeats, the polynomial is not primitive", i, x)
+		}
+		seen[x] = true
+		if int(gfLog[x]) != i {
+			t.Fatalf("log(2^%d) = %d", i, gfLog[x])
+		}
+	}
+}
+
+func TestGFMul(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b, c := uint16(r.Intn(1<<16)), uint16(r.Intn(1<<16)), uint16(r.Intn(1<<16))
+		if gfMul(a, b) != gfMul(b, a) {
+			t.Fatalf("%d*%d is not commutative", a, b)
+		}
+		if gfMul(a, gfMul(b, c)) != gfMul(gfMul(a, b), c) {
+			t.Fatalf("%d*%d*%d is not associative", a, b, c)
+		}
+		if gfMul(a, b^c) != gfMul(a, b)^gfMul(a, c) {
+			t.Fatalf("%d*(%d+%d) does not distribute", a, b, c)
+		}
+		if gfMul(a, 1) != a || gfMul(a, 0) != 0 {
+			t.Fatalf("%d has the wrong identities", a)
+		}
+		if a != 0 && gfMul(a, gfInv(a)) != 1 {
+			t.Fatalf("%d*inv(%d) != 1", a, a)
+		}
+	}
+	// multiplying by two shifts and reduces by the polynomial
+	if got := gfMul(0x8000, 2); got != uint16(gfPoly&0xffff) {
+		t.Fatalf("0x8000*2 = %#x, want %#x", got, gfPoly&0xffff)
+	}
+}
+
+func TestGFPow(t *testing.T) {
+	for _, l := range []int{1, 2, 7, 1000} {
+		base := gfExp[l]
+		want := uint16(1)
+		for e := 0; e < 20; e++ {
+			if got := gfPow(l, e); got != want {
+				t.Fatalf("2^%d^%d = %d, want %d", l, e, got, want)
+			}
+			want = gfMul(want, base)
+		}
+	}
+}
+
+func TestInputLogs(t *testing.T) {
+	want := []int{1, 2, 4, 7, 8, 11, 13, 14, 16, 19, 22, 23, 26, 28, 29, 31, 32, 37, 38, 41}
+	got := inputLogs(len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("inputLogs = %v, want %v", got, want)
+		}
+	}
+
+	gcd := func(a, b int) int {
+		for b != 0 {
+			a, b = b, a%b
+		}
+		return a
+	}
+	for _, l := range inputLogs(1000) {
+		if gcd(l, gfOrder) != 1 {
+			t.Fatalf("log %d is not coprime to %d", l, gfOrder)
+		}
+	}
+}
+
+func TestMulTable(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	src := make([]byte, 4096)
+	r.Read(src)
+	dst := make([]byte, len(src))
+	r.Read(dst)
+
+	c := uint16(r.Intn(1 << 16))
+	want := make([]byte, len(dst))
+	for i := 0; i < len(src); i += 2 {
+		w := uint16(dst[i]) | uint16(dst[i+1])<<8
+		w ^= gfMul(c, uint16(src[i])|uint16(src[i+1])<<8)
+		want[i], want[i+1] = byte(w), byte(w>>8)
+	}
+
+	newMulTable(c).mulAdd(dst, src)
+	for i := range want {
+		if dst[i] != want[i] {
+			t.Fatalf("byte %d = %#x, want %#x", i, dst[i], want[i])
+		}
+	}
+}
+
+func TestInvert(t *testing.T) {
+	// the matrix the repair solves: input constants raised to the
+	// exponents of the recovery slices
+	logs := inputLogs(8)
+	m := make([][]uint16, len(logs))
+	for j := range m {
+		m[j] = make([]uint16, len(logs))
+		for i, l := range logs {
+			m[j][i] = gfPow(l, j)
+		}
+	}
+
+	inv, ok := invert(m)
+	if !ok {
+		t.Fatal("matrix is singular")
+	}
+	for i := range m {
+		for j := range m {
+			var sum uint16
+			for k := range m {
+				sum ^= gfMul(m[i][k], inv[k][j])
+			}
+			want := uint16(0)
+			if i == j {
+				want = 1
+			}
+			if sum != want {
+				t.Fatalf("m*inv[%d][%d] = %d, want %d", i, j, sum, want)
+			}
+		}
+	}
+
+	singular := [][]uint16{{1, 2}, {gfMul(3, 1), gfMul(3, 2)}}
+	if _, ok := invert(singular); ok {
+		t.Fatal("inverted a singular matrix")
+	}
+}
@@ -0,0 +1,282 @@
+package par2
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrNoMainPacket is returned when none of the PAR2 files holds an
+	// intact main packet, so the recovery set is unknown
+	ErrNoMainPacket = errors.New("par2: no main packet found")
+
+	// ErrIncomplete is returned when the description of a file of the
+	// recovery set is missing from every PAR2 file
+	ErrIncomplete = errors.New("par2: file descriptions are missing")
+)
+
+const headerSize = 64
+
+var (
+	packetMagic = []byte("PAR2\x00PKT")
+
+	typeMain     = "PAR 2.0\x00Main\x00\x00\x00\x00"
+	typeFileDesc = "PAR 2.0\x00FileDesc"
+	typeIFSC     = "PAR 2.0\x00IFSC\x00\x00\x00\x00"
+	typeRecovery = "PAR 2.0\x00RecvSlic"
+)
+
+type fileID [16]byte
+
+// File is a file protected by the recovery set
+type File struct {
+	ID      fileID
+	Name    string
+	Size    int64
+	Hash    [16]byte
+	Hash16k [16]byte
+	// Slices holds the checksums of the slices of the file
+	Slices []Checksum
+}
+
+// Checksum ...
+type Checksum struct {
+	MD5   [16]byte
+	CRC32 uint32
+}
+
+// slices returns the number of slices the file is split into
+func (f *File) slices(sliceSize int64) int {
+	return int((f.Size + sliceSize - 1) / sliceSize)
+}
+
+// recoverySlice locates the data of a recovery slice in a PAR2 file
+type recoverySlice struct {
+	path   string
+	offset int64
+}
+
+// Set is the recovery set described by the PAR2 files of a release
+type Set struct {
+	ID        [16]byte
+	SliceSize int64
+	// Files lists the protected files in the order of the main packet,
+	// which is the order of the input slices
+	Files []*File
+
+	recovery map[int]recoverySlice
+}
+
+// RecoverySlices returns the number of recovery slices available
+func (s *Set) RecoverySlices() int {
+	return len(s.recovery)
+}
+
+// Open reads the recovery set from the PAR2 files. Damaged packets are
+// skipped, so the set can be read as long as every packet is intact in
+// one of the files.
+func Open(paths ...string) (*Set, error) {
+	r := &reader{
+		descs:    map[fileID]*File{},
+		checks:   map[fileID][]Checksum{},
+		recovery: map[int]recoverySlice{},
+	}
+	for _, p := range paths {
+		if err := r.readFile(p); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(p), err)
+		}
+	}
+	if r.main == nil {
+		return nil, ErrNoMainPacket
+	}
+
+	s := &Set{
+		ID:        r.setID,
+		SliceSize: r.main.sliceSize,
+		recovery:  r.recovery,
+	}
+	for _, id := range r.main.files {
+		f, ok := r.descs[id]
+		if !ok {
+			return nil, ErrIncomplete
+		}
+		f.Slices = r.checks[id]
+		s.Files = append(s.Files, f)
+	}
+	return s, nil
+}
+
+type mainPacket struct {
+	sliceSize int64
+	files     []fileID
+}
+
+type reader struct {
+	setID    [16]byte
+	hasSet   bool
+	main     *mainPacket
+	descs    map[fileID]*File
+	checks   map[fileID][]Checksum
+	recovery map[int]recoverySlice
+}
+
+func (r *reader) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	header := make([]byte, headerSize)
+	for offset := int64(0); offset+headerSize <= size; {
+		length, ok := r.readPacket(f, path, header, offset, size)
+		if ok {
+			offset += length
+			continue
+		}
+		// resynchronise on the next packet after damaged data
+		if offset = findMagic(f, offset+1, size); offset < 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// readPacket reads the packet at the offset and returns its length, or
+// false when the packet is damaged
+func (r *reader) readPacket(f *os.File, path string, header []byte, offset, size int64) (int64, bool) {
+	if _, err := f.ReadAt(header, offset); err != nil || !bytes.Equal(header[:8], packetMagic) {
+		return 0, false
+	}
+	length := int64(binary.LittleEndian.Uint64(header[8:16]))
+	if length < headerSize || length%4 != 0 || offset+length > size {
+		return 0, false
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, offset+32, length-32)); err != nil {
+		return 0, false
+	}
+	if !bytes.Equal(h.Sum(nil), header[16:32]) {
+		return 0, false
+	}
+
+	var setID [16]byte
+	copy(setID[:], header[32:48])
+	if !r.hasSet {
+		r.setID, r.hasSet = setID, true
+	}
+	if setID != r.setID {
+		// a packet of another recovery set, skip it
+		return length, true
+	}
+
+	kind := string(header[48:64])
+	if kind == typeRecovery {
+		exponent := make([]byte, 4)
+		if _, err := f.ReadAt(exponent, offset+headerSize); err != nil {
+			return 0, false
+		}
+		r.recovery[int(binary.LittleEndian.Uint32(exponent))] = recoverySlice{path: path, offset: offset + headerSize + 4}
+		return length, true
+	}
+	if kind != typeMain && kind != typeFileDesc && kind != typeIFSC {
+		// creator and unknown packets are not needed
+		return length, true
+	}
+
+	body := make([]byte, length-headerSize)
+	if _, err := f.ReadAt(body, offset+headerSize); err != nil {
+		return 0, false
+	}
+	switch kind {
+	case typeMain:
+		r.parseMain(body)
+	case typeFileDesc:
+		r.parseFileDesc(body)
+	case typeIFSC:
+		r.parseIFSC(body)
+	}
+	return length, true
+}
+
+func (r *reader) parseMain(body []byte) {
+	if r.main != nil || len(body) < 12 {
+		return
+	}
+	m := &mainPacket{sliceSize: int64(binary.LittleEndian.Uint64(body[0:8]))}
+	count := int(binary.LittleEndian.Uint32(body[8:12]))
+	if m.sliceSize <= 0 || m.sliceSize%4 != 0 || len(body) < 12+16*count {
+		return
+	}
+	for i := 0; i < count; i++ {
+		var id fileID
+		copy(id[:], body[12+16*i:])
+		m.files = append(m.files, id)
+	}
+	r.main = m
+}
+
+func (r *reader) parseFileDesc(body []byte) {
+	if len(body) < 56 {
+		return
+	}
+	f := &File{
+		Size: int64(binary.LittleEndian.Uint64(body[48:56])),
+		Name: strings.TrimRight(string(body[56:]), "\x00"),
+	}
+	copy(f.ID[:], body[0:16])
+	copy(f.Hash[:], body[16:32])
+	copy(f.Hash16k[:], body[32:48])
+	r.descs[f.ID] = f
+}
+
+func (r *reader) parseIFSC(body []byte) {
+	if len(body) < 16 {
+		return
+	}
+	var id fileID
+	copy(id[:], body[0:16])
+
+	checks := []Checksum{}
+	for entry := body[16:]; len(entry) >= 20; entry = entry[20:] {
+		c := Checksum{CRC32: binary.LittleEndian.Uint32(entry[16:20])}
+		copy(c.MD5[:], entry[0:16])
+		checks = append(checks, c)
+	}
+	r.checks[id] = checks
+}
+
+// findMagic returns the offset of the next packet header from the offset
+// on, or -1
+func findMagic(f *os.File, offset, size int64) int64 {
+	buf := make([]byte, 1<<20)
+	for offset < size {
+		n, err := f.ReadAt(buf, offset)
+		if n == 0 {
+			return -1
+		}
+		if i := bytes.Index(buf[:n], packetMagic); i >= 0 {
+			return offset + int64(i)
+		}
+		if err != nil {
+			return -1
+		}
+		// keep enough bytes to find a header that straddles the chunks
+		offset += int64(n - len(packetMagic) + 1)
+	}
+	return -1
+}
@@ -0,0 +1,535 @@
+package par2
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+	"github.com/midgarco/movie_downloader/safepath"
+)
+
+// ErrNotEnoughRecovery is returned when more slices are damaged than
+// there are recovery slices to rebuild them from
+var ErrNotEnoughRecovery = errors.New("par2: not enough recovery slices to repair")
+
+// Status ...
+type Status string
+
+const (
+	// Verified means every file matched the PAR2 hashes
+	Verified Status = "verified"
+	// Repaired means damaged or missing files were rebuilt
+	Repaired Status = "repaired"
+	// Damaged means files are damaged and cannot be repaired
+	Damaged Status = "damaged"
+)
+
+// Result is the outcome of the verification, and repair, of a recovery
+// set
+type Result struct {
+	Status         Status   `json:"status"`
+	Files          int      `json:"files"`
+	DamagedFiles   []string `json:"damaged_files,omitempty"`
+	DamagedSlices  int      `json:"damaged_slices"`
+	RecoverySlices int      `json:"recovery_slices"`
+}
+
+// MapToProto ...
+func (r Result) MapToProto() *moviedownloader.RepairInfo {
+	return &moviedownloader.RepairInfo{
+		Status:         string(r.Status),
+		Files:          int32(r.Files),
+		DamagedFiles:   append([]string{}, r.DamagedFiles...),
+		DamagedSlices:  int32(r.DamagedSlices),
+		RecoverySlices: int32(r.RecoverySlices),
+	}
+}
+
+// fileState is the verification state of a protected file
+type fileState struct {
+	*File
+	// path is where the file was found, or where it is rebuilt when it is
+	// missing
+	path   string
+	intact bool
+	good   []bool
+}
+
+// Verification is the state of the files of a recovery set
+type Verification struct {
+	set    *Set
+	files  []*fileState
+	result Result
+}
+
+// Result ...
+func (v *Verification) Result() Result {
+	return v.result
+}
+
+// Damaged returns whether any file is damaged or missing
+func (v *Verification) Damaged() bool {
+	return len(v.result.DamagedFiles) > 0
+}
+
+// DamagedPaths returns the paths of the damaged files, which Repair
+// rewrites
+func (v *Verification) DamagedPaths() []string {
+	paths := []string{}
+	for _, f := range v.files {
+		if !f.intact {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths
+}
+
+// Repairable returns whether there are enough recovery slices to rebuild
+// every damaged slice
+func (v *Verification) Repairable() bool {
+	return v.result.DamagedSlices <= v.result.RecoverySlices
+}
+
+// Verify checks the files against the hashes of the recovery set. The
+// protected files are looked up among the candidate paths by name and,
+// when they were renamed, by the hash of their first 16KiB. Missing files
+// are rebuilt in the folder. Progress is called with the number of bytes
+// read and the total size of the set.
+func (s *Set) Verify(ctx context.Context, dir string, candidates []string, progress func(done, total int64)) (*Verification, error) {
+	v := &Verification{
+		set: s,
+		result: Result{
+			Files:          len(s.Files),
+			RecoverySlices: s.RecoverySlices(),
+		},
+	}
+
+	p := &counter{fn: progress}
+	for _, f := range s.Files {
+		p.total += f.Size
+	}
+
+	paths := s.locate(candidates)
+	for _, f := range s.Files {
+		state := &fileState{File: f, good: make([]bool, f.slices(s.SliceSize))}
+		v.files = append(v.files, state)
+
+		path, found := paths[f.ID]
+		if !found {
+			path = filepath.Join(dir, safepath.Sanitize(filepath.Base(f.Name)))
+		}
+		state.path = path
+
+		if found {
+			if err := s.check(ctx, state, p); err != nil {
+				return nil, err
+			}
+		}
+		if state.intact {
+			continue
+		}
+
+		v.result.DamagedFiles = append(v.result.DamagedFiles, f.Name)
+		for _, good := range state.good {
+			if !good {
+				v.result.DamagedSlices++
+			}
+		}
+	}
+
+	switch {
+	case !v.Damaged():
+		v.result.Status = Verified
+	default:
+		v.result.Status = Damaged
+	}
+	return v, nil
+}
+
+// locate finds the protected files among the candidates
+func (s *Set) locate(candidates []string) map[fileID]string {
+	paths := map[fileID]string{}
+	used := map[string]bool{}
+
+	for _, f := range s.Files {
+		name := filepath.Base(f.Name)
+		for _, c := range candidates {
+			base := filepath.Base(c)
+			if !used[c] && (strings.EqualFold(base, name) || strings.EqualFold(base, safepath.Sanitize(name))) {
+				paths[f.ID], used[c] = c, true
+				break
+			}
+		}
+	}
+
+	// files that were renamed are recognised by their first 16KiB
+	for _, f := range s.Files {
+		if _, ok := paths[f.ID]; ok {
+			continue
+		}
+		for _, c := range candidates {
+			if used[c] {
+				continue
+			}
+			if h, err := hash16k(c); err == nil && h == f.Hash16k {
+				paths[f.ID], used[c] = c, true
+				break
+			}
+		}
+	}
+	return paths
+}
+
+func hash16k(path string) ([16]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return [16]byte{}, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.CopyN(h, f, 16*1024); err != nil && err != io.EOF {
+		return [16]byte{}, err
+	}
+	var sum [16]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// check compares the slices of the file with their checksums
+func (s *Set) check(ctx context.Context, state *fileState, p *counter) error {
+	f, err := os.Open(state.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	whole := md5.New()
+	buf := make([]byte, s.SliceSize)
+	for i := range state.good {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if want := min(s.SliceSize, state.Size-int64(i)*s.SliceSize); int64(n) > want {
+			n = int(want)
+		}
+		// the last slice is padded with zeros, and so is a truncated file
+		clear(buf[n:])
+		whole.Write(buf[:n])
+		p.add(int64(n))
+
+		if i < len(state.Slices) {
+			sum := md5.Sum(buf)
+			state.good[i] = sum == state.Slices[i].MD5 && crc32.ChecksumIEEE(buf) == state.Slices[i].CRC32
+		}
+	}
+
+	state.intact = fi.Size() == state.Size && bytes.Equal(whole.Sum(nil), state.Hash[:])
+	if state.intact {
+		// the file hash is authoritative, even without slice checksums
+		for i := range state.good {
+			state.good[i] = true
+		}
+	}
+	return nil
+}
+
+// Repair rebuilds the damaged slices from the recovery slices and rewrites
+// the damaged and missing files. Progress is called with the number of
+// bytes read and the total size of the set.
+func (v *Verification) Repair(ctx context.Context, progress func(done, total int64)) error {
+	if !v.Damaged() {
+		return nil
+	}
+	if !v.Repairable() {
+		return fmt.Errorf("%w: %d damaged, %d available", ErrNotEnoughRecovery, v.result.DamagedSlices, v.result.RecoverySlices)
+	}
+
+	p := &counter{fn: progress}
+	for _, f := range v.files {
+		p.total += f.Size
+	}
+
+	logs := inputLogs(v.inputSlices())
+	missing := []int{}
+	index := 0
+	for _, f := range v.files {
+		for _, good := range f.good {
+			if !good {
+				missing = append(missing, index)
+			}
+			index++
+		}
+	}
+
+	recovered := [][]byte{}
+	if len(missing) > 0 {
+		var err error
+		recovered, err = v.solve(ctx, logs, missing, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	// rewrite the damaged files from their good and their recovered slices
+	slot := map[int]int{}
+	for i, m := range missing {
+		slot[m] = i
+	}
+	index = 0
+	for _, f := range v.files {
+		if !f.intact {
+			if err := v.rewrite(f, index, slot, recovered); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		index += len(f.good)
+	}
+
+	v.result.Status = Repaired
+	return nil
+}
+
+func (v *Verification) inputSlices() int {
+	n := 0
+	for _, f := range v.files {
+		n += len(f.good)
+	}
+	return n
+}
+
+// solve computes the missing input slices. Every recovery slice is the sum
+// of the input slices multiplied by their constants raised to the exponent
+// of the recovery slice; subtracting the good input slices leaves a linear
+// system in the missing slices.
+func (v *Verification) solve(ctx context.Context, logs []int, missing []int, p *counter) ([][]byte, error) {
+	s := v.set
+
+	exponents := make([]int, 0, len(s.recovery))
+	for e := range s.recovery {
+		exponents = append(exponents, e)
+	}
+	sort.Ints(exponents)
+	exponents = exponents[:len(missing)]
+
+	matrix := make([][]uint16, len(exponents))
+	for j, e := range exponents {
+		matrix[j] = make([]uint16, len(missing))
+		for i, m := range missing {
+			matrix[j][i] = gfPow(logs[m], e)
+		}
+	}
+	inverse, ok := invert(matrix)
+	if !ok {
+		return nil, errors.New("par2: the recovery slices cannot rebuild the damaged slices")
+	}
+
+	// start from the recovery data
+	sums := make([][]byte, len(exponents))
+	for j, e := range exponents {
+		sums[j] = make([]byte, s.SliceSize)
+		if err := s.readRecovery(e, sums[j]); err != nil {
+			return nil, err
+		}
+	}
+
+	// subtract the good input slices
+	buf := make([]byte, s.SliceSize)
+	tables := make([]*mulTable, len(exponents))
+	index := 0
+	for _, f := range v.files {
+		err := v.eachGoodSlice(ctx, f, buf, p, func(i int) {
+			for j, e := range exponents {
+				tables[j] = newMulTable(gfPow(logs[index+i], e))
+			}
+			parallel(len(buf), func(from, to int) {
+				for j := range sums {
+					tables[j].mulAdd(sums[j][from:to], buf[from:to])
+				}
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		index += len(f.good)
+	}
+
+	// and multiply by the inverse matrix
+	recovered := make([][]byte, len(missing))
+	for i := range missing {
+		recovered[i] = make([]byte, s.SliceSize)
+		for j := range sums {
+			t := newMulTable(inverse[i][j])
+			parallel(len(buf), func(from, to int) {
+				t.mulAdd(recovered[i][from:to], sums[j][from:to])
+			})
+		}
+	}
+	return recovered, nil
+}
+
+// eachGoodSlice reads the good slices of the file into the buffer, zero
+// padded, and calls fn with their index
+func (v *Verification) eachGoodSlice(ctx context.Context, f *fileState, buf []byte, p *counter, fn func(i int)) error {
+	if !hasGood(f.good) {
+		return nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	size := v.set.SliceSize
+	for i, good := range f.good {
+		if !good {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := file.ReadAt(buf, int64(i)*size)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if want := min(size, f.Size-int64(i)*size); int64(n) > want {
+			n = int(want)
+		}
+		clear(buf[n:])
+		p.add(int64(n))
+		fn(i)
+	}
+	return nil
+}
+
+func hasGood(good []bool) bool {
+	for _, g := range good {
+		if g {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Set) readRecovery(exponent int, buf []byte) error {
+	rs := s.recovery[exponent]
+	f, err := os.Open(rs.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.ReadAt(buf, rs.offset)
+	return err
+}
+
+// rewrite writes the file from its good slices and the recovered ones
+// next to the damaged file, checks its hash and replaces the damaged file
+func (v *Verification) rewrite(f *fileState, first int, slot map[int]int, recovered [][]byte) error {
+	size := v.set.SliceSize
+
+	var src *os.File
+	if hasGood(f.good) {
+		var err error
+		if src, err = os.Open(f.path); err != nil {
+			return err
+		}
+		defer src.Close()
+	}
+
+	tmp := f.path + ".par2-repair"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	whole := md5.New()
+	w := io.MultiWriter(dst, whole)
+	buf := make([]byte, size)
+	for i, good := range f.good {
+		n := int(min(size, f.Size-int64(i)*size))
+		data := buf[:n]
+		if good {
+			if _, err := src.ReadAt(data, int64(i)*size); err != nil && err != io.EOF {
+				dst.Close()
+				return err
+			}
+		} else {
+			data = recovered[slot[first+i]][:n]
+		}
+		if _, err := w.Write(data); err != nil {
+			dst.Close()
+			return err
+		}
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if !bytes.Equal(whole.Sum(nil), f.Hash[:]) {
+		return errors.New("par2: repaired file does not match its hash")
+	}
+	if src != nil {
+		src.Close()
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// parallel splits the range of bytes into word aligned chunks processed
+// concurrently
+func parallel(n int, fn func(from, to int)) {
+	workers := runtime.NumCPU()
+	chunk := (n/workers + 3) &^ 3
+	if chunk < 64*1024 {
+		fn(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for from := 0; from < n; from += chunk {
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			fn(from, to)
+		}(from, min(from+chunk, n))
+	}
+	wg.Wait()
+}
+
+// counter counts the bytes read across the files of the set
+type counter struct {
+	done  int64
+	total int64
+	fn    func(done, total int64)
+}
+
+func (c *counter) add(n int64) {
+	c.done += n
+	if c.fn != nil {
+		c.fn(c.done, c.total)
+	}
+}
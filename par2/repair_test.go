@@ -0,0 +1,324 @@
+package par2
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFile is a file protected by the recovery set the tests create
+type testFile struct {
+	name string
+	data []byte
+}
+
+// packet returns a PAR2 packet of the type with the body
+func packet(setID [16]byte, kind string, body []byte) []byte {
+	length := headerSize + len(body)
+	p := make([]byte, length)
+	copy(p, packetMagic)
+	binary.LittleEndian.PutUint64(p[8:], uint64(length))
+	copy(p[32:], setID[:])
+	copy(p[48:], kind)
+	copy(p[64:], body)
+	sum := md5.Sum(p[32:])
+	copy(p[16:], sum[:])
+	return p
+}
+
+// slices splits the data into slices padded with zeros
+func slices(data []byte, size int) [][]byte {
+	s := [][]byte{}
+	for i := 0; i < len(data); i += size {
+		b := make([]byte, size)
+		copy(b, data[i:min(i+size, len(data))])
+		s = append(s, b)
+	}
+	return s
+}
+
+// create writes the files and an index PAR2 file and a PAR2 file with the
+// recovery slices to the folder, and returns the paths of the PAR2 files
+func create(t *testing.T, dir string, sliceSize, recovery int, files []testFile) []string {
+	t.Helper()
+
+	ids := make([][16]byte, len(files))
+	var descs [][]byte
+	for i, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), f.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		hash := md5.Sum(f.data)
+		hash16k := md5.Sum(f.data[:min(16*1024, len(f.data))])
+		name := []byte(f.name)
+		name = append(name, make([]byte, (4-len(name)%4)%4)...)
+
+		body := make([]byte, 56, 56+len(name))
+		copy(body[16:], hash[:])
+		copy(body[32:], hash16k[:])
+		binary.LittleEndian.PutUint64(body[48:], uint64(len(f.data)))
+		body = append(body, name...)
+		ids[i] = md5.Sum(append(append(hash16k[:], body[48:56]...), name...))
+		copy(body[0:], ids[i][:])
+		descs = append(descs, body)
+	}
+
+	main := make([]byte, 12)
+	binary.LittleEndian.PutUint64(main, uint64(sliceSize))
+	binary.LittleEndian.PutUint32(main[8:], uint32(len(files)))
+	for _, id := range ids {
+		main = append(main, id[:]...)
+	}
+	setID := md5.Sum(main)
+
+	var index bytes.Buffer
+	index.Write(packet(setID, typeMain, main))
+	var inputs [][]byte
+	for i, f := range files {
+		index.Write(packet(setID, typeFileDesc, descs[i]))
+
+		ifsc := append([]byte{}, ids[i][:]...)
+		for _, s := range slices(f.data, sliceSize) {
+			sum := md5.Sum(s)
+			ifsc = append(ifsc, sum[:]...)
+			ifsc = binary.LittleEndian.AppendUint32(ifsc, crc32.ChecksumIEEE(s))
+			inputs = append(inputs, s)
+		}
+		index.Write(packet(setID, typeIFSC, ifsc))
+	}
+	index.Write(packet(setID, "PAR 2.0\x00Creator\x00", []byte("test")))
+
+	// every recovery slice is the sum of the input slices multiplied by
+	// their constants raised to its exponent
+	var vol bytes.Buffer
+	vol.Write(packet(setID, typeMain, main))
+	logs := inputLogs(len(inputs))
+	for e := 0; e < recovery; e++ {
+		body := binary.LittleEndian.AppendUint32(nil, uint32(e))
+		data := make([]byte, sliceSize)
+		for i, in := range inputs {
+			c := gfPow(logs[i], e)
+			for w := 0; w < sliceSize; w += 2 {
+				v := gfMul(c, binary.LittleEndian.Uint16(in[w:]))
+				data[w] ^= byte(v)
+				data[w+1] ^= byte(v >> 8)
+			}
+		}
+		vol.Write(packet(setID, typeRecovery, append(body, data...)))
+	}
+
+	paths := []string{filepath.Join(dir, "set.par2"), filepath.Join(dir, "set.vol00+01.par2")}
+	if err := os.WriteFile(paths[0], index.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(paths[1], vol.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func random(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func testFiles() []testFile {
+	return []testFile{
+		{name: "movie.part01.rar", data: random(1, 10000)},
+		{name: "movie.part02.rar", data: random(2, 7001)},
+		{name: "movie.part03.rar", data: random(3, 300)},
+	}
+}
+
+func candidates(files []testFile, dir string) []string {
+	paths := []string{}
+	for _, f := range files {
+		paths = append(paths, filepath.Join(dir, f.name))
+	}
+	return paths
+}
+
+func verify(t *testing.T, paths []string, dir string, files []string) *Verification {
+	t.Helper()
+	set, err := Open(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := set.Verify(context.Background(), dir, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func checkFiles(t *testing.T, dir string, files []testFile) {
+	t.Helper()
+	for _, f := range files {
+		got, err := os.ReadFile(filepath.Join(dir, f.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, f.data) {
+			t.Fatalf("%s was not restored", f.name)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	files := testFiles()
+	paths := create(t, dir, 1024, 4, files)
+
+	set, err := Open(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.SliceSize != 1024 || set.RecoverySlices() != 4 || len(set.Files) != len(files) {
+		t.Fatalf("set = %+v", set)
+	}
+	for i, f := range set.Files {
+		if f.Name != files[i].name || f.Size != int64(len(files[i].data)) || len(f.Slices) != f.slices(set.SliceSize) {
+			t.Fatalf("file %d = %+v", i, f)
+		}
+	}
+
+	if _, err := Open(paths[0][:len(paths[0])-5] + ".missing.par2"); err == nil {
+		t.Fatal("opened a missing file")
+	}
+	empty := filepath.Join(dir, "empty.par2")
+	os.WriteFile(empty, nil, 0644)
+	if _, err := Open(empty); !errors.Is(err, ErrNoMainPacket) {
+		t.Fatalf("err = %v, want ErrNoMainPacket", err)
+	}
+}
+
+func TestOpenSkipsDamagedPackets(t *testing.T) {
+	dir := t.TempDir()
+	files := testFiles()
+	paths := create(t, dir, 1024, 2, files)
+
+	// damage the main packet of the index, the volume has another copy
+	b, _ := os.ReadFile(paths[0])
+	b[headerSize+2] ^= 0xff
+	os.WriteFile(paths[0], b, 0644)
+
+	set, err := Open(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Files) != len(files) || set.RecoverySlices() != 2 {
+		t.Fatalf("set = %+v", set)
+	}
+
+	// without the descriptions the set is incomplete
+	if _, err := Open(paths[1]); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("err = %v, want ErrIncomplete", err)
+	}
+}
+
+func TestVerifyIntact(t *testing.T) {
+	dir := t.TempDir()
+	files := testFiles()
+	paths := create(t, dir, 1024, 2, files)
+
+	var done, total int64
+	set, err := Open(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := set.Verify(context.Background(), dir, candidates(files, dir), func(d, t int64) { done, total = d, t })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Damaged() || v.Result().Status != Verified || v.Result().Files != 3 {
+		t.Fatalf("result = %+v", v.Result())
+	}
+	if done != total || total != 17301 {
+		t.Fatalf("progress %d/%d", done, total)
+	}
+	if err := v.Repair(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyRenamed(t *testing.T) {
+	dir := t.TempDir()
+	files := testFiles()
+	paths := create(t, dir, 1024, 2, files)
+
+	renamed := filepath.Join(dir, "obfuscated.bin")
+	os.Rename(filepath.Join(dir, files[1].name), renamed)
+	list := candidates(files, dir)
+	list[1] = renamed
+
+	v := verify(t, paths, dir, list)
+	if v.Damaged() {
+		t.Fatalf("renamed file was not recognised: %+v", v.Result())
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	files := testFiles()
+	paths := create(t, dir, 1024, 8, files)
+
+	// damage two slices of the first file, truncate the second and delete
+	// the last
+	b := append([]byte{}, files[0].data...)
+	b[10] ^= 1
+	b[5000] ^= 1
+	os.WriteFile(filepath.Join(dir, files[0].name), b, 0644)
+	os.WriteFile(filepath.Join(dir, files[1].name), files[1].data[:6144], 0644)
+	os.Remove(filepath.Join(dir, files[2].name))
+
+	v := verify(t, paths, dir, candidates(files, dir))
+	r := v.Result()
+	if !v.Damaged() || r.Status != Damaged || len(r.DamagedFiles) != 3 {
+		t.Fatalf("result = %+v", r)
+	}
+	// two slices of the first file, the last slice of the second and the
+	// only slice of the third
+	if r.DamagedSlices != 4 || !v.Repairable() {
+		t.Fatalf("damaged slices = %d, recovery = %d", r.DamagedSlices, r.RecoverySlices)
+	}
+	if len(v.DamagedPaths()) != 3 {
+		t.Fatalf("damaged paths = %v", v.DamagedPaths())
+	}
+
+	if err := v.Repair(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if v.Result().Status != Repaired {
+		t.Fatalf("status = %s", v.Result().Status)
+	}
+	checkFiles(t, dir, files)
+
+	if v := verify(t, paths, dir, candidates(files, dir)); v.Damaged() {
+		t.Fatalf("repaired files do not verify: %+v", v.Result())
+	}
+}
+
+func TestRepairNotEnoughRecovery(t *testing.T) {
+	dir := t.TempDir()
+	files := testFiles()
+	paths := create(t, dir, 1024, 1, files)
+
+	os.Remove(filepath.Join(dir, files[1].name))
+
+	v := verify(t, paths, dir, candidates(files, dir))
+	if v.Repairable() {
+		t.Fatalf("result = %+v", v.Result())
+	}
+	if err := v.Repair(context.Background(), nil); !errors.Is(err, ErrNotEnoughRecovery) {
+		t.Fatalf("err = %v, want ErrNotEnoughRecovery", err)
+	}
+}
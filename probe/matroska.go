@@ -0,0 +1,311 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Matroska element IDs, including their length marker bits
+const (
+	idEBML          = 0x1a45dfa3
+	idSegment       = 0x18538067
+	idInfo          = 0x1549a966
+	idTimecodeScale = 0x2ad7b1
+	idDuration      = 0x4489
+	idTracks        = 0x1654ae6b
+	idTrackEntry    = 0xae
+	idTrackType     = 0x83
+	idCodecID       = 0x86
+	idLanguage      = 0x22b59c
+	idLanguageIETF  = 0x22b59d
+	idName          = 0x536e
+	idFlagDefault   = 0x88
+	idFlagForced    = 0x55aa
+	idVideo         = 0xe0
+	idPixelWidth    = 0xb0
+	idPixelHeight   = 0xba
+	idAudio         = 0xe1
+	idSamplingFreq  = 0xb5
+	idChannels      = 0x9f
+	idCluster       = 0x1f43b675
+)
+
+// unknownSize marks a master element whose size was not written
+const unknownSize = -1
+
+// maxValueSize limits the size of the values that are read into memory
+const maxValueSize = 4096
+
+var errMalformed = errors.New("malformed container")
+
+func probeMatroska(r io.ReaderAt, size int64) (Info, error) {
+	info := Info{Container: "matroska"}
+
+	id, dataStart, dataSize, err := readElement(r, 0)
+	if err != nil || id != idEBML || dataSize == unknownSize {
+		return info, errMalformed
+	}
+
+	id, segStart, segSize, err := readElement(r, dataStart+dataSize)
+	if err != nil || id != idSegment {
+		return info, errMalformed
+	}
+	segEnd := size
+	if segSize != unknownSize && segStart+segSize < size {
+		segEnd = segStart + segSize
+	}
+
+	scale := int64(1000000)
+	var duration float64
+	foundInfo, foundTracks := false, false
+
+	offset := segStart
+	for offset < segEnd && !(foundInfo && foundTracks) {
+		id, start, n, err := readElement(r, offset)
+		if err != nil {
+			return info, err
+		}
+		if id == idCluster || n == unknownSize {
+			// the headers come before the media data
+			break
+		}
+
+		switch id {
+		case idInfo:
+			foundInfo = true
+			err = children(r, start, start+n, func(id uint32, start, n int64) error {
+				switch id {
+				case idTimecodeScale:
+					v, err := readUint(r, start, n)
+					if err == nil && v > 0 {
+						scale = int64(v)
+					}
+					return err
+				case idDuration:
+					v, err := readFloat(r, start, n)
+					duration = v
+					return err
+				}
+				return nil
+			})
+		case idTracks:
+			foundTracks = true
+			err = children(r, start, start+n, func(id uint32, start, n int64) error {
+				if id != idTrackEntry {
+					return nil
+				}
+				t, err := readTrack(r, start, start+n)
+				if err == nil && t.Type != 0 {
+					info.Tracks = append(info.Tracks, t)
+				}
+				return err
+			})
+		}
+		if err != nil {
+			return info, err
+		}
+
+		offset = start + n
+	}
+
+	if !foundTracks {
+		return info, errMalformed
+	}
+	info.Duration = time.Duration(duration * float64(scale))
+
+	return info, nil
+}
+
+func readTrack(r io.ReaderAt, start, end int64) (Track, error) {
+	t := Track{Default: true}
+	language, ietf := "eng", ""
+
+	err := children(r, start, end, func(id uint32, start, n int64) error {
+		var err error
+		switch id {
+		case idTrackType:
+			var v uint64
+			v, err = readUint(r, start, n)
+			switch v {
+			case 1:
+				t.Type = Video
+			case 2:
+				t.Type = Audio
+			case 17:
+				t.Type = Subtitle
+			}
+		case idCodecID:
+			var s string
+			s, err = readString(r, start, n)
+			t.Codec = codecName(s)
+		case idLanguage:
+			language, err = readString(r, start, n)
+		case idLanguageIETF:
+			ietf, err = readString(r, start, n)
+		case idName:
+			t.Name, err = readString(r, start, n)
+		case idFlagDefault:
+			var v uint64
+			v, err = readUint(r, start, n)
+			t.Default = v == 1
+		case idFlagForced:
+			var v uint64
+			v, err = readUint(r, start, n)
+			t.Forced = v == 1
+		case idVideo:
+			err = children(r, start, start+n, func(id uint32, start, n int64) error {
+				v, err := readUint(r, start, n)
+				switch id {
+				case idPixelWidth:
+					t.Width = int(v)
+				case idPixelHeight:
+					t.Height = int(v)
+				default:
+					return nil
+				}
+				return err
+			})
+		case idAudio:
+			err = children(r, start, start+n, func(id uint32, start, n int64) error {
+				switch id {
+				case idSamplingFreq:
+					v, err := readFloat(r, start, n)
+					t.SampleRate = int(v)
+					return err
+				case idChannels:
+					v, err := readUint(r, start, n)
+					t.Channels = int(v)
+					return err
+				}
+				return nil
+			})
+		}
+		return err
+	})
+
+	t.Language = language
+	if ietf != "" {
+		t.Language = ietf
+	}
+	return t, err
+}
+
+// children calls fn for every child element of the master element between
+// start and end
+func children(r io.ReaderAt, start, end int64, fn func(id uint32, start, n int64) error) error {
+	for offset := start; offset < end; {
+		id, dataStart, n, err := readElement(r, offset)
+		if err != nil {
+			return err
+		}
+		if n == unknownSize || dataStart+n > end {
+			return errMalformed
+		}
+		if err := fn(id, dataStart, n); err != nil {
+			return err
+		}
+		offset = dataStart + n
+	}
+	return nil
+}
+
+// readElement reads the element header at the offset and returns the
+// element ID, the offset of its data and the size of its data
+func readElement(r io.ReaderAt, offset int64) (uint32, int64, int64, error) {
+	buf := make([]byte, 12)
+	n, err := r.ReadAt(buf, offset)
+	if n == 0 && err != nil {
+		return 0, 0, 0, errMalformed
+	}
+	buf = buf[:n]
+
+	idLen := vintLength(buf[0])
+	if idLen > 4 || idLen >= len(buf) {
+		return 0, 0, 0, errMalformed
+	}
+	var id uint32
+	for _, b := range buf[:idLen] {
+		id = id<<8 | uint32(b)
+	}
+
+	rest := buf[idLen:]
+	sizeLen := vintLength(rest[0])
+	if sizeLen > 8 || sizeLen > len(rest) {
+		return 0, 0, 0, errMalformed
+	}
+	size := int64(rest[0] & (0xff >> sizeLen))
+	unknown := size == int64(0xff>>sizeLen)
+	for _, b := range rest[1:sizeLen] {
+		size = size<<8 | int64(b)
+		unknown = unknown && b == 0xff
+	}
+	if unknown {
+		size = unknownSize
+	}
+
+	return id, offset + int64(idLen+sizeLen), size, nil
+}
+
+// vintLength returns the length of a variable length integer from the
+// position of the first set bit of its first byte
+func vintLength(b byte) int {
+	length := 1
+	for mask := byte(0x80); length <= 8 && b&mask == 0; mask >>= 1 {
+		length++
+	}
+	return length
+}
+
+func readValue(r io.ReaderAt, start, n int64) ([]byte, error) {
+	if n < 0 || n > maxValueSize {
+		return nil, errMalformed
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, start); err != nil {
+		return nil, errMalformed
+	}
+	return buf, nil
+}
+
+func readUint(r io.ReaderAt, start, n int64) (uint64, error) {
+	if n > 8 {
+		return 0, errMalformed
+	}
+	buf, err := readValue(r, start, n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, b := range buf {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func readFloat(r io.ReaderAt, start, n int64) (float64, error) {
+	buf, err := readValue(r, start, n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+	}
+	return 0, errMalformed
+}
+
+func readString(r io.ReaderAt, start, n int64) (string, error) {
+	buf, err := readValue(r, start, n)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf), "\x00"), nil
+}
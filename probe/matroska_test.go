@@ -0,0 +1,193 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// el returns a Matroska element of the ID holding the children
+func el(id uint32, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if v := byte(id >> shift); v != 0 || len(b) > 0 {
+			b = append(b, v)
+		}
+	}
+	switch n := len(data); {
+	case n < 0x7f:
+		b = append(b, 0x80|byte(n))
+	case n < 0x3fff:
+		b = append(b, 0x40|byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x01)
+		b = append(b, binary.BigEndian.AppendUint64(nil, uint64(n))[1:]...)
+	}
+	return append(b, data...)
+}
+
+// unsized returns a master element of the ID with an unknown size, as
+// written by live muxers
+func unsized(id uint32, children ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, id)
+	b = append(b, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	return append(b, bytes.Join(children, nil)...)
+}
+
+func uintEl(id uint32, v uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	return el(id, b)
+}
+
+func floatEl(id uint32, v float64) []byte {
+	return el(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+}
+
+func float32El(id uint32, v float32) []byte {
+	return el(id, binary.BigEndian.AppendUint32(nil, math.Float32bits(v)))
+}
+
+func stringEl(id uint32, s string) []byte {
+	return el(id, []byte(s))
+}
+
+var ebmlHeader = el(idEBML, stringEl(0x4282, "matroska"), uintEl(0x4287, 4))
+
+// mkvTracks are the tracks of a typical release: an HEVC video without a
+// language, which defaults to English, a 5.1 German audio track that is not
+// the default and forced English subtitles with an IETF language
+var mkvTracks = el(idTracks,
+	el(idTrackEntry,
+		uintEl(0xd7, 1),
+		uintEl(idTrackType, 1),
+		stringEl(idCodecID, "V_MPEGH/ISO/HEVC"),
+		el(idVideo, uintEl(idPixelWidth, 1920), uintEl(idPixelHeight, 800)),
+	),
+	el(idTrackEntry,
+		uintEl(0xd7, 2),
+		uintEl(idTrackType, 2),
+		stringEl(idCodecID, "A_AAC/MPEG4/LC"),
+		stringEl(idLanguage, "ger"),
+		uintEl(idFlagDefault, 0),
+		el(idAudio, floatEl(idSamplingFreq, 48000), uintEl(idChannels, 6)),
+	),
+	el(idTrackEntry,
+		uintEl(0xd7, 3),
+		uintEl(idTrackType, 17),
+		stringEl(idCodecID, "S_TEXT/UTF8"),
+		stringEl(idLanguage, "eng"),
+		stringEl(idLanguageIETF, "en-US"),
+		stringEl(idName, "Forced\x00"),
+		uintEl(idFlagForced, 1),
+	),
+	// a button track, which is not reported
+	el(idTrackEntry, uintEl(0xd7, 4), uintEl(idTrackType, 18), stringEl(idCodecID, "B_VOBBTN")),
+)
+
+var mkvWant = []Track{
+	{Type: Video, Codec: "hevc", Language: "eng", Width: 1920, Height: 800, Default: true},
+	{Type: Audio, Codec: "aac", Language: "ger", Channels: 6, SampleRate: 48000},
+	{Type: Subtitle, Codec: "subrip", Language: "en-US", Name: "Forced", Default: true, Forced: true},
+}
+
+func TestProbeMatroska(t *testing.T) {
+	info := el(idInfo, uintEl(idTimecodeScale, 1000000), floatEl(idDuration, 6843000))
+	cluster := el(idCluster, uintEl(0xe7, 0), el(0xa3, make([]byte, 200)))
+
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		tracks   []Track
+		err      error
+	}{
+		{
+			name:     "sized segment",
+			data:     bytes.Join([][]byte{ebmlHeader, el(idSegment, el(0x114d9b74, make([]byte, 20)), info, mkvTracks, cluster)}, nil),
+			duration: 6843 * time.Second,
+			tracks:   mkvWant,
+		},
+		{
+			name:     "unknown size segment",
+			data:     bytes.Join([][]byte{ebmlHeader, unsized(idSegment, mkvTracks, info, cluster)}, nil),
+			duration: 6843 * time.Second,
+			tracks:   mkvWant,
+		},
+		{
+			name: "timecode scale and float duration",
+			data: bytes.Join([][]byte{ebmlHeader, el(idSegment,
+				el(idInfo, uintEl(idTimecodeScale, 100000), float32El(idDuration, 15000)),
+				el(idTracks, el(idTrackEntry, uintEl(idTrackType, 1), stringEl(idCodecID, "V_VP9"))),
+			)}, nil),
+			duration: 1500 * time.Millisecond,
+			tracks:   []Track{{Type: Video, Codec: "vp9", Language: "eng", Default: true}},
+		},
+		{
+			name:   "without duration",
+			data:   bytes.Join([][]byte{ebmlHeader, el(idSegment, mkvTracks)}, nil),
+			tracks: mkvWant,
+		},
+		{
+			name: "tracks after the clusters",
+			data: bytes.Join([][]byte{ebmlHeader, el(idSegment, info, cluster, mkvTracks)}, nil),
+			err:  errMalformed,
+		},
+		{
+			name: "without segment",
+			data: bytes.Join([][]byte{ebmlHeader, mkvTracks}, nil),
+			err:  errMalformed,
+		},
+		{
+			name: "truncated tracks",
+			data: bytes.Join([][]byte{ebmlHeader, el(idSegment, info, mkvTracks)}, nil)[:len(ebmlHeader)+60],
+			err:  errMalformed,
+		},
+		{
+			name: "child larger than its parent",
+			data: bytes.Join([][]byte{ebmlHeader, el(idSegment, el(idTracks, []byte{idTrackEntry, 0x90, 0x83, 0x81, 0x01}))}, nil),
+			err:  errMalformed,
+		},
+		{
+			name: "oversized value",
+			data: bytes.Join([][]byte{ebmlHeader, el(idSegment, el(idTracks, el(idTrackEntry, stringEl(idCodecID, string(make([]byte, maxValueSize+1))))))}, nil),
+			err:  errMalformed,
+		},
+		{
+			name: "invalid duration size",
+			data: bytes.Join([][]byte{ebmlHeader, el(idSegment, el(idInfo, el(idDuration, []byte{1, 2, 3})), mkvTracks)}, nil),
+			err:  errMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Container != "matroska" {
+				t.Errorf("container = %q", info.Container)
+			}
+			if info.Duration != tt.duration {
+				t.Errorf("duration = %v, want %v", info.Duration, tt.duration)
+			}
+			if !reflect.DeepEqual(info.Tracks, tt.tracks) {
+				t.Errorf("tracks = %+v, want %+v", info.Tracks, tt.tracks)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// topLevelAtoms are the atoms an MP4 or QuickTime file starts with
+var topLevelAtoms = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true,
+	"skip": true, "wide": true, "pnot": true, "uuid": true,
+}
+
+func isAtom(typ string) bool {
+	return topLevelAtoms[typ]
+}
+
+func probeMP4(r io.ReaderAt, size int64) (Info, error) {
+	info := Info{Container: "mp4"}
+	found := false
+
+	err := atoms(r, 0, size, func(typ string, start, end int64) error {
+		if typ != "moov" {
+			return nil
+		}
+		found = true
+
+		return atoms(r, start, end, func(typ string, start, end int64) error {
+			switch typ {
+			case "mvhd":
+				timescale, duration, err := readHeaderDuration(r, start, 12, 16)
+				if err == nil && timescale > 0 {
+					info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+				}
+				return err
+			case "trak":
+				t, err := readTrak(r, start, end)
+				if err == nil && t.Type != 0 {
+					info.Tracks = append(info.Tracks, t)
+				}
+				return err
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return info, err
+	}
+	if !found {
+		return info, errMalformed
+	}
+
+	return info, nil
+}
+
+func readTrak(r io.ReaderAt, start, end int64) (Track, error) {
+	t := Track{}
+
+	err := atoms(r, start, end, func(typ string, start, end int64) error {
+		switch typ {
+		case "tkhd":
+			buf, err := readValue(r, start, min(end-start, 96))
+			if err != nil {
+				return err
+			}
+			if len(buf) < 4 {
+				return errMalformed
+			}
+			t.Default = buf[3]&0x1 != 0
+
+			// width and height are 16.16 fixed point numbers at the end
+			offset := 76
+			if buf[0] == 1 {
+				offset = 88
+			}
+			if len(buf) >= offset+8 {
+				t.Width = int(binary.BigEndian.Uint32(buf[offset:]) >> 16)
+				t.Height = int(binary.BigEndian.Uint32(buf[offset+4:]) >> 16)
+			}
+			return nil
+
+		case "mdia":
+			return atoms(r, start, end, func(typ string, start, end int64) error {
+				switch typ {
+				case "mdhd":
+					buf, err := readValue(r, start, min(end-start, 34))
+					if err != nil {
+						return err
+					}
+					offset := 20
+					if len(buf) > 0 && buf[0] == 1 {
+						offset = 32
+					}
+					if len(buf) >= offset+2 {
+						t.Language = unpackLanguage(binary.BigEndian.Uint16(buf[offset:]))
+					}
+					return nil
+
+				case "hdlr":
+					buf, err := readValue(r, start, min(end-start, 12))
+					if err != nil {
+						return err
+					}
+					if len(buf) < 12 {
+						return errMalformed
+					}
+					switch string(buf[8:12]) {
+					case "vide":
+						t.Type = Video
+					case "soun":
+						t.Type = Audio
+					case "subt", "sbtl", "text", "clcp":
+						t.Type = Subtitle
+					}
+					return nil
+
+				case "minf":
+					return atoms(r, start, end, func(typ string, start, end int64) error {
+						if typ != "stbl" {
+							return nil
+						}
+						return atoms(r, start, end, func(typ string, start, end int64) error {
+							if typ != "stsd" {
+								return nil
+							}
+							return readSampleEntry(r, &t, start, end)
+						})
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+
+	if t.Type != Video {
+		t.Width, t.Height = 0, 0
+	}
+	return t, err
+}
+
+// readSampleEntry reads the codec and the stream details of the first
+// sample description
+func readSampleEntry(r io.ReaderAt, t *Track, start, end int64) error {
+	// version, flags and the entry count come before the first entry
+	buf, err := readValue(r, start+8, min(end-start-8, 36))
+	if err != nil {
+		return err
+	}
+	if len(buf) < 8 {
+		return errMalformed
+	}
+	t.Codec = codecName(string(buf[4:8]))
+
+	switch {
+	case t.Type == Video && len(buf) >= 36:
+		t.Width = int(binary.BigEndian.Uint16(buf[32:]))
+		t.Height = int(binary.BigEndian.Uint16(buf[34:]))
+	case t.Type == Audio && len(buf) >= 36:
+		t.Channels = int(binary.BigEndian.Uint16(buf[24:]))
+		t.SampleRate = int(binary.BigEndian.Uint32(buf[32:]) >> 16)
+	}
+	return nil
+}
+
+// readHeaderDuration reads the timescale and duration of a version 0 or 1
+// movie or media header box. The offsets are those of version 0.
+func readHeaderDuration(r io.ReaderAt, start int64, timescaleAt, durationAt int) (uint32, uint64, error) {
+	buf, err := readValue(r, start, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	if buf[0] == 1 {
+		// creation and modification times are 64 bit
+		return binary.BigEndian.Uint32(buf[timescaleAt+8:]), binary.BigEndian.Uint64(buf[durationAt+8:]), nil
+	}
+	return binary.BigEndian.Uint32(buf[timescaleAt:]), uint64(binary.BigEndian.Uint32(buf[durationAt:])), nil
+}
+
+// unpackLanguage decodes the packed ISO 639-2/T language code of a media
+// header
+func unpackLanguage(v uint16) string {
+	if v == 0 || v == 0x7fff {
+		return ""
+	}
+	b := []byte{
+		byte(v>>10&0x1f) + 0x60,
+		byte(v>>5&0x1f) + 0x60,
+		byte(v&0x1f) + 0x60,
+	}
+	for _, c := range b {
+		if c < 'a' || c > 'z' {
+			return ""
+		}
+	}
+	return string(b)
+}
+
+// atoms calls fn with the type and payload range of every atom between
+// start and end
+func atoms(r io.ReaderAt, start, end int64, fn func(typ string, start, end int64) error) error {
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return errMalformed
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return errMalformed
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return errMalformed
+		}
+
+		if err := fn(typ, offset+headerSize, offset+size); err != nil {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// box returns an MP4 atom of the type holding the children
+func box(typ string, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	b = append(b, typ...)
+	return append(b, data...)
+}
+
+// mvhd returns a version 0 or 1 movie header
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	b := []byte{version, 0, 0, 0}
+	if version == 1 {
+		b = append(b, make([]byte, 16)...)
+		b = binary.BigEndian.AppendUint32(b, timescale)
+		b = binary.BigEndian.AppendUint64(b, duration)
+	} else {
+		b = append(b, make([]byte, 8)...)
+		b = binary.BigEndian.AppendUint32(b, timescale)
+		b = binary.BigEndian.AppendUint32(b, uint32(duration))
+	}
+	return box("mvhd", b, make([]byte, 80))
+}
+
+// tkhd returns a version 0 track header with the flags and dimensions
+func tkhd(flags byte, width, height uint32) []byte {
+	b := []byte{0, 0, 0, flags}
+	b = append(b, make([]byte, 72)...)
+	b = binary.BigEndian.AppendUint32(b, width<<16)
+	b = binary.BigEndian.AppendUint32(b, height<<16)
+	return box("tkhd", b)
+}
+
+// mdhd returns a version 0 media header with the packed language
+func mdhd(language string) []byte {
+	b := make([]byte, 20)
+	var packed uint16
+	for _, c := range []byte(language) {
+		packed = packed<<5 | uint16(c-0x60)
+	}
+	b = binary.BigEndian.AppendUint16(b, packed)
+	return box("mdhd", b, make([]byte, 2))
+}
+
+func hdlr(handler string) []byte {
+	b := make([]byte, 8)
+	b = append(b, handler...)
+	return box("hdlr", b, make([]byte, 13))
+}
+
+// stsd returns a sample description with a single entry of the format.
+// Video entries carry the width and height, audio entries the channels and
+// the 16.16 sample rate.
+func stsd(format string, a, b uint32) []byte {
+	entry := make([]byte, 8)
+	switch format {
+	case "mp4a", "ac-3", "Opus":
+		entry = append(entry, make([]byte, 8)...)
+		entry = binary.BigEndian.AppendUint16(entry, uint16(a))
+		entry = append(entry, make([]byte, 6)...)
+		entry = binary.BigEndian.AppendUint32(entry, b<<16)
+	default:
+		entry = append(entry, make([]byte, 16)...)
+		entry = binary.BigEndian.AppendUint16(entry, uint16(a))
+		entry = binary.BigEndian.AppendUint16(entry, uint16(b))
+		entry = append(entry, make([]byte, 50)...)
+	}
+	return box("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 1}, box(format, entry))
+}
+
+func trak(header []byte, language, handler string, description []byte) []byte {
+	return box("trak", header, box("mdia", mdhd(language), hdlr(handler), box("minf", box("stbl", description))))
+}
+
+var mp4Tracks = [][]byte{
+	trak(tkhd(3, 1280, 536), "und", "vide", stsd("avc1", 1280, 536)),
+	trak(tkhd(3, 0, 0), "eng", "soun", stsd("mp4a", 2, 44100)),
+	trak(tkhd(0, 0, 0), "fra", "soun", stsd("ac-3", 6, 48000)),
+	trak(tkhd(0, 0, 0), "spa", "sbtl", stsd("tx3g", 0, 0)),
+	// a timecode track, which is not reported
+	trak(tkhd(0, 0, 0), "und", "tmcd", stsd("tmcd", 0, 0)),
+}
+
+var mp4Want = []Track{
+	{Type: Video, Codec: "h264", Language: "und", Width: 1280, Height: 536, Default: true},
+	{Type: Audio, Codec: "aac", Language: "eng", Channels: 2, SampleRate: 44100, Default: true},
+	{Type: Audio, Codec: "ac3", Language: "fra", Channels: 6, SampleRate: 48000},
+	{Type: Subtitle, Codec: "mov_text", Language: "spa"},
+}
+
+func TestProbeMP4(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2avc1mp41"))
+	mdat := box("mdat", make([]byte, 300))
+	moov := func(header []byte) []byte {
+		return box("moov", append([][]byte{header}, mp4Tracks...)...)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		duration time.Duration
+		tracks   []Track
+		err      error
+	}{
+		{
+			name:     "moov first",
+			data:     bytes.Join([][]byte{ftyp, moov(mvhd(0, 1000, 5400000)), mdat}, nil),
+			duration: 90 * time.Minute,
+			tracks:   mp4Want,
+		},
+		{
+			name:     "moov last",
+			data:     bytes.Join([][]byte{ftyp, mdat, moov(mvhd(0, 600, 3600000))}, nil),
+			duration: 100 * time.Minute,
+			tracks:   mp4Want,
+		},
+		{
+			name:     "version 1 header",
+			data:     bytes.Join([][]byte{ftyp, moov(mvhd(1, 90000, 90000*7200)), mdat}, nil),
+			duration: 2 * time.Hour,
+			tracks:   mp4Want,
+		},
+		{
+			name:   "without movie header",
+			data:   bytes.Join([][]byte{ftyp, box("moov", mp4Tracks[0]), mdat}, nil),
+			tracks: mp4Want[:1],
+		},
+		{
+			name: "without moov",
+			data: bytes.Join([][]byte{ftyp, mdat}, nil),
+			err:  errMalformed,
+		},
+		{
+			name: "truncated moov",
+			data: bytes.Join([][]byte{ftyp, mdat, moov(mvhd(0, 1000, 1000))}, nil)[:len(ftyp)+len(mdat)+100],
+			err:  errMalformed,
+		},
+		{
+			name: "atom larger than its parent",
+			data: bytes.Join([][]byte{ftyp, box("moov", box("trak", binary.BigEndian.AppendUint32(nil, 100), []byte("mdia")))}, nil),
+			err:  errMalformed,
+		},
+		{
+			name: "short handler",
+			data: bytes.Join([][]byte{ftyp, box("moov", box("trak", box("mdia", box("hdlr", []byte{0, 0, 0, 0}))))}, nil),
+			err:  errMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Container != "mp4" {
+				t.Errorf("container = %q", info.Container)
+			}
+			if info.Duration != tt.duration {
+				t.Errorf("duration = %v, want %v", info.Duration, tt.duration)
+			}
+			if !reflect.DeepEqual(info.Tracks, tt.tracks) {
+				t.Errorf("tracks = %+v, want %+v", info.Tracks, tt.tracks)
+			}
+		})
+	}
+}
+
+func TestUnpackLanguage(t *testing.T) {
+	tests := []struct {
+		packed uint16
+		want   string
+	}{
+		{0x15c7, "eng"},
+		{0x55c4, "und"},
+		{0, ""},
+		{0x7fff, ""},
+		{0x7c00, ""},
+	}
+	for _, tt := range tests {
+		if got := unpackLanguage(tt.packed); got != tt.want {
+			t.Errorf("unpackLanguage(%#x) = %q, want %q", tt.packed, got, tt.want)
+		}
+	}
+}
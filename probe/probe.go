@@ -0,0 +1,287 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// ErrUnsupported is returned for containers the probe cannot read
+var ErrUnsupported = errors.New("unsupported container")
+
+// TrackType ...
+type TrackType int
+
+const (
+	Video TrackType = iota + 1
+	Audio
+	Subtitle
+)
+
+// Track is a single stream of the container
+type Track struct {
+	Type       TrackType `json:"type"`
+	Codec      string    `json:"codec"`
+	Language   string    `json:"language,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	Channels   int       `json:"channels,omitempty"`
+	SampleRate int       `json:"sample_rate,omitempty"`
+	Default    bool      `json:"default,omitempty"`
+	Forced     bool      `json:"forced,omitempty"`
+}
+
+// Info is the stream information read from a media file
+type Info struct {
+	Container  string        `json:"container"`
+	Duration   time.Duration `json:"duration"`
+	Tracks     []Track       `json:"tracks"`
+	Mismatches []string      `json:"mismatches,omitempty"`
+}
+
+// File probes the media file. MKV/WebM and MP4/QuickTime are supported.
+func File(filename string) (Info, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Probe(f, fi.Size())
+}
+
+// Probe reads the stream information from the container
+func Probe(r io.ReaderAt, size int64) (Info, error) {
+	head := make([]byte, 8)
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return Info{}, ErrUnsupported
+	}
+
+	switch {
+	case string(head[:4]) == "\x1a\x45\xdf\xa3":
+		return probeMatroska(r, size)
+	case isAtom(string(head[4:8])):
+		return probeMP4(r, size)
+	}
+	return Info{}, ErrUnsupported
+}
+
+// Video returns the first video track
+func (i Info) Video() (Track, bool) {
+	for _, t := range i.Tracks {
+		if t.Type == Video {
+			return t, true
+		}
+	}
+	return Track{}, false
+}
+
+// Languages returns the distinct languages of the tracks of the given type
+func (i Info) Languages(typ TrackType) []string {
+	seen := map[string]bool{}
+	langs := []string{}
+	for _, t := range i.Tracks {
+		if t.Type != typ || t.Language == "" || seen[t.Language] {
+			continue
+		}
+		seen[t.Language] = true
+		langs = append(langs, t.Language)
+	}
+	return langs
+}
+
+// MapToProto ...
+func (i Info) MapToProto() *moviedownloader.MediaInfo {
+	info := &moviedownloader.MediaInfo{
+		Container:       i.Container,
+		DurationSeconds: int64(i.Duration.Seconds()),
+		Mismatches:      append([]string{}, i.Mismatches...),
+	}
+	if v, ok := i.Video(); ok {
+		info.VideoCodec = v.Codec
+		info.Width = int32(v.Width)
+		info.Height = int32(v.Height)
+	}
+	for _, t := range i.Tracks {
+		track := &moviedownloader.MediaTrack{
+			Codec:      t.Codec,
+			Language:   t.Language,
+			Name:       t.Name,
+			Channels:   int32(t.Channels),
+			SampleRate: int32(t.SampleRate),
+			Default:    t.Default,
+			Forced:     t.Forced,
+		}
+		switch t.Type {
+		case Audio:
+			info.Audio = append(info.Audio, track)
+		case Subtitle:
+			info.Subtitles = append(info.Subtitles, track)
+		}
+	}
+	return info
+}
+
+// Compare returns a description of every difference between the probed
+// streams and the metadata advertised by the provider. Fields the provider
+// did not fill in are not compared.
+func Compare(info Info, mv movie.Movie) []string {
+	mismatches := []string{}
+
+	if runtime, ok := mv.RuntimeDuration(); ok && info.Duration > 0 {
+		tolerance := math.Max(60, 0.05*runtime.Seconds())
+		if math.Abs(info.Duration.Seconds()-runtime.Seconds()) > tolerance {
+			mismatches = append(mismatches, fmt.Sprintf("runtime: advertised %s, actual %s", runtime, info.Duration.Round(time.Second)))
+		}
+	}
+
+	if v, ok := info.Video(); ok {
+		if advertised := NormalizeCodec(mv.VideoCodec); advertised != "" && advertised != v.Codec {
+			mismatches = append(mismatches, fmt.Sprintf("video codec: advertised %s, actual %s", mv.VideoCodec, v.Codec))
+		}
+
+		width, height := mv.Dimensions()
+		if (width > 0 && width != v.Width) || (height > 0 && height != v.Height) {
+			mismatches = append(mismatches, fmt.Sprintf("resolution: advertised %dx%d, actual %dx%d", width, height, v.Width, v.Height))
+		}
+	}
+
+	mismatches = append(mismatches, compareLanguages("audio", mv.Alangs, info.Languages(Audio))...)
+	mismatches = append(mismatches, compareLanguages("subtitle", mv.Slangs, info.Languages(Subtitle))...)
+
+	return mismatches
+}
+
+func compareLanguages(kind string, advertised, actual []string) []string {
+	found := map[string]bool{}
+	for _, l := range actual {
+		found[NormalizeLanguage(l)] = true
+	}
+	if found["und"] || found[""] {
+		// tracks without a language could be any of the advertised ones
+		return nil
+	}
+
+	mismatches := []string{}
+	for _, l := range advertised {
+		if l = NormalizeLanguage(l); l != "" && l != "und" && !found[l] {
+			mismatches = append(mismatches, fmt.Sprintf("%s language %s advertised but not found", kind, l))
+		}
+	}
+	return mismatches
+}
+
+// codecs maps the Matroska codec IDs and MP4 sample entry types to short
+// codec names
+var codecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MS/VFW/FOURCC":  "vfw",
+	"V_MPEG2":          "mpeg2",
+	"A_AAC":            "aac",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_DTS":            "dts",
+	"A_TRUEHD":         "truehd",
+	"A_FLAC":           "flac",
+	"A_OPUS":           "opus",
+	"A_VORBIS":         "vorbis",
+	"A_MPEG/L3":        "mp3",
+	"S_TEXT/UTF8":      "subrip",
+	"S_TEXT/ASS":       "ass",
+	"S_TEXT/SSA":       "ass",
+	"S_TEXT/WEBVTT":    "webvtt",
+	"S_HDMV/PGS":       "pgs",
+	"S_VOBSUB":         "vobsub",
+	"avc1":             "h264",
+	"avc3":             "h264",
+	"hvc1":             "hevc",
+	"hev1":             "hevc",
+	"av01":             "av1",
+	"vp09":             "vp9",
+	"mp4v":             "mpeg4",
+	"mp4a":             "aac",
+	"ac-3":             "ac3",
+	"ec-3":             "eac3",
+	"Opus":             "opus",
+	"fLaC":             "flac",
+	"tx3g":             "mov_text",
+	"wvtt":             "webvtt",
+	"c608":             "eia_608",
+}
+
+func codecName(id string) string {
+	if name, ok := codecs[id]; ok {
+		return name
+	}
+	// A_AAC/MPEG4/LC and friends
+	for prefix, name := range codecs {
+		if strings.HasPrefix(id, prefix+"/") {
+			return name
+		}
+	}
+	return strings.ToLower(id)
+}
+
+// NormalizeCodec maps the free form codec names used by providers, e.g.
+// x264, AVC or H.265, to the names reported by the probe
+func NormalizeCodec(codec string) string {
+	c := strings.ToLower(strings.NewReplacer(".", "", "-", "", " ", "").Replace(codec))
+	switch {
+	case c == "":
+		return ""
+	case strings.Contains(c, "265") || strings.Contains(c, "hevc"):
+		return "hevc"
+	case strings.Contains(c, "264") || strings.Contains(c, "avc"):
+		return "h264"
+	case strings.Contains(c, "av1"):
+		return "av1"
+	case strings.Contains(c, "vp9"):
+		return "vp9"
+	case strings.Contains(c, "xvid") || strings.Contains(c, "divx") || c == "mpeg4":
+		return "mpeg4"
+	}
+	return ""
+}
+
+// languages maps ISO 639-2 codes, bibliographic and terminologic, to ISO
+// 639-1 codes
+var languages = map[string]string{
+	"eng": "en", "fre": "fr", "fra": "fr", "ger": "de", "deu": "de",
+	"spa": "es", "ita": "it", "por": "pt", "dut": "nl", "nld": "nl",
+	"rus": "ru", "jpn": "ja", "chi": "zh", "zho": "zh", "kor": "ko",
+	"swe": "sv", "nor": "no", "nob": "no", "dan": "da", "fin": "fi",
+	"pol": "pl", "tur": "tr", "ara": "ar", "hin": "hi", "cze": "cs",
+	"ces": "cs", "gre": "el", "ell": "el", "heb": "he", "hun": "hu",
+	"rum": "ro", "ron": "ro", "tha": "th", "ukr": "uk", "vie": "vi",
+}
+
+// NormalizeLanguage returns the two letter code of the language when it is
+// known, e.g. en for eng or en-US
+func NormalizeLanguage(lang string) string {
+	l := strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(l, "-_"); i > 0 {
+		l = l[:i]
+	}
+	if two, ok := languages[l]; ok {
+		return two
+	}
+	return l
+}
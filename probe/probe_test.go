@@ -0,0 +1,131 @@
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/midgarco/movie_downloader/movie"
+)
+
+func TestProbeUnsupported(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("RIFF\x10\x00\x00\x00AVI LIST"),
+		[]byte("<html><body>Not Found</body></html>"),
+		{0x47, 0, 0, 0},
+		{},
+	} {
+		if _, err := Probe(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Probe(%q) err = %v, want ErrUnsupported", data, err)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	info := Info{
+		Duration: 6843 * time.Second,
+		Tracks:   mkvWant,
+	}
+	tests := []struct {
+		name string
+		mv   movie.Movie
+		want []string
+	}{
+		{
+			name: "nothing advertised",
+		},
+		{
+			name: "matching",
+			mv: movie.Movie{
+				Runtime:    "1:54:00",
+				VideoCodec: "x265",
+				Width:      "1920",
+				Height:     "800",
+				Alangs:     []string{"de"},
+				Slangs:     []string{"en"},
+			},
+		},
+		{
+			name: "within the runtime tolerance",
+			mv:   movie.Movie{Runtime: "2h 0m 0s"},
+		},
+		{
+			name: "mismatching",
+			mv: movie.Movie{
+				Runtime:    "1:30:00",
+				VideoCodec: "AVC",
+				Width:      "3840",
+				Height:     "2160",
+				Alangs:     []string{"German", "fr"},
+				Slangs:     []string{"en", "es"},
+			},
+			want: []string{
+				"runtime: advertised 1h30m0s, actual 1h54m3s",
+				"video codec: advertised AVC, actual hevc",
+				"resolution: advertised 3840x2160, actual 1920x800",
+				"audio language german advertised but not found",
+				"audio language fr advertised but not found",
+				"subtitle language es advertised but not found",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Compare(info, tt.mv)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Compare = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// tracks without a language could be any advertised language
+	und := Info{Tracks: []Track{{Type: Audio, Language: "und"}}}
+	if got := Compare(und, movie.Movie{Alangs: []string{"fr"}}); len(got) != 0 {
+		t.Errorf("Compare with und = %q", got)
+	}
+}
+
+func TestNormalizeCodec(t *testing.T) {
+	tests := map[string]string{
+		"x264":    "h264",
+		"H.264":   "h264",
+		"AVC":     "h264",
+		"x265":    "hevc",
+		"H-265":   "hevc",
+		"HEVC":    "hevc",
+		"AV1":     "av1",
+		"VP9":     "vp9",
+		"XviD":    "mpeg4",
+		"DivX":    "mpeg4",
+		"MPEG-4":  "mpeg4",
+		"VC-1":    "",
+		"unknown": "",
+		"":        "",
+	}
+	for codec, want := range tests {
+		if got := NormalizeCodec(codec); got != want {
+			t.Errorf("NormalizeCodec(%q) = %q, want %q", codec, got, want)
+		}
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"eng":   "en",
+		"ger":   "de",
+		"deu":   "de",
+		"en-US": "en",
+		"pt_BR": "pt",
+		" FRE ": "fr",
+		"de":    "de",
+		"und":   "und",
+		"":      "",
+	}
+	for lang, want := range tests {
+		if got := NormalizeLanguage(lang); got != want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
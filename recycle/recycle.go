@@ -0,0 +1,266 @@
+package recycle
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/midgarco/movie_downloader/movie"
+	"github.com/midgarco/movie_downloader/probe"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+var (
+	// ErrNotFound is returned when an item is not in the recycle bin
+	ErrNotFound = errors.New("item not found in the recycle bin")
+
+	// ErrExists is returned when a restore would overwrite an existing file
+	ErrExists = errors.New("a file already exists at the original location")
+
+	// ErrNotRegular is returned when a directory, a symlink or another
+	// file that is not a regular file is deleted
+	ErrNotRegular = errors.New("only regular files can be moved to the recycle bin")
+)
+
+// Item is a file that was moved into the recycle bin
+type Item struct {
+	ID           string       `json:"id"`
+	OriginalPath string       `json:"original_path"`
+	Filename     string       `json:"filename"`
+	Size         int64        `json:"size"`
+	DeletedAt    time.Time    `json:"deleted_at"`
+	DownloadID   string       `json:"download_id,omitempty"`
+	Details      *movie.Movie `json:"details,omitempty"`
+
+	// Set, SetName, SHA256 and Media are kept from the deleted download so
+	// it is restored as it was
+	Set     string      `json:"set,omitempty"`
+	SetName string      `json:"set_name,omitempty"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Media   *probe.Info `json:"media,omitempty"`
+}
+
+// MapToProto ...
+func (i Item) MapToProto(retention time.Duration) *moviedownloader.RecycledItem {
+	item := &moviedownloader.RecycledItem{
+		Id:           i.ID,
+		OriginalPath: i.OriginalPath,
+		Filename:     filepath.Base(i.OriginalPath),
+		Size:         i.Size,
+		DeletedAt:    i.DeletedAt.Format(time.RFC3339),
+		DownloadId:   i.DownloadID,
+	}
+	if retention > 0 {
+		item.ExpiresAt = i.DeletedAt.Add(retention).Format(time.RFC3339)
+	}
+	if i.Details != nil {
+		item.Details = i.Details.MapToProto()
+	}
+	return item
+}
+
+// Bin moves deleted files into a directory and keeps an index of where they
+// came from, persisted as JSON, so they can be restored until they are
+// purged
+type Bin struct {
+	mu       sync.Mutex
+	dir      string
+	filename string
+	items    map[string]*Item
+}
+
+// Open loads the recycle bin index. A missing index results in an empty
+// bin.
+func Open(dir, filename string) (*Bin, error) {
+	b := &Bin{
+		dir:      dir,
+		filename: filename,
+		items:    map[string]*Item{},
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, err
+	}
+
+	list := []*Item{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		b.items[item.ID] = item
+	}
+
+	return b, nil
+}
+
+// Add moves the file into the recycle bin. The download fields of the
+// origin, its ID, details, set, checksum and media information, are
+// optional and kept so a restored download can be put back; the other
+// fields are filled in. ErrNotRegular is returned for anything but a
+// regular file. The file is moved back when the index cannot be saved.
+func (b *Bin) Add(path string, origin Item) (Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return Item{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return Item{}, ErrNotRegular
+	}
+
+	item := &origin
+	item.ID = uuid.NewString()
+	item.OriginalPath = path
+	item.Size = fi.Size()
+	item.DeletedAt = time.Now()
+	item.Filename = item.ID + filepath.Ext(path)
+
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return Item{}, err
+	}
+	recycled := filepath.Join(b.dir, item.Filename)
+	if err := move(path, recycled); err != nil {
+		return Item{}, err
+	}
+
+	b.items[item.ID] = item
+	if err := b.save(); err != nil {
+		// an item missing from the index could never be restored
+		delete(b.items, item.ID)
+		if merr := move(recycled, path); merr != nil {
+			return Item{}, errors.Join(err, merr)
+		}
+		return Item{}, err
+	}
+	return *item, nil
+}
+
+// Restore moves the item back to its original location. ErrExists is
+// returned when a file was created there in the meantime.
+func (b *Bin) Restore(id string) (Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	item, ok := b.items[id]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+
+	if _, err := os.Stat(item.OriginalPath); err == nil {
+		return *item, ErrExists
+	}
+	if err := os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+		return *item, err
+	}
+	if err := move(filepath.Join(b.dir, item.Filename), item.OriginalPath); err != nil {
+		return *item, err
+	}
+
+	delete(b.items, id)
+	return *item, b.save()
+}
+
+// List returns the items in the recycle bin, most recently deleted first
+func (b *Bin) List() []Item {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := make([]Item, 0, len(b.items))
+	for _, item := range b.items {
+		list = append(list, *item)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeletedAt.After(list[j].DeletedAt) })
+
+	return list
+}
+
+// Purge permanently deletes the items that were deleted before the cutoff.
+// It returns the number of purged items.
+func (b *Bin) Purge(cutoff time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	purged := 0
+	var errs []error
+	for id, item := range b.items {
+		if !item.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(b.dir, item.Filename)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+			continue
+		}
+		delete(b.items, id)
+		purged++
+	}
+	if purged > 0 {
+		errs = append(errs, b.save())
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+func (b *Bin) save() error {
+	list := make([]*Item, 0, len(b.items))
+	for _, item := range b.items {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DeletedAt.Before(list[j].DeletedAt) })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.filename), 0755); err != nil {
+		return err
+	}
+
+	tmp := b.filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.filename)
+}
+
+// move renames the file, falling back to copying it when the recycle bin is
+// on a different file system
+func move(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,73 @@
+package recycle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddRejectsNonRegular(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(filepath.Join(dir, "bin"), filepath.Join(dir, "recycle.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folder := filepath.Join(dir, "folder")
+	if err := os.Mkdir(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "target.mkv")
+	if err := os.WriteFile(target, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link.mkv")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	for _, path := range []string{folder, link} {
+		if _, err := b.Add(path, Item{}); !errors.Is(err, ErrNotRegular) {
+			t.Errorf("Add(%s) err = %v, want ErrNotRegular", path, err)
+		}
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("%s was moved: %v", path, err)
+		}
+	}
+	if len(b.List()) != 0 {
+		t.Fatalf("items = %v", b.List())
+	}
+}
+
+func TestAddRollsBackWhenSaveFails(t *testing.T) {
+	dir := t.TempDir()
+	b, err := Open(filepath.Join(dir, "bin"), filepath.Join(dir, "recycle.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index cannot be written below a file
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b.filename = filepath.Join(blocker, "recycle.json")
+
+	path := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Add(path, Item{}); err == nil {
+		t.Fatal("Add succeeded without an index")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "video" {
+		t.Fatalf("file was not moved back: %q, %v", data, err)
+	}
+	if len(b.List()) != 0 {
+		t.Fatalf("items = %v", b.List())
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "bin"))
+	if len(entries) != 0 {
+		t.Fatalf("recycle bin holds %d files", len(entries))
+	}
+}
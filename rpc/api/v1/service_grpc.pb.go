@@ -18,9 +18,25 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MovieDownloaderServiceClient interface {
 	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
-	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*Empty, error)
+	Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*DownloadResponse, error)
 	Progress(ctx context.Context, in *ProgressRequest, opts ...grpc.CallOption) (MovieDownloaderService_ProgressClient, error)
 	Completed(ctx context.Context, in *CompletedRequest, opts ...grpc.CallOption) (*CompletedResponse, error)
+	FollowSeries(ctx context.Context, in *FollowSeriesRequest, opts ...grpc.CallOption) (*Series, error)
+	UnfollowSeries(ctx context.Context, in *UnfollowSeriesRequest, opts ...grpc.CallOption) (*Empty, error)
+	ListSeries(ctx context.Context, in *ListSeriesRequest, opts ...grpc.CallOption) (*ListSeriesResponse, error)
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (MovieDownloaderService_WatchEventsClient, error)
+	ListHistory(ctx context.Context, in *ListHistoryRequest, opts ...grpc.CallOption) (*ListHistoryResponse, error)
+	ExportHistory(ctx context.Context, in *ExportHistoryRequest, opts ...grpc.CallOption) (*ExportHistoryResponse, error)
+	Retry(ctx context.Context, in *RetryRequest, opts ...grpc.CallOption) (*RetryResponse, error)
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*Empty, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error)
+	ListRecycleBin(ctx context.Context, in *ListRecycleBinRequest, opts ...grpc.CallOption) (*ListRecycleBinResponse, error)
+	SpeedTest(ctx context.Context, in *SpeedTestRequest, opts ...grpc.CallOption) (*SpeedTestResponse, error)
+	Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error)
+	ImportNZB(ctx context.Context, in *ImportNZBRequest, opts ...grpc.CallOption) (*DownloadResponse, error)
+	Preview(ctx context.Context, in *PreviewRequest, opts ...grpc.CallOption) (*PreviewResponse, error)
+	Thumbnail(ctx context.Context, in *ThumbnailRequest, opts ...grpc.CallOption) (*ThumbnailResponse, error)
 }
 
 type movieDownloaderServiceClient struct {
@@ -40,8 +56,8 @@ func (c *movieDownloaderServiceClient) Search(ctx context.Context, in *SearchReq
 	return out, nil
 }
 
-func (c *movieDownloaderServiceClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*Empty, error) {
-	out := new(Empty)
+func (c *movieDownloaderServiceClient) Download(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (*DownloadResponse, error) {
+	out := new(DownloadResponse)
 	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Download", in, out, opts...)
 	if err != nil {
 		return nil, err
@@ -90,14 +106,197 @@ func (c *movieDownloaderServiceClient) Completed(ctx context.Context, in *Comple
 	return out, nil
 }
 
+func (c *movieDownloaderServiceClient) FollowSeries(ctx context.Context, in *FollowSeriesRequest, opts ...grpc.CallOption) (*Series, error) {
+	out := new(Series)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/FollowSeries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) UnfollowSeries(ctx context.Context, in *UnfollowSeriesRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/UnfollowSeries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) ListSeries(ctx context.Context, in *ListSeriesRequest, opts ...grpc.CallOption) (*ListSeriesResponse, error) {
+	out := new(ListSeriesResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/ListSeries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (MovieDownloaderService_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_MovieDownloaderService_serviceDesc.Streams[1], "/midgarco.pmd.api.v1.MovieDownloaderService/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &movieDownloaderServiceWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MovieDownloaderService_WatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type movieDownloaderServiceWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *movieDownloaderServiceWatchEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *movieDownloaderServiceClient) ListHistory(ctx context.Context, in *ListHistoryRequest, opts ...grpc.CallOption) (*ListHistoryResponse, error) {
+	out := new(ListHistoryResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/ListHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) ExportHistory(ctx context.Context, in *ExportHistoryRequest, opts ...grpc.CallOption) (*ExportHistoryResponse, error) {
+	out := new(ExportHistoryResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/ExportHistory", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Retry(ctx context.Context, in *RetryRequest, opts ...grpc.CallOption) (*RetryResponse, error) {
+	out := new(RetryResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Retry", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (*RestoreResponse, error) {
+	out := new(RestoreResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) ListRecycleBin(ctx context.Context, in *ListRecycleBinRequest, opts ...grpc.CallOption) (*ListRecycleBinResponse, error) {
+	out := new(ListRecycleBinResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/ListRecycleBin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) SpeedTest(ctx context.Context, in *SpeedTestRequest, opts ...grpc.CallOption) (*SpeedTestResponse, error) {
+	out := new(SpeedTestResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/SpeedTest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Extract(ctx context.Context, in *ExtractRequest, opts ...grpc.CallOption) (*ExtractResponse, error) {
+	out := new(ExtractResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Extract", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) ImportNZB(ctx context.Context, in *ImportNZBRequest, opts ...grpc.CallOption) (*DownloadResponse, error) {
+	out := new(DownloadResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/ImportNZB", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Preview(ctx context.Context, in *PreviewRequest, opts ...grpc.CallOption) (*PreviewResponse, error) {
+	out := new(PreviewResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Preview", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *movieDownloaderServiceClient) Thumbnail(ctx context.Context, in *ThumbnailRequest, opts ...grpc.CallOption) (*ThumbnailResponse, error) {
+	out := new(ThumbnailResponse)
+	err := c.cc.Invoke(ctx, "/midgarco.pmd.api.v1.MovieDownloaderService/Thumbnail", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MovieDownloaderServiceServer is the server API for MovieDownloaderService service.
 // All implementations should embed UnimplementedMovieDownloaderServiceServer
 // for forward compatibility
 type MovieDownloaderServiceServer interface {
 	Search(context.Context, *SearchRequest) (*SearchResponse, error)
-	Download(context.Context, *DownloadRequest) (*Empty, error)
+	Download(context.Context, *DownloadRequest) (*DownloadResponse, error)
 	Progress(*ProgressRequest, MovieDownloaderService_ProgressServer) error
 	Completed(context.Context, *CompletedRequest) (*CompletedResponse, error)
+	FollowSeries(context.Context, *FollowSeriesRequest) (*Series, error)
+	UnfollowSeries(context.Context, *UnfollowSeriesRequest) (*Empty, error)
+	ListSeries(context.Context, *ListSeriesRequest) (*ListSeriesResponse, error)
+	WatchEvents(*WatchEventsRequest, MovieDownloaderService_WatchEventsServer) error
+	ListHistory(context.Context, *ListHistoryRequest) (*ListHistoryResponse, error)
+	ExportHistory(context.Context, *ExportHistoryRequest) (*ExportHistoryResponse, error)
+	Retry(context.Context, *RetryRequest) (*RetryResponse, error)
+	Remove(context.Context, *RemoveRequest) (*Empty, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	Restore(context.Context, *RestoreRequest) (*RestoreResponse, error)
+	ListRecycleBin(context.Context, *ListRecycleBinRequest) (*ListRecycleBinResponse, error)
+	SpeedTest(context.Context, *SpeedTestRequest) (*SpeedTestResponse, error)
+	Extract(context.Context, *ExtractRequest) (*ExtractResponse, error)
+	ImportNZB(context.Context, *ImportNZBRequest) (*DownloadResponse, error)
+	Preview(context.Context, *PreviewRequest) (*PreviewResponse, error)
+	Thumbnail(context.Context, *ThumbnailRequest) (*ThumbnailResponse, error)
 }
 
 // UnimplementedMovieDownloaderServiceServer should be embedded to have forward compatible implementations.
@@ -107,7 +306,7 @@ type UnimplementedMovieDownloaderServiceServer struct {
 func (UnimplementedMovieDownloaderServiceServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
 }
-func (UnimplementedMovieDownloaderServiceServer) Download(context.Context, *DownloadRequest) (*Empty, error) {
+func (UnimplementedMovieDownloaderServiceServer) Download(context.Context, *DownloadRequest) (*DownloadResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Download not implemented")
 }
 func (UnimplementedMovieDownloaderServiceServer) Progress(*ProgressRequest, MovieDownloaderService_ProgressServer) error {
@@ -116,6 +315,54 @@ func (UnimplementedMovieDownloaderServiceServer) Progress(*ProgressRequest, Movi
 func (UnimplementedMovieDownloaderServiceServer) Completed(context.Context, *CompletedRequest) (*CompletedResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Completed not implemented")
 }
+func (UnimplementedMovieDownloaderServiceServer) FollowSeries(context.Context, *FollowSeriesRequest) (*Series, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FollowSeries not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) UnfollowSeries(context.Context, *UnfollowSeriesRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnfollowSeries not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) ListSeries(context.Context, *ListSeriesRequest) (*ListSeriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSeries not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) WatchEvents(*WatchEventsRequest, MovieDownloaderService_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) ListHistory(context.Context, *ListHistoryRequest) (*ListHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListHistory not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) ExportHistory(context.Context, *ExportHistoryRequest) (*ExportHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportHistory not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Retry(context.Context, *RetryRequest) (*RetryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Retry not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Remove(context.Context, *RemoveRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Restore(context.Context, *RestoreRequest) (*RestoreResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) ListRecycleBin(context.Context, *ListRecycleBinRequest) (*ListRecycleBinResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecycleBin not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) SpeedTest(context.Context, *SpeedTestRequest) (*SpeedTestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SpeedTest not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Extract(context.Context, *ExtractRequest) (*ExtractResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Extract not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) ImportNZB(context.Context, *ImportNZBRequest) (*DownloadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportNZB not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Preview(context.Context, *PreviewRequest) (*PreviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Preview not implemented")
+}
+func (UnimplementedMovieDownloaderServiceServer) Thumbnail(context.Context, *ThumbnailRequest) (*ThumbnailResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Thumbnail not implemented")
+}
 
 // UnsafeMovieDownloaderServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to MovieDownloaderServiceServer will
@@ -203,6 +450,297 @@ func _MovieDownloaderService_Completed_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MovieDownloaderService_FollowSeries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FollowSeriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).FollowSeries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/FollowSeries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).FollowSeries(ctx, req.(*FollowSeriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_UnfollowSeries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnfollowSeriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).UnfollowSeries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/UnfollowSeries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).UnfollowSeries(ctx, req.(*UnfollowSeriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_ListSeries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSeriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).ListSeries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/ListSeries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).ListSeries(ctx, req.(*ListSeriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MovieDownloaderServiceServer).WatchEvents(m, &movieDownloaderServiceWatchEventsServer{stream})
+}
+
+type MovieDownloaderService_WatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type movieDownloaderServiceWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *movieDownloaderServiceWatchEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _MovieDownloaderService_ListHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).ListHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/ListHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).ListHistory(ctx, req.(*ListHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_ExportHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).ExportHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/ExportHistory",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).ExportHistory(ctx, req.(*ExportHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Retry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RetryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Retry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Retry",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Retry(ctx, req.(*RetryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Restore(ctx, req.(*RestoreRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_ListRecycleBin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecycleBinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).ListRecycleBin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/ListRecycleBin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).ListRecycleBin(ctx, req.(*ListRecycleBinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_SpeedTest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SpeedTestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).SpeedTest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/SpeedTest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).SpeedTest(ctx, req.(*SpeedTestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Extract_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExtractRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Extract(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Extract",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Extract(ctx, req.(*ExtractRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_ImportNZB_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportNZBRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).ImportNZB(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/ImportNZB",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).ImportNZB(ctx, req.(*ImportNZBRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Preview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PreviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Preview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Preview",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Preview(ctx, req.(*PreviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MovieDownloaderService_Thumbnail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ThumbnailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MovieDownloaderServiceServer).Thumbnail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/midgarco.pmd.api.v1.MovieDownloaderService/Thumbnail",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MovieDownloaderServiceServer).Thumbnail(ctx, req.(*ThumbnailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _MovieDownloaderService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "midgarco.pmd.api.v1.MovieDownloaderService",
 	HandlerType: (*MovieDownloaderServiceServer)(nil),
@@ -219,6 +757,66 @@ var _MovieDownloaderService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Completed",
 			Handler:    _MovieDownloaderService_Completed_Handler,
 		},
+		{
+			MethodName: "FollowSeries",
+			Handler:    _MovieDownloaderService_FollowSeries_Handler,
+		},
+		{
+			MethodName: "UnfollowSeries",
+			Handler:    _MovieDownloaderService_UnfollowSeries_Handler,
+		},
+		{
+			MethodName: "ListSeries",
+			Handler:    _MovieDownloaderService_ListSeries_Handler,
+		},
+		{
+			MethodName: "ListHistory",
+			Handler:    _MovieDownloaderService_ListHistory_Handler,
+		},
+		{
+			MethodName: "ExportHistory",
+			Handler:    _MovieDownloaderService_ExportHistory_Handler,
+		},
+		{
+			MethodName: "Retry",
+			Handler:    _MovieDownloaderService_Retry_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _MovieDownloaderService_Remove_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _MovieDownloaderService_Delete_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _MovieDownloaderService_Restore_Handler,
+		},
+		{
+			MethodName: "ListRecycleBin",
+			Handler:    _MovieDownloaderService_ListRecycleBin_Handler,
+		},
+		{
+			MethodName: "SpeedTest",
+			Handler:    _MovieDownloaderService_SpeedTest_Handler,
+		},
+		{
+			MethodName: "Extract",
+			Handler:    _MovieDownloaderService_Extract_Handler,
+		},
+		{
+			MethodName: "ImportNZB",
+			Handler:    _MovieDownloaderService_ImportNZB_Handler,
+		},
+		{
+			MethodName: "Preview",
+			Handler:    _MovieDownloaderService_Preview_Handler,
+		},
+		{
+			MethodName: "Thumbnail",
+			Handler:    _MovieDownloaderService_Thumbnail_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -226,6 +824,11 @@ var _MovieDownloaderService_serviceDesc = grpc.ServiceDesc{
 			Handler:       _MovieDownloaderService_Progress_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _MovieDownloaderService_WatchEvents_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "api/v1/service.proto",
 }
@@ -0,0 +1,153 @@
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the maximum length in bytes of a sanitized file name. It
+// stays below the common 255 byte limit to leave room for the suffixes of
+// partial downloads and their metadata.
+const MaxLength = 240
+
+// fallbackName is used when nothing is left of a name after sanitizing it
+const fallbackName = "download"
+
+// ErrEscape is returned when a path would end up outside of its root folder
+var ErrEscape = errors.New("path escapes the root folder")
+
+// reservedNames are the device names Windows does not allow as file names,
+// with or without an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Sanitize turns untrusted provider data into a single, portable path
+// element. Path separators, characters that are invalid on common
+// filesystems and control characters are replaced, leading and trailing dots
+// and spaces are trimmed, reserved device names are prefixed and the name is
+// shortened to MaxLength bytes while keeping its extension. The result is
+// never empty, "." or "..".
+func Sanitize(name string) string {
+	name = strings.ToValidUTF8(name, "_")
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|':
+			b.WriteRune('_')
+		case unicode.IsControl(r) || r == utf8.RuneError:
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name = strings.Trim(b.String(), " .")
+
+	if name == "" {
+		return fallbackName
+	}
+
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+
+	return truncate(name, MaxLength)
+}
+
+// Join sanitizes every element and joins them to the root. It returns
+// ErrEscape if the result is not inside the root, which cannot happen for
+// sanitized elements but guards against future changes.
+func Join(root string, elem ...string) (string, error) {
+	parts := make([]string, 0, len(elem)+1)
+	parts = append(parts, root)
+	for _, e := range elem {
+		parts = append(parts, Sanitize(e))
+	}
+	p := filepath.Join(parts...)
+
+	if !Within(root, p) {
+		return "", ErrEscape
+	}
+	return p, nil
+}
+
+// Within returns whether the path is located inside the root folder
+func Within(root, p string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+	if err != nil || rel == "." || rel == ".." || filepath.IsAbs(rel) {
+		return false
+	}
+	return !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// UniqueName returns the name unchanged when it is not taken, otherwise the
+// first free name with a " (n)" suffix before the extension, e.g.
+// "Movie (2).mkv". The result is deterministic for the same set of taken
+// names and never exceeds MaxLength bytes.
+func UniqueName(name string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > MaxLength/2 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	for n := 1; ; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate := truncate(base, MaxLength-len(suffix)-len(ext)) + suffix + ext
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// Unique returns the path of a name in the folder that does not exist yet,
+// adding a collision suffix when needed
+func Unique(dir, name string) string {
+	name = UniqueName(Sanitize(name), func(candidate string) bool {
+		_, err := os.Lstat(filepath.Join(dir, candidate))
+		return err == nil
+	})
+	return filepath.Join(dir, name)
+}
+
+// truncate shortens the name to max bytes, keeping the extension when
+// possible and never splitting a UTF-8 sequence
+func truncate(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) >= max/2 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	cut := max - len(ext)
+	for cut > 0 && !utf8.RuneStart(base[cut]) {
+		cut--
+	}
+	base = strings.TrimRight(base[:cut], " .")
+	if base == "" {
+		base = fallbackName
+	}
+	return base + ext
+}
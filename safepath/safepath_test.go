@@ -0,0 +1,119 @@
+package safepath
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var seeds = []string{
+	"",
+	".",
+	"..",
+	"../../etc/passwd",
+	`..\..\windows\system32`,
+	"/absolute/path.mkv",
+	"Movie.2020.1080p.mkv",
+	"CON",
+	"con.txt",
+	"LPT1 .mkv",
+	" . . ",
+	"a\x00b\x1fc",
+	"\xff\xfe invalid utf8",
+	strings.Repeat("ü", 200) + ".mkv",
+	strings.Repeat("a", 300) + "." + strings.Repeat("b", 200),
+}
+
+// checkName fails unless the name is a single, portable path element
+func checkName(t *testing.T, input, name string) {
+	t.Helper()
+	if name == "" || name == "." || name == ".." {
+		t.Fatalf("Sanitize(%q) = %q", input, name)
+	}
+	if strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, filepath.Separator) {
+		t.Fatalf("Sanitize(%q) = %q contains a separator", input, name)
+	}
+	if len(name) > MaxLength {
+		t.Fatalf("Sanitize(%q) is %d bytes long", input, len(name))
+	}
+	if !utf8.ValidString(name) {
+		t.Fatalf("Sanitize(%q) = %q is not valid UTF-8", input, name)
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		t.Fatalf("Sanitize(%q) = %q is a reserved name", input, name)
+	}
+	if Sanitize(name) != name {
+		t.Fatalf("Sanitize(%q) = %q is not stable", input, name)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for _, s := range seeds {
+		checkName(t, s, Sanitize(s))
+	}
+	if got := Sanitize("CON.mkv"); got != "_CON.mkv" {
+		t.Fatalf("Sanitize(CON.mkv) = %q", got)
+	}
+	if got := Sanitize("../x"); got != "_x" {
+		t.Fatalf("Sanitize(../x) = %q", got)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	taken := map[string]bool{"Movie.mkv": true, "Movie (1).mkv": true}
+	got := UniqueName("Movie.mkv", func(name string) bool { return taken[name] })
+	if got != "Movie (2).mkv" {
+		t.Fatalf("UniqueName = %q", got)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	root := filepath.FromSlash("/media/movies")
+	for p, want := range map[string]bool{
+		"/media/movies/a.mkv":         true,
+		"/media/movies/show/s1/e.mkv": true,
+		"/media/movies":               false,
+		"/media/movies/../tv/e.mkv":   false,
+		"/media/movies-other/a.mkv":   false,
+		"/etc/passwd":                 false,
+	} {
+		if got := Within(root, filepath.FromSlash(p)); got != want {
+			t.Errorf("Within(%s) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func FuzzSanitize(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		checkName(t, name, Sanitize(name))
+	})
+}
+
+func FuzzJoin(f *testing.F) {
+	for _, s := range seeds {
+		f.Add(s, "Season 01")
+	}
+	root := filepath.Join(f.TempDir(), "library")
+	f.Fuzz(func(t *testing.T, show, season string) {
+		p, err := Join(root, show, season)
+		if err != nil {
+			t.Fatalf("Join(%q, %q): %v", show, season, err)
+		}
+		if !Within(root, p) {
+			t.Fatalf("Join(%q, %q) = %q is outside the root", show, season, p)
+		}
+		rel, _ := filepath.Rel(root, p)
+		elems := strings.Split(rel, string(filepath.Separator))
+		if len(elems) != 2 {
+			t.Fatalf("Join(%q, %q) = %q does not have two elements", show, season, p)
+		}
+		for _, e := range elems {
+			checkName(t, e, e)
+		}
+	})
+}
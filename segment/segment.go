@@ -0,0 +1,461 @@
+package segment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StateSuffix is appended to the file name for the file that records
+	// the progress of every segment, so an interrupted download resumes
+	// each segment where it stopped
+	StateSuffix = ".segments"
+
+	// MinSegmentSize keeps small files from being split into tiny requests
+	MinSegmentSize = 16 << 20
+
+	// DefaultRetries is the number of times a failing segment is retried
+	// when the request does not say otherwise
+	DefaultRetries = 5
+
+	bufferSize = 64 << 10
+)
+
+// ErrRangesUnsupported is returned when the server does not support range
+// requests or does not report the file size, so the file cannot be split
+var ErrRangesUnsupported = errors.New("server does not support range requests")
+
+// Request describes a segmented download
+type Request struct {
+	URL      string
+	Filename string
+
+	// Segments is the number of concurrent range requests
+	Segments int
+
+	// Retries is the number of times a failing segment is retried
+	Retries int
+
+	// Prepare is called for every HTTP request, e.g. to set credentials
+	Prepare func(*http.Request)
+
+	// BeforeCopy is called with the file size and the bytes already on disk
+	// before any data is written. Returning an error stops the download.
+	BeforeCopy func(size, completed int64) error
+}
+
+// Client downloads files over multiple connections
+type Client struct {
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+type segment struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+func (s *segment) remaining() int64 {
+	return s.End - s.Start + 1 - s.Done
+}
+
+type state struct {
+	Size     int64      `json:"size"`
+	Segments []*segment `json:"segments"`
+}
+
+// Response is a running segmented download. Its methods are safe to call
+// while the download is in progress.
+type Response struct {
+	Filename string
+
+	size      int64
+	completed atomic.Int64
+	speed     atomic.Uint64
+	segments  []*segment
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	stateMu sync.Mutex
+}
+
+// Do checks that the server supports range requests and starts the
+// download in the background. ErrRangesUnsupported is returned when the
+// file cannot be split; the caller should then fall back to a single
+// connection download.
+func (c *Client) Do(req *Request) (*Response, error) {
+	size, err := c.size(req)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := loadState(req.Filename, size, req.Segments)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := &Response{
+		Filename: req.Filename,
+		size:     size,
+		segments: st.Segments,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	for _, s := range st.Segments {
+		resp.completed.Add(s.Done)
+	}
+
+	go resp.run(c, req)
+
+	return resp, nil
+}
+
+// size asks the server for the file size and whether it accepts ranges
+func (c *Client) size(req *Request) (int64, error) {
+	r, err := http.NewRequest(http.MethodGet, req.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	r.Header.Set("Range", "bytes=0-0")
+	c.prepare(req, r)
+
+	resp, err := c.HTTPClient.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+
+	if resp.StatusCode != http.StatusPartialContent {
+		if resp.StatusCode >= 400 {
+			return 0, fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+		return 0, ErrRangesUnsupported
+	}
+
+	// Content-Range: bytes 0-0/12345
+	cr := resp.Header.Get("Content-Range")
+	i := strings.LastIndexByte(cr, '/')
+	if i < 0 {
+		return 0, ErrRangesUnsupported
+	}
+	size, err := strconv.ParseInt(cr[i+1:], 10, 64)
+	if err != nil || size <= 0 {
+		return 0, ErrRangesUnsupported
+	}
+	return size, nil
+}
+
+func (c *Client) prepare(req *Request, r *http.Request) {
+	if c.UserAgent != "" {
+		r.Header.Set("User-Agent", c.UserAgent)
+	}
+	if req.Prepare != nil {
+		req.Prepare(r)
+	}
+}
+
+// loadState resumes the segments of an interrupted download. Without a
+// state file the bytes of an existing sequential partial file are kept and
+// the rest of the file is split into segments.
+func loadState(filename string, size int64, segments int) (*state, error) {
+	b, err := os.ReadFile(filename + StateSuffix)
+	if err == nil {
+		st := &state{}
+		if err := json.Unmarshal(b, st); err == nil && st.Size == size && len(st.Segments) > 0 {
+			return st, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var offset int64
+	if fi, err := os.Stat(filename); err == nil && fi.Size() <= size {
+		offset = fi.Size()
+	}
+
+	st := &state{Size: size}
+	if offset > 0 {
+		st.Segments = append(st.Segments, &segment{Start: 0, End: offset - 1, Done: offset})
+	}
+
+	remaining := size - offset
+	if max := int(remaining / MinSegmentSize); segments > max {
+		segments = max
+	}
+	if segments < 1 {
+		segments = 1
+	}
+	length := int64(math.Ceil(float64(remaining) / float64(segments)))
+	for start := offset; start < size; start += length {
+		end := start + length - 1
+		if end >= size {
+			end = size - 1
+		}
+		st.Segments = append(st.Segments, &segment{Start: start, End: end})
+	}
+
+	return st, nil
+}
+
+func (r *Response) run(c *Client, req *Request) {
+	defer close(r.done)
+	defer r.cancel()
+
+	if req.BeforeCopy != nil {
+		if r.err = req.BeforeCopy(r.size, r.completed.Load()); r.err != nil {
+			return
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.Filename), 0755); err != nil {
+		r.err = err
+		return
+	}
+	// the state must exist before any data is written out of order
+	if r.err = r.saveState(); r.err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(r.Filename, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		r.err = err
+		return
+	}
+
+	go r.measure()
+
+	retries := req.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+	)
+	for _, s := range r.segments {
+		if s.remaining() <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(s *segment) {
+			defer wg.Done()
+			if err := r.fetch(c, req, f, s, retries); err != nil {
+				once.Do(func() {
+					r.err = err
+					r.cancel()
+				})
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if err := f.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if r.err != nil {
+		r.saveState()
+		return
+	}
+	if err := os.Remove(r.Filename + StateSuffix); err != nil && !os.IsNotExist(err) {
+		r.err = err
+	}
+}
+
+// fetch downloads the rest of the segment, retrying with a growing delay
+// from where the previous attempt stopped
+func (r *Response) fetch(c *Client, req *Request, f *os.File, s *segment, retries int) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-r.ctx.Done():
+				return r.ctx.Err()
+			case <-time.After(time.Duration(1<<uint(attempt-1)) * time.Second):
+			}
+		}
+
+		if err = r.fetchOnce(c, req, f, s); err == nil {
+			return nil
+		}
+		if r.ctx.Err() != nil {
+			return r.ctx.Err()
+		}
+	}
+	return fmt.Errorf("segment %d-%d: %w", s.Start, s.End, err)
+}
+
+func (r *Response) fetchOnce(c *Client, req *Request, f *os.File, s *segment) error {
+	offset := s.Start + r.segmentDone(s)
+
+	hr, err := http.NewRequestWithContext(r.ctx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return err
+	}
+	hr.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, s.End))
+	c.prepare(req, hr)
+
+	resp, err := c.HTTPClient.Do(hr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	buf := make([]byte, bufferSize)
+	lastSave := time.Now()
+	for offset <= s.End {
+		n, rerr := resp.Body.Read(buf)
+		if int64(n) > s.End-offset+1 {
+			n = int(s.End - offset + 1)
+		}
+		if n > 0 {
+			if _, err := f.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+			offset += int64(n)
+			r.advance(s, int64(n))
+
+			if time.Since(lastSave) > 2*time.Second {
+				r.saveState()
+				lastSave = time.Now()
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	if offset <= s.End {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (r *Response) segmentDone(s *segment) int64 {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return s.Done
+}
+
+func (r *Response) advance(s *segment, n int64) {
+	r.stateMu.Lock()
+	s.Done += n
+	r.stateMu.Unlock()
+	r.completed.Add(n)
+}
+
+func (r *Response) saveState() error {
+	r.stateMu.Lock()
+	b, err := json.Marshal(state{Size: r.size, Segments: r.segments})
+	r.stateMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.Filename+StateSuffix, b, 0644)
+}
+
+// measure samples the transfer speed once a second until the download ends
+func (r *Response) measure() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	last, lastTime := r.completed.Load(), time.Now()
+	for {
+		select {
+		case <-r.done:
+			r.speed.Store(0)
+			return
+		case now := <-t.C:
+			completed := r.completed.Load()
+			speed := float64(completed-last) / now.Sub(lastTime).Seconds()
+			r.speed.Store(math.Float64bits(speed))
+			last, lastTime = completed, now
+		}
+	}
+}
+
+// Done is closed when the download finished or failed
+func (r *Response) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns the error of a failed download once Done is closed
+func (r *Response) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
+
+// Cancel stops the download, keeping the state so it can be resumed
+func (r *Response) Cancel() error {
+	r.cancel()
+	<-r.done
+	return r.err
+}
+
+// Size returns the size of the file
+func (r *Response) Size() int64 {
+	return r.size
+}
+
+// BytesComplete returns the number of bytes on disk, over all segments
+func (r *Response) BytesComplete() int64 {
+	return r.completed.Load()
+}
+
+// BytesPerSecond returns the aggregate speed of all segments
+func (r *Response) BytesPerSecond() float64 {
+	return math.Float64frombits(r.speed.Load())
+}
+
+// Progress returns the completed fraction between 0 and 1
+func (r *Response) Progress() float64 {
+	if r.size <= 0 {
+		return 0
+	}
+	return float64(r.BytesComplete()) / float64(r.size)
+}
+
+// IsComplete returns whether the download finished successfully
+func (r *Response) IsComplete() bool {
+	select {
+	case <-r.done:
+		return r.err == nil
+	default:
+		return false
+	}
+}
+
+// Segments returns the number of segments the file was split into
+func (r *Response) Segments() int {
+	return len(r.segments)
+}
@@ -0,0 +1,407 @@
+package segment
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// content returns size bytes of file data that differ at every offset of
+// a segment boundary
+func content(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i * 7 % 251)
+	}
+	return b
+}
+
+// fileServer serves the data with range support and records the Range
+// header of every request
+type fileServer struct {
+	data []byte
+
+	mu     sync.Mutex
+	ranges []string
+	agents []string
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	s.agents = append(s.agents, r.Header.Get("User-Agent"))
+	s.mu.Unlock()
+	http.ServeContent(w, r, "movie.mkv", time.Time{}, bytes.NewReader(s.data))
+}
+
+func (s *fileServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func wait(t *testing.T, resp *Response) {
+	t.Helper()
+	select {
+	case <-resp.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not finish")
+	}
+}
+
+func TestDownload(t *testing.T) {
+	fs := &fileServer{data: content(100000)}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	var beforeSize, beforeCompleted int64 = -1, -1
+	c := &Client{HTTPClient: ts.Client(), UserAgent: "test-agent"}
+	resp, err := c.Do(&Request{
+		URL:      ts.URL,
+		Filename: filename,
+		Segments: 4,
+		BeforeCopy: func(size, completed int64) error {
+			beforeSize, beforeCompleted = size, completed
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsComplete() || resp.Size() != 100000 || resp.BytesComplete() != 100000 || resp.Progress() != 1 {
+		t.Errorf("complete = %v, size = %d, bytes = %d, progress = %v", resp.IsComplete(), resp.Size(), resp.BytesComplete(), resp.Progress())
+	}
+	if beforeSize != 100000 || beforeCompleted != 0 {
+		t.Errorf("BeforeCopy(%d, %d), want (100000, 0)", beforeSize, beforeCompleted)
+	}
+	// smaller than MinSegmentSize, so not split
+	if resp.Segments() != 1 {
+		t.Errorf("Segments = %d, want 1", resp.Segments())
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fs.data) {
+		t.Error("downloaded file differs")
+	}
+	if _, err := os.Stat(filename + StateSuffix); !os.IsNotExist(err) {
+		t.Errorf("state file not removed: %v", err)
+	}
+	if want := []string{"bytes=0-0", "bytes=0-99999"}; fmt.Sprint(fs.requests()) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", fs.requests(), want)
+	}
+	for _, agent := range fs.agents {
+		if agent != "test-agent" {
+			t.Errorf("User-Agent = %q", agent)
+		}
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	const mb = 1 << 20
+	tests := []struct {
+		name     string
+		size     int64
+		partial  int64
+		segments int
+		want     []segment
+	}{
+		{
+			name:     "small file",
+			size:     mb,
+			segments: 4,
+			want:     []segment{{0, mb - 1, 0}},
+		},
+		{
+			name:     "split evenly",
+			size:     64 * mb,
+			segments: 4,
+			want:     []segment{{0, 16*mb - 1, 0}, {16 * mb, 32*mb - 1, 0}, {32 * mb, 48*mb - 1, 0}, {48 * mb, 64*mb - 1, 0}},
+		},
+		{
+			name:     "limited by the segment size",
+			size:     40 * mb,
+			segments: 8,
+			want:     []segment{{0, 20*mb - 1, 0}, {20 * mb, 40*mb - 1, 0}},
+		},
+		{
+			name:     "sequential partial file",
+			size:     40 * mb,
+			partial:  8 * mb,
+			segments: 2,
+			want:     []segment{{0, 8*mb - 1, 8 * mb}, {8 * mb, 24*mb - 1, 0}, {24 * mb, 40*mb - 1, 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "movie.mkv")
+			if tt.partial > 0 {
+				if err := os.WriteFile(filename, make([]byte, tt.partial), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			st, err := loadState(filename, tt.size, tt.segments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []segment{}
+			for _, s := range st.Segments {
+				got = append(got, *s)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("segments = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	fs := &fileServer{data: content(30000)}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+
+	// an interrupted download of three segments, each partly done
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	partial := make([]byte, 30000)
+	st := state{Size: 30000, Segments: []*segment{
+		{Start: 0, End: 9999, Done: 4000},
+		{Start: 10000, End: 19999, Done: 10000},
+		{Start: 20000, End: 29999, Done: 2500},
+	}}
+	for _, s := range st.Segments {
+		copy(partial[s.Start:s.Start+s.Done], fs.data[s.Start:])
+	}
+	if err := os.WriteFile(filename, partial, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(st)
+	if err := os.WriteFile(filename+StateSuffix, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{HTTPClient: ts.Client()}
+	var beforeCompleted int64
+	resp, err := c.Do(&Request{
+		URL:      ts.URL,
+		Filename: filename,
+		Segments: 4,
+		BeforeCopy: func(size, completed int64) error {
+			beforeCompleted = completed
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if beforeCompleted != 16500 {
+		t.Errorf("completed before the copy = %d, want 16500", beforeCompleted)
+	}
+	if resp.Segments() != 3 {
+		t.Errorf("Segments = %d, want 3", resp.Segments())
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fs.data) {
+		t.Error("resumed file differs")
+	}
+	if _, err := os.Stat(filename + StateSuffix); !os.IsNotExist(err) {
+		t.Errorf("state file not removed: %v", err)
+	}
+
+	// only the missing parts are requested, the finished segment not at all
+	requests := map[string]bool{}
+	for _, r := range fs.requests()[1:] {
+		requests[r] = true
+	}
+	want := map[string]bool{"bytes=4000-9999": true, "bytes=22500-29999": true}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestResumeIgnoresStaleState(t *testing.T) {
+	fs := &fileServer{data: content(20000)}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+
+	// the state of an earlier version of the file with another size
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	b, _ := json.Marshal(state{Size: 50000, Segments: []*segment{{Start: 0, End: 49999, Done: 49999}}})
+	if err := os.WriteFile(filename+StateSuffix, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{HTTPClient: ts.Client()}
+	resp, err := c.Do(&Request{URL: ts.URL, Filename: filename, Segments: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if err := resp.Err(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fs.data) {
+		t.Error("downloaded file differs")
+	}
+}
+
+func TestCancelKeepsState(t *testing.T) {
+	data := content(40000)
+	stop := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-0" {
+			http.ServeContent(w, r, "movie.mkv", time.Time{}, bytes.NewReader(data))
+			return
+		}
+		// half of the file, then the connection stalls
+		w.Header().Set("Content-Range", "bytes 0-39999/40000")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[:20000])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer ts.Close()
+	defer close(stop)
+
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	c := &Client{HTTPClient: ts.Client()}
+	resp, err := c.Do(&Request{URL: ts.URL, Filename: filename, Segments: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for resp.BytesComplete() < 20000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("BytesComplete = %d, want 20000", resp.BytesComplete())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := resp.Cancel(); err == nil {
+		t.Fatal("Cancel returned no error")
+	}
+	if resp.IsComplete() {
+		t.Error("cancelled download is complete")
+	}
+	b, err := os.ReadFile(filename + StateSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := state{}
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Size != 40000 || len(st.Segments) != 1 || st.Segments[0].Done != 20000 {
+		t.Errorf("state = %s", b)
+	}
+}
+
+func TestRangesUnsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    error
+	}{
+		{
+			name: "range ignored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(content(1000))
+			},
+			want: ErrRangesUnsupported,
+		},
+		{
+			name: "no size",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Range", "bytes 0-0/*")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte{0})
+			},
+			want: ErrRangesUnsupported,
+		},
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(tt.handler)
+			defer ts.Close()
+
+			filename := filepath.Join(t.TempDir(), "movie.mkv")
+			c := &Client{HTTPClient: ts.Client()}
+			_, err := c.Do(&Request{URL: ts.URL, Filename: filename, Segments: 4})
+			if err == nil {
+				t.Fatal("Do succeeded")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && errors.Is(err, ErrRangesUnsupported) {
+				t.Errorf("err = %v, want an HTTP error", err)
+			}
+			if _, err := os.Stat(filename); !os.IsNotExist(err) {
+				t.Errorf("file created: %v", err)
+			}
+		})
+	}
+}
+
+func TestBeforeCopyStops(t *testing.T) {
+	fs := &fileServer{data: content(1000)}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+
+	errFull := errors.New("disk full")
+	filename := filepath.Join(t.TempDir(), "movie.mkv")
+	c := &Client{HTTPClient: ts.Client()}
+	resp, err := c.Do(&Request{
+		URL:        ts.URL,
+		Filename:   filename,
+		BeforeCopy: func(size, completed int64) error { return errFull },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wait(t, resp)
+	if !errors.Is(resp.Err(), errFull) {
+		t.Errorf("Err = %v, want %v", resp.Err(), errFull)
+	}
+	if len(fs.requests()) != 1 {
+		t.Errorf("requests = %v, want only the size request", fs.requests())
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("file created: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package series
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/midgarco/movie_downloader/movie"
+	moviedownloader "github.com/midgarco/movie_downloader/rpc/api/v1"
+)
+
+// ErrNotFound is returned when a show is not on the wanted list
+var ErrNotFound = errors.New("series not found")
+
+// Series is a followed show on the wanted list
+type Series struct {
+	Show        string    `json:"show"`
+	Quality     string    `json:"quality,omitempty"`
+	FromSeason  int       `json:"from_season,omitempty"`
+	Grabbed     []string  `json:"grabbed,omitempty"`
+	Added       time.Time `json:"added"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+}
+
+// MapToProto ...
+func (s Series) MapToProto() *moviedownloader.Series {
+	series := &moviedownloader.Series{
+		Show:       s.Show,
+		Quality:    s.Quality,
+		FromSeason: int32(s.FromSeason),
+		Grabbed:    append([]string{}, s.Grabbed...),
+		Added:      s.Added.Format(time.RFC3339),
+	}
+	if !s.LastChecked.IsZero() {
+		series.LastChecked = s.LastChecked.Format(time.RFC3339)
+	}
+	return series
+}
+
+// Matches returns whether the release is a wanted episode of the show that
+// has not been grabbed yet
+func (s Series) Matches(mv movie.Movie, ep *movie.Episode) bool {
+	if ep == nil || movie.NormalizeTitle(ep.Show) != movie.NormalizeTitle(s.Show) {
+		return false
+	}
+	if s.FromSeason > 0 && ep.Season < s.FromSeason {
+		return false
+	}
+	if s.Quality != "" && !strings.Contains(strings.ToLower(mv.Filename+" "+mv.Resolution), strings.ToLower(s.Quality)) {
+		return false
+	}
+	if !ep.IsDaily() && s.HasGrabbed(ep.SeasonKey()) {
+		// the whole season was already grabbed as a pack
+		return false
+	}
+	return !s.HasGrabbed(ep.Key())
+}
+
+// HasGrabbed returns whether the episode key was already downloaded
+func (s Series) HasGrabbed(key string) bool {
+	for _, k := range s.Grabbed {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// WantedList is the list of followed shows, persisted as JSON
+type WantedList struct {
+	mu       sync.Mutex
+	filename string
+	series   map[string]*Series
+}
+
+// Load reads the wanted list from the file. A missing file results in an
+// empty list.
+func Load(filename string) (*WantedList, error) {
+	w := &WantedList{
+		filename: filename,
+		series:   map[string]*Series{},
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return w, nil
+		}
+		return nil, err
+	}
+
+	list := []*Series{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	for _, s := range list {
+		w.series[movie.NormalizeTitle(s.Show)] = s
+	}
+
+	return w, nil
+}
+
+// Follow adds the show to the wanted list, or updates its settings when it
+// is already being followed
+func (w *WantedList) Follow(show, quality string, fromSeason int) (Series, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := movie.NormalizeTitle(show)
+	s, ok := w.series[key]
+	if !ok {
+		s = &Series{Show: strings.TrimSpace(show), Added: time.Now()}
+		w.series[key] = s
+	}
+	s.Quality = quality
+	s.FromSeason = fromSeason
+
+	return *s, w.save()
+}
+
+// Unfollow removes the show from the wanted list
+func (w *WantedList) Unfollow(show string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := movie.NormalizeTitle(show)
+	if _, ok := w.series[key]; !ok {
+		return ErrNotFound
+	}
+	delete(w.series, key)
+
+	return w.save()
+}
+
+// List returns a copy of the followed shows sorted by name
+func (w *WantedList) List() []Series {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	list := make([]Series, 0, len(w.series))
+	for _, s := range w.series {
+		c := *s
+		c.Grabbed = append([]string{}, s.Grabbed...)
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Show < list[j].Show })
+
+	return list
+}
+
+// MarkGrabbed records that the episode was queued for download
+func (w *WantedList) MarkGrabbed(show, key string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.series[movie.NormalizeTitle(show)]
+	if !ok {
+		return ErrNotFound
+	}
+	if !s.HasGrabbed(key) {
+		s.Grabbed = append(s.Grabbed, key)
+	}
+
+	return w.save()
+}
+
+// UnmarkGrabbed forgets that the episode was queued for download, so it is
+// looked for again
+func (w *WantedList) UnmarkGrabbed(show, key string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.series[movie.NormalizeTitle(show)]
+	if !ok {
+		return ErrNotFound
+	}
+	grabbed := s.Grabbed[:0]
+	for _, k := range s.Grabbed {
+		if k != key {
+			grabbed = append(grabbed, k)
+		}
+	}
+	s.Grabbed = grabbed
+
+	return w.save()
+}
+
+// MarkChecked records the last time the show was searched
+func (w *WantedList) MarkChecked(show string, t time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.series[movie.NormalizeTitle(show)]
+	if !ok {
+		return ErrNotFound
+	}
+	s.LastChecked = t
+
+	return w.save()
+}
+
+func (w *WantedList) save() error {
+	list := make([]*Series, 0, len(w.series))
+	for _, s := range w.series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Show < list[j].Show })
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.filename), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(w.filename, b, 0644)
+}
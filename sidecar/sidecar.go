@@ -0,0 +1,228 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// NFOExt is the extension the NFO of the release is saved with
+	NFOExt = ".nfo"
+
+	// maxNFOSize and maxImageSize limit what is read from the provider, an
+	// NFO is a few kilobytes and a preview image a few hundred
+	maxNFOSize   = 1 << 20
+	maxImageSize = 10 << 20
+)
+
+var (
+	// ErrNotImage is returned when the preview image URL serves something
+	// that is not an image, e.g. a login page
+	ErrNotImage = errors.New("sidecar: preview is not an image")
+
+	// ErrUntrustedHost is returned for URLs that are not on a host of the
+	// provider, the credentials of the account are not sent anywhere else
+	ErrUntrustedHost = errors.New("sidecar: url is not on a provider host")
+)
+
+// imageExts maps the content types of preview images to the extension they
+// are saved with
+var imageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Sidecars are the NFO and the preview image of a release
+type Sidecars struct {
+	NFO       string
+	Image     []byte
+	ImageType string
+}
+
+// Empty returns whether neither the NFO nor the preview image was found
+func (s Sidecars) Empty() bool {
+	return s.NFO == "" && len(s.Image) == 0
+}
+
+// Source says where the sidecars of a release are found. The NFO is either
+// the text of the NFO or the URL it is served from.
+type Source struct {
+	NFO      string
+	ImageURL string
+}
+
+// Fetcher downloads the sidecars with the credentials of the account. Only
+// URLs on the hosts of the provider are fetched.
+type Fetcher struct {
+	Client   *http.Client
+	Username string
+	Password string
+	Hosts    []string
+}
+
+// Fetch downloads the NFO and the preview image. A missing image is not an
+// error; when one of the two fails, the other is still returned.
+func (f Fetcher) Fetch(ctx context.Context, src Source) (Sidecars, error) {
+	sc := Sidecars{}
+	var errs []error
+
+	switch {
+	case isURL(src.NFO):
+		b, _, err := f.get(ctx, src.NFO, maxNFOSize)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("nfo: %w", err))
+		}
+		sc.NFO = string(b)
+	default:
+		sc.NFO = src.NFO
+	}
+
+	if src.ImageURL != "" {
+		b, contentType, err := f.get(ctx, src.ImageURL, maxImageSize)
+		if err == nil {
+			if _, ok := imageExts[contentType]; !ok && len(b) > 0 {
+				err = ErrNotImage
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("image: %w", err))
+		} else if len(b) > 0 {
+			sc.Image, sc.ImageType = b, contentType
+		}
+	}
+
+	return sc, errors.Join(errs...)
+}
+
+// get downloads the URL and returns its content type. Not found returns no
+// content and no error.
+func (f Fetcher) get(ctx context.Context, uri string, limit int64) ([]byte, string, error) {
+	if strings.HasPrefix(uri, "//") {
+		uri = "https:" + uri
+	}
+	if !f.trusted(uri) {
+		return nil, "", ErrUntrustedHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.SetBasicAuth(f.Username, f.Password)
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, limit))
+	if err != nil {
+		return nil, "", err
+	}
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(b))
+	}
+	return b, contentType, nil
+}
+
+// trusted returns whether the URL is on one of the hosts of the provider
+func (f Fetcher) trusted(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	for _, host := range f.Hosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the sidecars into the folder as name.nfo and name.jpg, or the
+// extension of the image type, and returns the paths written
+func Save(dir, name string, sc Sidecars) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	if sc.NFO != "" {
+		p := filepath.Join(dir, name+NFOExt)
+		if err := os.WriteFile(p, []byte(sc.NFO), 0644); err != nil {
+			return written, err
+		}
+		written = append(written, p)
+	}
+	if ext, ok := imageExts[sc.ImageType]; ok && len(sc.Image) > 0 {
+		p := filepath.Join(dir, name+ext)
+		if err := os.WriteFile(p, sc.Image, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, p)
+	}
+	return written, nil
+}
+
+// Move moves the sidecars saved under the name in one folder to the other
+// folder, renamed after the file they accompany, and returns the new paths.
+// Sidecars that were never saved are skipped.
+func Move(fromDir, fromName, toDir, toName string) ([]string, error) {
+	moved := []string{}
+	for _, ext := range extensions() {
+		src := filepath.Join(fromDir, fromName+ext)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		dst := filepath.Join(toDir, toName+ext)
+		if err := os.Rename(src, dst); err != nil {
+			return moved, err
+		}
+		moved = append(moved, dst)
+	}
+	return moved, nil
+}
+
+// Exists returns whether any sidecar was saved under the name
+func Exists(dir, name string) bool {
+	for _, ext := range extensions() {
+		if _, err := os.Stat(filepath.Join(dir, name+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func extensions() []string {
+	exts := []string{NFOExt}
+	for _, ext := range imageExts {
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "//")
+}
@@ -0,0 +1,84 @@
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testServer serves an NFO and reports whether a request was made and
+// which credentials it carried
+func testServer(t *testing.T) (srv *httptest.Server, requests *int, user *string) {
+	t.Helper()
+	requests, user = new(int), new(string)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		*user, _, _ = r.BasicAuth()
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("release notes"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests, user
+}
+
+func TestFetchProviderHost(t *testing.T) {
+	srv, requests, user := testServer(t)
+	u, _ := url.Parse(srv.URL)
+
+	f := Fetcher{Client: srv.Client(), Username: "user", Password: "secret", Hosts: []string{u.Hostname()}}
+	sc, err := f.Fetch(context.Background(), Source{NFO: srv.URL + "/release.nfo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.NFO != "release notes" || *requests != 1 || *user != "user" {
+		t.Fatalf("nfo = %q, requests = %d, user = %q", sc.NFO, *requests, *user)
+	}
+}
+
+func TestFetchRejectsOtherHosts(t *testing.T) {
+	srv, requests, _ := testServer(t)
+
+	f := Fetcher{Client: srv.Client(), Username: "user", Password: "secret", Hosts: []string{"members.example.com"}}
+	sc, err := f.Fetch(context.Background(), Source{
+		NFO:      srv.URL + "/release.nfo",
+		ImageURL: srv.URL + "/preview.jpg",
+	})
+	if !errors.Is(err, ErrUntrustedHost) {
+		t.Fatalf("err = %v, want ErrUntrustedHost", err)
+	}
+	if !sc.Empty() || *requests != 0 {
+		t.Fatalf("sidecars = %+v, requests = %d; off-host URLs were fetched", sc, *requests)
+	}
+}
+
+func TestFetchInlineNFO(t *testing.T) {
+	f := Fetcher{}
+	sc, err := f.Fetch(context.Background(), Source{NFO: "release notes"})
+	if err != nil || sc.NFO != "release notes" {
+		t.Fatalf("nfo = %q, err = %v", sc.NFO, err)
+	}
+}
+
+func TestTrusted(t *testing.T) {
+	f := Fetcher{Hosts: []string{"th.example.com"}}
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"https://th.example.com/a.jpg", true},
+		{"http://TH.example.com:8080/a.jpg", true},
+		{"https://th.example.com.evil.test/a.jpg", false},
+		{"https://evil.test/?th.example.com", false},
+		{"https://user@evil.test/a.jpg", false},
+		{"file:///etc/passwd", false},
+		{"ftp://th.example.com/a.jpg", false},
+	}
+	for _, tt := range tests {
+		if got := f.trusted(tt.uri); got != tt.want {
+			t.Errorf("trusted(%s) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
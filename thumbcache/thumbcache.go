@@ -0,0 +1,205 @@
+package thumbcache
+
+import (
+	"container/list"
+	"errors"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidKey is returned for keys that are not safe to use as file names
+var ErrInvalidKey = errors.New("thumbcache: invalid key")
+
+// keyRegex matches the keys the cache accepts, the post IDs of the provider
+var keyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+// imageExts maps the content types of the cached images to the extension
+// they are stored with, which is how the content type is remembered
+var imageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ValidKey returns whether the key can be cached
+func ValidKey(key string) bool {
+	return keyRegex.MatchString(key)
+}
+
+// Item is a cached image
+type Item struct {
+	Path        string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// Cache keeps images on disk up to a total size, evicting the least
+// recently used images first. The access time is kept in the modification
+// time of the files, so the order survives a restart.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+}
+
+type entry struct {
+	key  string
+	item Item
+}
+
+// Open opens the cache in the folder, creating it when needed, and indexes
+// the images already in it
+func Open(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	items := []entry{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		// left behind by an interrupted write
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		ext := filepath.Ext(f.Name())
+		key := strings.TrimSuffix(f.Name(), ext)
+		contentType := mime.TypeByExtension(ext)
+		info, err := f.Info()
+		if err != nil || !keyRegex.MatchString(key) || !strings.HasPrefix(contentType, "image/") {
+			continue
+		}
+		items = append(items, entry{key: key, item: Item{
+			Path:        filepath.Join(dir, f.Name()),
+			ContentType: contentType,
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+		}})
+	}
+	// most recently used first
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].item.ModTime.After(items[j].item.ModTime)
+	})
+	for _, e := range items {
+		if _, ok := c.entries[e.key]; ok {
+			os.Remove(e.item.Path)
+			continue
+		}
+		c.entries[e.key] = c.lru.PushBack(&entry{key: e.key, item: e.item})
+		c.size += e.item.Size
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+	return c, nil
+}
+
+// Get returns the cached image and marks it as recently used
+func (c *Cache) Get(key string) (Item, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return Item{}, false
+	}
+	e := el.Value.(*entry)
+	if _, err := os.Stat(e.item.Path); err != nil {
+		c.remove(el)
+		return Item{}, false
+	}
+	c.lru.MoveToFront(el)
+	now := time.Now()
+	_ = os.Chtimes(e.item.Path, now, now)
+	return e.item, true
+}
+
+// Put stores the image, replacing an earlier image of the key, and evicts
+// the least recently used images when the cache is over its size
+func (c *Cache) Put(key string, data []byte, contentType string) (Item, error) {
+	if !ValidKey(key) {
+		return Item{}, ErrInvalidKey
+	}
+	ext, ok := imageExts[contentType]
+	if !ok {
+		return Item{}, errors.New("thumbcache: unsupported content type " + contentType)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		os.Remove(el.Value.(*entry).item.Path)
+		c.remove(el)
+	}
+
+	p := filepath.Join(c.dir, key+ext)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return Item{}, err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return Item{}, err
+	}
+
+	item := Item{
+		Path:        p,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		ModTime:     time.Now(),
+	}
+	c.entries[key] = c.lru.PushFront(&entry{key: key, item: item})
+	c.size += item.Size
+	c.evict()
+	return item, nil
+}
+
+// Size returns the total size of the cached images
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// evict deletes the least recently used images until the cache fits its
+// size, always keeping the most recent one
+func (c *Cache) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.lru.Len() > 1 {
+		el := c.lru.Back()
+		os.Remove(el.Value.(*entry).item.Path)
+		c.remove(el)
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.item.Size
+}
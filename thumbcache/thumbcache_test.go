@@ -0,0 +1,241 @@
+package thumbcache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// image returns size bytes of image data
+func image(size int) []byte {
+	return bytes.Repeat([]byte{0xff}, size)
+}
+
+// writeImage writes a cached image last used at the time, as an earlier
+// run of the cache would have left it
+func writeImage(t *testing.T, dir, name string, size int, used time.Time) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, image(size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, used, used); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cached returns the keys in the cache from the most to the least recently
+// used
+func cached(c *Cache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := []string{}
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry).key)
+	}
+	return keys
+}
+
+func equal(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"12345", true},
+		{"abc_DEF-789", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"", false},
+		{"..", false},
+		{"../etc/passwd", false},
+		{`a\b`, false},
+		{"a.jpg", false},
+		{"a b", false},
+		{"a\x00", false},
+	}
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	c, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := c.Put("123", image(10), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(item.Path) != "123.png" || item.ContentType != "image/png" || item.Size != 10 {
+		t.Fatalf("item = %+v", item)
+	}
+	got, ok := c.Get("123")
+	if !ok || got.Path != item.Path {
+		t.Fatalf("Get = %+v, %v", got, ok)
+	}
+
+	// a new image of the key replaces the old one
+	item, err = c.Put("123", image(20), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(item.Path), "123.png")); !os.IsNotExist(err) {
+		t.Errorf("old image not removed: %v", err)
+	}
+	if c.Size() != 20 {
+		t.Errorf("Size = %d, want 20", c.Size())
+	}
+
+	if _, err := c.Put("../x", image(1), "image/png"); err != ErrInvalidKey {
+		t.Errorf("Put(../x) err = %v, want ErrInvalidKey", err)
+	}
+	if _, err := c.Put("456", image(1), "text/html"); err == nil {
+		t.Error("Put with text/html succeeded")
+	}
+	if _, ok := c.Get("456"); ok {
+		t.Error("Get(456) found an image that was never stored")
+	}
+}
+
+func TestEvictionOrder(t *testing.T) {
+	c, err := Open(t.TempDir(), 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.Put(key, image(10), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a is used again, b is the least recently used now
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a not cached")
+	}
+	if _, err := c.Put("d", image(10), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "a", "c"}; !equal(cached(c), want) {
+		t.Fatalf("cached = %v, want %v", cached(c), want)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("b not evicted")
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, "b.jpg")); !os.IsNotExist(err) {
+		t.Errorf("b.jpg not removed: %v", err)
+	}
+
+	// an image larger than the cache evicts everything else but is kept
+	if _, err := c.Put("e", image(50), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"e"}; !equal(cached(c), want) {
+		t.Fatalf("cached = %v, want %v", cached(c), want)
+	}
+	if c.Size() != 50 {
+		t.Errorf("Size = %d, want 50", c.Size())
+	}
+}
+
+func TestOpenReindexes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeImage(t, dir, "old.jpg", 10, now.Add(-3*time.Hour))
+	writeImage(t, dir, "newest.png", 10, now.Add(-time.Minute))
+	writeImage(t, dir, "older.gif", 10, now.Add(-2*time.Hour))
+	writeImage(t, dir, "new.webp", 10, now.Add(-time.Hour))
+	// an interrupted write, a file that is not an image and a name that is
+	// not a key
+	writeImage(t, dir, "partial.jpg.tmp", 10, now)
+	writeImage(t, dir, "notes.txt", 10, now)
+	writeImage(t, dir, "a b.jpg", 10, now)
+
+	c, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"newest", "new", "older", "old"}; !equal(cached(c), want) {
+		t.Fatalf("cached = %v, want %v", cached(c), want)
+	}
+	if c.Size() != 40 {
+		t.Errorf("Size = %d, want 40", c.Size())
+	}
+	item, ok := c.Get("new")
+	if !ok || item.ContentType != "image/webp" {
+		t.Errorf("Get(new) = %+v, %v", item, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial.jpg.tmp")); !os.IsNotExist(err) {
+		t.Errorf("partial.jpg.tmp not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("notes.txt removed: %v", err)
+	}
+}
+
+func TestOpenEnforcesLimit(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeImage(t, dir, "a.jpg", 10, now.Add(-4*time.Hour))
+	writeImage(t, dir, "b.jpg", 10, now.Add(-3*time.Hour))
+	writeImage(t, dir, "c.jpg", 10, now.Add(-2*time.Hour))
+	writeImage(t, dir, "d.jpg", 10, now.Add(-time.Hour))
+
+	c, err := Open(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d", "c"}; !equal(cached(c), want) {
+		t.Fatalf("cached = %v, want %v", cached(c), want)
+	}
+	if c.Size() != 20 {
+		t.Errorf("Size = %d, want 20", c.Size())
+	}
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed: %v", name, err)
+		}
+	}
+}
+
+func TestOrderSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := c.Put(key, image(10), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the file times of the writes can be equal, spread them out
+	now := time.Now()
+	for i, name := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		used := now.Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(filepath.Join(dir, name), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// using a stores the access in its file time
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a not cached")
+	}
+
+	c, err = Open(dir, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c"}; !equal(cached(c), want) {
+		t.Fatalf("cached = %v, want %v", cached(c), want)
+	}
+}
@@ -0,0 +1,268 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	// ErrEmpty is returned for a file without any content
+	ErrEmpty = errors.New("file is empty")
+
+	// ErrNotVideo is returned when the file does not start with the
+	// signature of a known video container, e.g. when an HTML error page
+	// was saved instead of the movie
+	ErrNotVideo = errors.New("file is not a video")
+
+	// ErrTruncated is returned when the container structure extends beyond
+	// the end of the file
+	ErrTruncated = errors.New("file is truncated")
+)
+
+// SizeError is returned when the file size does not match the expected size
+type SizeError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("file size %d does not match the expected size %d", e.Actual, e.Expected)
+}
+
+// Result describes a verified file
+type Result struct {
+	Size      int64
+	Container string
+	SHA256    string
+}
+
+// File checks that the file has the expected size, when it is known, and is
+// a structurally sound video container, and computes its SHA-256
+func File(filename string, expectedSize int64) (Result, error) {
+	return check(filename, expectedSize, true)
+}
+
+// Checksum checks the size of a file that is not a video, e.g. an archive
+// volume, and computes its SHA-256
+func Checksum(filename string, expectedSize int64) (Result, error) {
+	return check(filename, expectedSize, false)
+}
+
+func check(filename string, expectedSize int64, video bool) (Result, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Size: fi.Size()}
+	if res.Size == 0 {
+		return res, ErrEmpty
+	}
+	if expectedSize > 0 && res.Size != expectedSize {
+		return res, &SizeError{Expected: expectedSize, Actual: res.Size}
+	}
+
+	if video {
+		if res.Container, err = Container(f, res.Size); err != nil {
+			return res, err
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, res.Size)); err != nil {
+		return res, err
+	}
+	res.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	return res, nil
+}
+
+// Container identifies the video container from its signature and checks
+// that its top level structure fits the file size. It returns the container
+// name, e.g. matroska, mp4, avi or mpeg-ts.
+func Container(r io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, 16)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}):
+		return "matroska", checkEBML(r, size)
+	case len(head) >= 12 && bytes.Equal(head[0:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("AVI ")):
+		return "avi", checkRIFF(head, size)
+	case len(head) >= 8 && isAtom(head[4:8]):
+		return "mp4", checkAtoms(r, size)
+	case bytes.HasPrefix(head, []byte{0x30, 0x26, 0xb2, 0x75, 0x8e, 0x66, 0xcf, 0x11}):
+		return "asf", nil
+	case bytes.HasPrefix(head, []byte{0x00, 0x00, 0x01, 0xba}):
+		return "mpeg-ps", nil
+	case isTransportStream(r, size, 188, 0):
+		return "mpeg-ts", nil
+	case isTransportStream(r, size, 192, 4):
+		return "m2ts", nil
+	}
+
+	return "", ErrNotVideo
+}
+
+// checkEBML reads the EBML header and verifies that the Segment that
+// follows it does not extend beyond the end of the file
+func checkEBML(r io.ReaderAt, size int64) error {
+	offset := int64(4)
+	headerSize, n, err := readVint(r, offset)
+	if err != nil {
+		return err
+	}
+	offset += int64(n) + headerSize
+
+	id := make([]byte, 4)
+	if _, err := r.ReadAt(id, offset); err != nil {
+		return ErrTruncated
+	}
+	if !bytes.Equal(id, []byte{0x18, 0x53, 0x80, 0x67}) {
+		return ErrNotVideo
+	}
+	offset += 4
+
+	segmentSize, n, err := readVint(r, offset)
+	if err != nil {
+		return err
+	}
+	if segmentSize < 0 {
+		// unknown size, written by live muxers
+		return nil
+	}
+	if offset+int64(n)+segmentSize > size {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// readVint reads an EBML variable length integer. A size with all value
+// bits set means unknown and is returned as -1.
+func readVint(r io.ReaderAt, offset int64) (int64, int, error) {
+	first := make([]byte, 1)
+	if _, err := r.ReadAt(first, offset); err != nil {
+		return 0, 0, ErrTruncated
+	}
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, ErrNotVideo
+	}
+
+	buf := make([]byte, length)
+	if _, err := r.ReadAt(buf, offset); err != nil {
+		return 0, 0, ErrTruncated
+	}
+
+	value := int64(buf[0] & (0xff >> length))
+	unknown := value == int64(0xff>>length)
+	for _, b := range buf[1:] {
+		value = value<<8 | int64(b)
+		unknown = unknown && b == 0xff
+	}
+	if unknown {
+		return -1, length, nil
+	}
+	return value, length, nil
+}
+
+// checkRIFF verifies that the RIFF chunk fits the file
+func checkRIFF(head []byte, size int64) error {
+	chunk := int64(binary.LittleEndian.Uint32(head[4:8]))
+	if chunk+8 > size {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// topLevelAtoms are the atoms an MP4 or QuickTime file starts with
+var topLevelAtoms = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true,
+	"skip": true, "wide": true, "pnot": true, "uuid": true,
+}
+
+func isAtom(typ []byte) bool {
+	return topLevelAtoms[string(typ)]
+}
+
+// checkAtoms walks the top level atoms, which must end exactly at the end
+// of the file, and requires the moov atom that holds the index
+func checkAtoms(r io.ReaderAt, size int64) error {
+	header := make([]byte, 16)
+	offset := int64(0)
+	moov := false
+
+	for offset < size {
+		if size-offset < 8 {
+			return ErrTruncated
+		}
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return ErrTruncated
+		}
+
+		atomSize := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		switch atomSize {
+		case 0:
+			// the atom extends to the end of the file
+			atomSize = size - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return ErrTruncated
+			}
+			atomSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if atomSize < 8 {
+			return ErrNotVideo
+		}
+		if offset+atomSize > size {
+			return ErrTruncated
+		}
+
+		if typ == "moov" {
+			moov = true
+		}
+		offset += atomSize
+	}
+
+	if !moov {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// isTransportStream checks the sync byte of the first packets
+func isTransportStream(r io.ReaderAt, size int64, packet, prefix int64) bool {
+	packets := int64(4)
+	if size < packet*packets {
+		return false
+	}
+
+	b := make([]byte, 1)
+	for i := int64(0); i < packets; i++ {
+		if _, err := r.ReadAt(b, i*packet+prefix); err != nil || b[0] != 0x47 {
+			return false
+		}
+	}
+	return true
+}
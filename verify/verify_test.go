@@ -0,0 +1,167 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ebml returns a Matroska file with an EBML header and a Segment of the
+// given size field followed by the payload
+func ebml(segmentSize []byte, payload []byte) []byte {
+	b := []byte{0x1a, 0x45, 0xdf, 0xa3, 0x84, 0x42, 0x82, 0x81, 0x01}
+	b = append(b, 0x18, 0x53, 0x80, 0x67)
+	b = append(b, segmentSize...)
+	return append(b, payload...)
+}
+
+// riff returns an AVI file whose RIFF chunk claims the size
+func riff(chunk uint32, payload []byte) []byte {
+	b := []byte("RIFF")
+	b = binary.LittleEndian.AppendUint32(b, chunk)
+	b = append(b, "AVI "...)
+	return append(b, payload...)
+}
+
+// atom returns an MP4 atom of the type holding the payload
+func atom(typ string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	b = append(b, typ...)
+	return append(b, payload...)
+}
+
+// transportStream returns packets of the size with the sync byte after the
+// prefix
+func transportStream(packet, prefix, packets int) []byte {
+	b := make([]byte, packet*packets)
+	for i := 0; i < packets; i++ {
+		b[i*packet+prefix] = 0x47
+	}
+	return b
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestContainer(t *testing.T) {
+	ftyp := atom("ftyp", []byte("isom\x00\x00\x02\x00isomiso2"))
+	moov := atom("moov", make([]byte, 32))
+	mdat := atom("mdat", make([]byte, 100))
+
+	// a 64 bit size atom
+	large := binary.BigEndian.AppendUint32(nil, 1)
+	large = append(large, "mdat"...)
+	large = binary.BigEndian.AppendUint64(large, 16+50)
+	large = append(large, make([]byte, 50)...)
+
+	// an atom extending to the end of the file
+	open := concat(binary.BigEndian.AppendUint32(nil, 0), []byte("mdat"), make([]byte, 40))
+
+	tests := []struct {
+		name      string
+		data      []byte
+		container string
+		err       error
+	}{
+		{"matroska", ebml([]byte{0x84}, make([]byte, 4)), "matroska", nil},
+		{"matroska two byte size", ebml([]byte{0x40, 0x10}, make([]byte, 16)), "matroska", nil},
+		{"matroska unknown size", ebml([]byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, make([]byte, 10)), "matroska", nil},
+		{"matroska truncated", ebml([]byte{0x88}, make([]byte, 4)), "matroska", ErrTruncated},
+		{"matroska without segment", concat([]byte{0x1a, 0x45, 0xdf, 0xa3, 0x81, 0x00}, []byte{0x16, 0x54, 0xae, 0x6b, 0x80}), "matroska", ErrNotVideo},
+		{"matroska header only", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x84, 0x42, 0x82}, "matroska", ErrTruncated},
+		{"matroska invalid size", []byte{0x1a, 0x45, 0xdf, 0xa3, 0x00, 0x00}, "matroska", ErrNotVideo},
+
+		{"avi", riff(20, make([]byte, 16)), "avi", nil},
+		{"avi truncated", riff(1000, make([]byte, 16)), "avi", ErrTruncated},
+		{"wav", concat([]byte("RIFF"), []byte{4, 0, 0, 0}, []byte("WAVE")), "", ErrNotVideo},
+
+		{"mp4", concat(ftyp, moov, mdat), "mp4", nil},
+		{"mp4 moov last", concat(ftyp, mdat, moov), "mp4", nil},
+		{"mp4 large atom", concat(ftyp, moov, large), "mp4", nil},
+		{"mp4 open atom", concat(ftyp, moov, open), "mp4", nil},
+		{"mp4 without moov", concat(ftyp, mdat), "mp4", ErrTruncated},
+		{"mp4 truncated mdat", concat(ftyp, moov, mdat[:60]), "mp4", ErrTruncated},
+		{"mp4 trailing bytes", concat(ftyp, moov, []byte{0, 0, 0}), "mp4", ErrTruncated},
+		{"mp4 invalid atom size", concat(ftyp, []byte{0, 0, 0, 4}, []byte("moov")), "mp4", ErrNotVideo},
+
+		{"asf", concat([]byte{0x30, 0x26, 0xb2, 0x75, 0x8e, 0x66, 0xcf, 0x11}, make([]byte, 24)), "asf", nil},
+		{"mpeg-ps", concat([]byte{0x00, 0x00, 0x01, 0xba}, make([]byte, 20)), "mpeg-ps", nil},
+		{"mpeg-ts", transportStream(188, 0, 4), "mpeg-ts", nil},
+		{"m2ts", transportStream(192, 4, 4), "m2ts", nil},
+		{"mpeg-ts too short", transportStream(188, 0, 3), "", ErrNotVideo},
+		{"mpeg-ts lost sync", concat(transportStream(188, 0, 3), make([]byte, 188)), "", ErrNotVideo},
+
+		{"html", []byte("<!DOCTYPE html><html><body>404 Not Found</body></html>"), "", ErrNotVideo},
+		{"zeros", make([]byte, 1024), "", ErrNotVideo},
+		{"short", []byte{0x1a}, "", ErrNotVideo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container, err := Container(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if tt.err == nil && err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if container != tt.container {
+				t.Errorf("container = %q, want %q", container, tt.container)
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	mkv := ebml([]byte{0x88}, make([]byte, 8))
+	sum := sha256.Sum256(mkv)
+	res, err := File(write("movie.mkv", mkv), int64(len(mkv)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Container != "matroska" || res.Size != int64(len(mkv)) || res.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("result = %+v", res)
+	}
+
+	// the size is only checked when it is known
+	if _, err := File(write("unknown.mkv", mkv), 0); err != nil {
+		t.Errorf("unknown size: %v", err)
+	}
+
+	var sizeErr *SizeError
+	if _, err := File(write("short.mkv", mkv), 100); !errors.As(err, &sizeErr) || sizeErr.Expected != 100 || sizeErr.Actual != int64(len(mkv)) {
+		t.Errorf("size mismatch err = %v", err)
+	}
+	if _, err := File(write("empty.mkv", nil), 0); !errors.Is(err, ErrEmpty) {
+		t.Errorf("empty err = %v, want ErrEmpty", err)
+	}
+	if _, err := File(write("error.mkv", []byte("<html>Forbidden</html>")), 0); !errors.Is(err, ErrNotVideo) {
+		t.Errorf("html err = %v, want ErrNotVideo", err)
+	}
+	if _, err := File(filepath.Join(dir, "missing.mkv"), 0); !os.IsNotExist(err) {
+		t.Errorf("missing err = %v", err)
+	}
+
+	// archive volumes are not videos, only their size is checked
+	res, err = Checksum(write("movie.rar", []byte("Rar!\x1a\x07\x00")), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Container != "" || res.SHA256 == "" {
+		t.Errorf("checksum result = %+v", res)
+	}
+}
@@ -0,0 +1,148 @@
+package yenc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoHeader is returned when the article body holds no yEnc data
+	ErrNoHeader = errors.New("yenc: no =ybegin header")
+
+	// ErrTrailer is returned when the =yend trailer is missing, the
+	// article was cut short
+	ErrTrailer = errors.New("yenc: no =yend trailer")
+)
+
+// CRCError is returned when the decoded data does not match the checksum
+// of the trailer
+type CRCError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *CRCError) Error() string {
+	return fmt.Sprintf("yenc: crc32 mismatch: expected %08x, got %08x", e.Expected, e.Actual)
+}
+
+// SizeError is returned when the decoded data is not as long as the
+// trailer says
+type SizeError struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("yenc: size mismatch: expected %d bytes, got %d", e.Expected, e.Actual)
+}
+
+// Part is the decoded data of one article of a file
+type Part struct {
+	Name string
+	// Size is the size of the whole file
+	Size int64
+	// Number is the part number, 1 for single part files
+	Number int
+	// Begin is the offset of the data in the file
+	Begin int64
+	Data  []byte
+}
+
+// Decode decodes the yEnc data of the article body and checks its size
+// and CRC32 against the trailer
+func Decode(body []byte) (*Part, error) {
+	lines := bytes.Split(body, []byte("\n"))
+
+	i := 0
+	for ; i < len(lines) && !bytes.HasPrefix(lines[i], []byte("=ybegin ")); i++ {
+	}
+	if i == len(lines) {
+		return nil, ErrNoHeader
+	}
+	header := keywords(lines[i])
+	i++
+
+	p := &Part{Number: 1, Name: header["name"]}
+	p.Size, _ = strconv.ParseInt(header["size"], 10, 64)
+	if n, err := strconv.Atoi(header["part"]); err == nil && n > 0 {
+		p.Number = n
+		if i < len(lines) && bytes.HasPrefix(lines[i], []byte("=ypart ")) {
+			part := keywords(lines[i])
+			if begin, err := strconv.ParseInt(part["begin"], 10, 64); err == nil && begin > 0 {
+				p.Begin = begin - 1
+			}
+			i++
+		}
+	}
+
+	data := make([]byte, 0, len(body))
+	var trailer map[string]string
+	for ; i < len(lines); i++ {
+		line := bytes.TrimRight(lines[i], "\r")
+		if bytes.HasPrefix(line, []byte("=yend")) {
+			trailer = keywords(line)
+			break
+		}
+		data = decodeLine(data, line)
+	}
+	if trailer == nil {
+		return nil, ErrTrailer
+	}
+	p.Data = data
+
+	if size, err := strconv.ParseInt(trailer["size"], 10, 64); err == nil && size != int64(len(data)) {
+		return nil, &SizeError{Expected: size, Actual: int64(len(data))}
+	}
+	crc := trailer["pcrc32"]
+	if crc == "" && header["part"] == "" {
+		crc = trailer["crc32"]
+	}
+	if crc != "" {
+		expected, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(crc), "0x"), 16, 32)
+		if err == nil {
+			if actual := crc32.ChecksumIEEE(data); uint32(expected) != actual {
+				return nil, &CRCError{Expected: uint32(expected), Actual: actual}
+			}
+		}
+	}
+	return p, nil
+}
+
+func decodeLine(dst, line []byte) []byte {
+	for j := 0; j < len(line); j++ {
+		c := line[j]
+		switch c {
+		case '\r', '\n':
+			continue
+		case '=':
+			j++
+			if j == len(line) {
+				return dst
+			}
+			c = line[j] - 64
+		}
+		dst = append(dst, c-42)
+	}
+	return dst
+}
+
+// keywords parses the key=value pairs of a header or trailer line. The
+// name is always the last keyword and may contain spaces.
+func keywords(line []byte) map[string]string {
+	s := strings.TrimRight(string(line), "\r\n")
+	kw := map[string]string{}
+	if i := strings.Index(s, " name="); i >= 0 {
+		kw["name"] = strings.TrimSpace(s[i+len(" name="):])
+		s = s[:i]
+	}
+	for _, field := range strings.Fields(s) {
+		if k, v, ok := strings.Cut(field, "="); ok && k != "" {
+			kw[k] = v
+		}
+	}
+	return kw
+}
@@ -0,0 +1,109 @@
+package yenc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+// encode returns an article body with the yEnc encoded data. Part is zero
+// for a single part file.
+func encode(name string, size int64, part int, begin int64, data []byte, trailer string) []byte {
+	var b bytes.Buffer
+	if part > 0 {
+		fmt.Fprintf(&b, "=ybegin part=%d line=128 size=%d name=%s\r\n", part, size, name)
+		fmt.Fprintf(&b, "=ypart begin=%d end=%d\r\n", begin+1, begin+int64(len(data)))
+	} else {
+		fmt.Fprintf(&b, "=ybegin line=128 size=%d name=%s\r\n", size, name)
+	}
+	col := 0
+	for _, c := range data {
+		e := c + 42
+		switch e {
+		case 0, '\n', '\r', '=':
+			b.WriteByte('=')
+			e += 64
+			col++
+		}
+		b.WriteByte(e)
+		col++
+		if col >= 128 {
+			b.WriteString("\r\n")
+			col = 0
+		}
+	}
+	b.WriteString("\r\n")
+	b.WriteString(trailer + "\r\n")
+	return b.Bytes()
+}
+
+// data returns every byte value, including the ones that are escaped
+func data() []byte {
+	d := make([]byte, 600)
+	for i := range d {
+		d[i] = byte(i)
+	}
+	return d
+}
+
+func TestDecodeSinglePart(t *testing.T) {
+	d := data()
+	body := encode("movie name.mkv", int64(len(d)), 0, 0, d, fmt.Sprintf("=yend size=%d crc32=%08x", len(d), crc32.ChecksumIEEE(d)))
+
+	p, err := Decode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Data, d) {
+		t.Fatal("decoded data differs")
+	}
+	if p.Name != "movie name.mkv" || p.Size != int64(len(d)) || p.Number != 1 || p.Begin != 0 {
+		t.Fatalf("part = %+v", p)
+	}
+}
+
+func TestDecodeMultiPart(t *testing.T) {
+	d := data()[100:300]
+	body := encode("movie.mkv", 1000, 2, 100, d, fmt.Sprintf("=yend size=%d part=2 pcrc32=%08x crc32=deadbeef", len(d), crc32.ChecksumIEEE(d)))
+
+	p, err := Decode(append([]byte("some preamble\n"), body...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Data, d) || p.Number != 2 || p.Begin != 100 || p.Size != 1000 {
+		t.Fatalf("part = %+v", p)
+	}
+}
+
+func TestDecodeCRCMismatch(t *testing.T) {
+	d := data()
+	body := encode("movie.mkv", int64(len(d)), 1, 0, d, fmt.Sprintf("=yend size=%d part=1 pcrc32=%08x", len(d), crc32.ChecksumIEEE(d)^1))
+
+	_, err := Decode(body)
+	var crcErr *CRCError
+	if !errors.As(err, &crcErr) {
+		t.Fatalf("err = %v, want *CRCError", err)
+	}
+}
+
+func TestDecodeSizeMismatch(t *testing.T) {
+	d := data()
+	body := encode("movie.mkv", int64(len(d)), 0, 0, d, fmt.Sprintf("=yend size=%d", len(d)+1))
+
+	_, err := Decode(body)
+	var sizeErr *SizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Actual != int64(len(d)) {
+		t.Fatalf("err = %v, want *SizeError", err)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	if _, err := Decode([]byte("no yenc here\n")); !errors.Is(err, ErrNoHeader) {
+		t.Fatalf("err = %v, want ErrNoHeader", err)
+	}
+	if _, err := Decode([]byte("=ybegin line=128 size=3 name=a\r\nabc\r\n")); !errors.Is(err, ErrTrailer) {
+		t.Fatalf("err = %v, want ErrTrailer", err)
+	}
+}